@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+const (
+	kaitenAccessReader    = "reader"
+	kaitenAccessCommenter = "commenter"
+	kaitenAccessWriter    = "writer"
+	kaitenAccessOwner     = "owner"
+)
+
+var kaitenAccessRank = map[string]int{
+	kaitenAccessReader:    1,
+	kaitenAccessCommenter: 2,
+	kaitenAccessWriter:    3,
+	kaitenAccessOwner:     4,
+}
+
+// kaitenAccessRoleIds maps the role_id of Kaiten space and board users and
+// groups to access roles. KAITEN_ACCESS_ROLE_IDS replaces it.
+var kaitenAccessRoleIds = map[float64]string{
+	1: kaitenAccessReader,
+	2: kaitenAccessWriter,
+	3: kaitenAccessOwner,
+}
+
+// kaitenAccessRole reads the access role of a Kaiten space or board user or
+// group from its role_id. A missing or unknown role_id is an error rather
+// than a guess, so that nobody silently gets less or more access.
+func kaitenAccessRole(entry map[string]any) (string, error) {
+	id, ok := entry["role_id"].(float64)
+	if !ok {
+		return "", fmt.Errorf("access entry has no role_id")
+	}
+	role, ok := kaitenAccessRoleIds[id]
+	if !ok {
+		return "", fmt.Errorf("unknown Kaiten access role_id %s, map it in KAITEN_ACCESS_ROLE_IDS", formatKaitenID(id))
+	}
+	return role, nil
+}
+
+// accessGrant is a user's Kaiten access role and where it comes from: direct
+// access or the group that grants it.
+type accessGrant struct {
+	Role string
+	Via  string
+}
+
+// accessResolver turns Kaiten space and board access into access grants keyed
+// by e-mail, expanding groups into their members.
+type accessResolver struct {
+	source   Source
+	users    map[float64]KaitenUser
+	inactive *inactiveUsers
+
+	mu     sync.Mutex
+	spaces map[string]map[string]accessGrant
+	groups map[string][]float64
+}
+
+func newAccessResolver(source Source, users map[float64]KaitenUser, inactive *inactiveUsers) *accessResolver {
+	return &accessResolver{
+		source:   source,
+		users:    users,
+		inactive: inactive,
+		spaces:   make(map[string]map[string]accessGrant),
+		groups:   make(map[string][]float64),
+	}
+}
+
+// space returns the access grants of a space. A subspace without its own access
+// list inherits its parent's.
+func (r *accessResolver) space(space KaitenSpace, spaces map[string]KaitenSpace) map[string]accessGrant {
+	r.mu.Lock()
+	roles, cached := r.spaces[space.UID]
+	r.mu.Unlock()
+	if cached {
+		return roles
+	}
+
+	access, err := r.source.SpaceAccess(space)
+	if err != nil {
+		log.Printf("Error getting access of space %s: %v", space.Name, err)
+	}
+	roles = r.roles(access)
+	if len(roles) == 0 && space.ParentID != "" {
+		if parent, ok := spaces[space.ParentID]; ok {
+			roles = r.space(parent, spaces)
+		}
+	}
+
+	r.mu.Lock()
+	r.spaces[space.UID] = roles
+	r.mu.Unlock()
+	return roles
+}
+
+// board returns the access grants of a board: its own access list when Kaiten
+// restricts the board, the space access otherwise.
+func (r *accessResolver) board(board KaitenBoard, space KaitenSpace, spaces map[string]KaitenSpace) map[string]accessGrant {
+	access, err := r.source.BoardAccess(board)
+	if err == nil {
+		if roles := r.roles(access); len(roles) > 0 {
+			return roles
+		}
+	}
+	return r.space(space, spaces)
+}
+
+func (r *accessResolver) roles(access []KaitenAccess) map[string]accessGrant {
+	roles := make(map[string]accessGrant)
+	grant := func(email string, role string, via string) {
+		email = r.inactive.member(email)
+		if email == "" {
+			return
+		}
+		if kaitenAccessRank[role] > kaitenAccessRank[roles[email].Role] {
+			roles[email] = accessGrant{Role: role, Via: via}
+		}
+	}
+
+	for _, entry := range access {
+		if entry.GroupUID != "" {
+			via := "group " + entry.GroupName
+			if entry.GroupName == "" {
+				via = "group " + entry.GroupUID
+			}
+			for _, userId := range r.groupUsers(entry.GroupUID) {
+				grant(r.users[userId].Email, entry.Role, via)
+			}
+			continue
+		}
+		email := entry.Email
+		if email == "" {
+			email = r.users[entry.UserID].Email
+		}
+		grant(email, entry.Role, "direct")
+	}
+	return roles
+}
+
+// owners returns the users who own at least one of the resolved spaces.
+func (r *accessResolver) owners() map[string]struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	owners := make(map[string]struct{})
+	for _, roles := range r.spaces {
+		for email, grant := range roles {
+			if grant.Role == kaitenAccessOwner {
+				owners[email] = struct{}{}
+			}
+		}
+	}
+	return owners
+}
+
+func (r *accessResolver) groupUsers(groupUID string) []float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if users, cached := r.groups[groupUID]; cached {
+		return users
+	}
+	users, err := r.source.GroupUsers(groupUID)
+	if err != nil {
+		log.Printf("Error expanding Kaiten group %s: %v", groupUID, err)
+	}
+	r.groups[groupUID] = users
+	return users
+}
+
+// applyProjectAccess makes space owners PLANKA project managers.
+func (m *migration) applyProjectAccess(project PlankaProject, roles map[string]accessGrant) {
+	for email, grant := range roles {
+		if grant.Role != kaitenAccessOwner || email == m.sink.AccountEmail() {
+			continue
+		}
+		userId, ok := m.plankaUserIds[email]
+		if !ok {
+			log.Printf("No Planka user for project manager %s", email)
+			continue
+		}
+		if err := m.sink.AddProjectManager(project.ID, userId); err != nil {
+			log.Printf("Error adding project manager %s to project %s: %v", email, project.ID, err)
+			continue
+		}
+		m.permissions.add("project", project.Name, "", email, grant.Role, "manager", grant.Via)
+	}
+}
+
+// applyBoardAccess adds board memberships: owners and writers become editors,
+// commenters and readers viewers, with commenting allowed for all but readers.
+func (m *migration) applyBoardAccess(projectName string, board PlankaBoard, roles map[string]accessGrant) {
+	for email, grant := range roles {
+		if email == m.sink.AccountEmail() {
+			continue
+		}
+		userId, ok := m.plankaUserIds[email]
+		if !ok {
+			log.Printf("No Planka user for board member %s", email)
+			continue
+		}
+
+		plankaRole := "viewer"
+		if kaitenAccessRank[grant.Role] >= kaitenAccessRank[kaitenAccessWriter] {
+			plankaRole = "editor"
+		}
+		canComment := grant.Role != kaitenAccessReader
+		if err := m.sink.AddBoardMember(board.ID, userId, plankaRole, canComment); err != nil {
+			log.Printf("Error setting Planka board member for board %s and user %s: %v", board.ID, userId, err)
+			continue
+		}
+		if canComment && plankaRole == "viewer" {
+			plankaRole += "+comments"
+		}
+		m.permissions.add("board", projectName, board.Name, email, grant.Role, plankaRole, grant.Via)
+	}
+}
@@ -0,0 +1,625 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The archive is a read-only copy of boards that can be browsed offline:
+//
+//	index.<ext>                     spaces and their boards
+//	boards/<id>/index.<ext>         columns and cards of a board
+//	boards/<id>/cards/<id>.<ext>    a card with its checklists and comments
+//	boards/<id>/files/<card id>/    attachments and images of the card
+//
+// Pages are Markdown, or HTML rendered from the same Markdown.
+const defaultArchiveDir = "kaiten-archive"
+
+const (
+	archiveMarkdown = "markdown"
+	archiveHTML     = "html"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[\x00-\x1f/\\:*?"<>|]+`)
+
+type archiveBoard struct {
+	board   KaitenBoard
+	space   string
+	columns []archiveColumn
+}
+
+type archiveColumn struct {
+	column KaitenColumn
+	cards  []KaitenCard
+}
+
+// archiveWriter renders boards of a source as pages. Like export, it logs and
+// counts what fails to load instead of stopping.
+type archiveWriter struct {
+	dir    string
+	format string
+	source Source
+	// only holds the IDs and titles of ARCHIVE_BOARDS, empty for all boards.
+	only      map[string]bool
+	names     map[string]string
+	tags      map[float64]KaitenTag
+	boards    []*archiveBoard
+	cardBoard map[float64]float64
+	// cardTitles titles bare links to archived cards.
+	cardTitles map[float64]string
+	cardLinks  *regexp.Regexp
+	errors     int
+}
+
+func exportArchive(source Source, dir string) error {
+	format := strings.ToLower(getEnvDefault("ARCHIVE_FORMAT", archiveMarkdown))
+	if format != archiveMarkdown && format != archiveHTML {
+		return fmt.Errorf("invalid ARCHIVE_FORMAT %q, expected %s or %s", format, archiveMarkdown, archiveHTML)
+	}
+	w := &archiveWriter{
+		dir:        dir,
+		format:     format,
+		source:     source,
+		only:       make(map[string]bool),
+		names:      make(map[string]string),
+		cardBoard:  make(map[float64]float64),
+		cardTitles: make(map[float64]string),
+		cardLinks:  kaitenCardLinks(source.URL()),
+	}
+	for _, board := range strings.Split(getEnvDefault("ARCHIVE_BOARDS", ""), ",") {
+		if board = strings.TrimSpace(board); board != "" {
+			w.only[board] = true
+		}
+	}
+
+	if err := w.load(); err != nil {
+		return err
+	}
+	if err := w.render(); err != nil {
+		return err
+	}
+	if w.errors > 0 {
+		return fmt.Errorf("archive written to %s with %d errors, see the log", dir, w.errors)
+	}
+	log.Printf("Archive of %d boards written to %s", len(w.boards), dir)
+	return nil
+}
+
+// load reads the boards, columns and cards, so that card pages can link to
+// each other.
+func (w *archiveWriter) load() error {
+	users, err := w.source.Users()
+	if err != nil {
+		return fmt.Errorf("error getting users: %w", err)
+	}
+	for _, user := range users {
+		w.names[user.Email] = user.FullName
+	}
+	if w.tags, err = w.source.Tags(); err != nil {
+		return fmt.Errorf("error getting tags: %w", err)
+	}
+	spaces, err := w.source.Spaces()
+	if err != nil {
+		return fmt.Errorf("error getting spaces: %w", err)
+	}
+
+	uids := make([]string, 0, len(spaces))
+	for uid := range spaces {
+		uids = append(uids, uid)
+	}
+	sort.Slice(uids, func(i, j int) bool { return spacePath(spaces, uids[i]) < spacePath(spaces, uids[j]) })
+	for _, uid := range uids {
+		boards, err := w.source.Boards(spaces[uid])
+		if err != nil {
+			w.fail("Error getting boards of space %s: %v", spaces[uid].Name, err)
+			continue
+		}
+		for _, board := range boards {
+			if len(w.only) > 0 && !w.only[formatKaitenID(board.ID)] && !w.only[board.Title] {
+				continue
+			}
+			log.Printf("Reading board %s", board.Title)
+			archived := &archiveBoard{board: board, space: spacePath(spaces, uid)}
+			columns, err := w.source.Columns(board)
+			if err != nil {
+				w.fail("Error getting columns of board %s: %v", board.Title, err)
+			}
+			for _, column := range columns {
+				cards, err := w.source.Cards(column)
+				if err != nil {
+					w.fail("Error getting cards of column %s: %v", column.Name, err)
+				}
+				sort.SliceStable(cards, func(i, j int) bool { return cards[i].SortOrder < cards[j].SortOrder })
+				for _, card := range cards {
+					w.cardBoard[card.ID] = board.ID
+					w.cardTitles[card.ID] = card.Title
+				}
+				archived.columns = append(archived.columns, archiveColumn{column: column, cards: cards})
+			}
+			w.boards = append(w.boards, archived)
+		}
+	}
+	return nil
+}
+
+// spacePath is the name of a space prefixed with the names of its parents.
+func spacePath(spaces map[string]KaitenSpace, uid string) string {
+	space := spaces[uid]
+	if parent, ok := spaces[space.ParentID]; ok && space.ParentID != uid {
+		return spacePath(spaces, parent.UID) + " / " + space.Name
+	}
+	return space.Name
+}
+
+func (w *archiveWriter) render() error {
+	var index strings.Builder
+	index.WriteString("# Kaiten\n\n")
+	if w.source.URL() != "" {
+		fmt.Fprintf(&index, "Archived from %s on %s.\n\n", w.source.URL(), time.Now().Format("2006-01-02"))
+	}
+	for i, board := range w.boards {
+		if i == 0 || board.space != w.boards[i-1].space {
+			fmt.Fprintf(&index, "\n## %s\n\n", archiveEscape(board.space))
+		}
+		fmt.Fprintf(&index, "- [%s](%s)\n", archiveEscape(board.board.Title), w.page("boards", formatKaitenID(board.board.ID), "index"))
+
+		if err := w.renderBoard(board); err != nil {
+			return err
+		}
+	}
+	return w.write("index", "Kaiten", index.String())
+}
+
+func (w *archiveWriter) renderBoard(board *archiveBoard) error {
+	boardDir := path.Join("boards", formatKaitenID(board.board.ID))
+	var page strings.Builder
+	fmt.Fprintf(&page, "[All boards](%s)\n\n# %s\n\n%s\n", w.page("..", "..", "index"), archiveEscape(board.board.Title), archiveEscape(board.space))
+	for _, column := range board.columns {
+		fmt.Fprintf(&page, "\n## %s\n\n", archiveEscape(column.column.Name))
+		if len(column.cards) == 0 {
+			page.WriteString("No cards.\n")
+		}
+		for _, card := range column.cards {
+			fmt.Fprintf(&page, "- [%s](%s)", archiveEscape(card.Title), w.page("cards", formatKaitenID(card.ID)))
+			if details := w.cardDetails(card); details != "" {
+				page.WriteString(" — " + details)
+			}
+			page.WriteString("\n")
+
+			if err := w.renderCard(boardDir, board, column.column, card); err != nil {
+				return err
+			}
+		}
+	}
+	return w.write(path.Join(boardDir, "index"), board.board.Title, page.String())
+}
+
+// cardDetails is a line with the state, type, tags, members and due date of
+// a card.
+func (w *archiveWriter) cardDetails(card KaitenCard) string {
+	var details []string
+	if card.Archived {
+		details = append(details, "archived")
+	}
+	if card.Type.Name != "" {
+		details = append(details, archiveEscape(card.Type.Name))
+	}
+	for _, tagId := range card.TagIds {
+		if tag, ok := w.tags[tagId]; ok {
+			details = append(details, "#"+archiveEscape(tag.Name))
+		}
+	}
+	for _, member := range card.Members {
+		name := member.FullName
+		if name == "" {
+			name = member.Email
+		}
+		if member.Type == kaitenMemberTypeResponsible {
+			name += " (responsible)"
+		}
+		details = append(details, archiveEscape(name))
+	}
+	if card.DueDate != "" {
+		details = append(details, "due "+archiveDate(card.DueDate))
+	}
+	return strings.Join(details, ", ")
+}
+
+func (w *archiveWriter) renderCard(boardDir string, board *archiveBoard, column KaitenColumn, card KaitenCard) error {
+	files := &archiveFiles{w: w, dir: path.Join(boardDir, "files", formatKaitenID(card.ID)), names: make(map[string]string), used: make(map[string]bool)}
+
+	var page strings.Builder
+	fmt.Fprintf(&page, "[%s](%s) / %s\n\n# %s\n\n", archiveEscape(board.board.Title), w.page("..", "index"), archiveEscape(column.Name), archiveEscape(card.Title))
+	if details := w.cardDetails(card); details != "" {
+		page.WriteString(details + "\n\n")
+	}
+	if description := w.text(files, card.Description); description != "" {
+		page.WriteString(description + "\n\n")
+	}
+
+	for _, checklistId := range card.Checklists {
+		checklist, err := w.source.Checklist(card.ID, checklistId)
+		if err != nil {
+			w.fail("Error getting checklist %s of card %s: %v", formatKaitenID(checklistId), card.Title, err)
+			continue
+		}
+		fmt.Fprintf(&page, "## %s\n\n", archiveEscape(checklist.Name))
+		for _, item := range checklist.Items {
+			mark := " "
+			if item.Checked {
+				mark = "x"
+			}
+			fmt.Fprintf(&page, "- [%s] %s\n", mark, archiveEscape(item.Text))
+		}
+		page.WriteString("\n")
+	}
+
+	attachments, err := w.source.Attachments(card.ID)
+	if err != nil {
+		w.fail("Error getting attachments of card %s: %v", card.Title, err)
+	}
+	if len(attachments) > 0 {
+		page.WriteString("## Attachments\n\n")
+		for _, attachment := range attachments {
+			name := attachment.Name
+			if name == "" {
+				name = inlineImageName(attachment.URL)
+			}
+			link, err := files.save(attachment.URL, name)
+			if err != nil {
+				w.fail("Error downloading attachment %s of card %s: %v", name, card.Title, err)
+				fmt.Fprintf(&page, "- %s (not downloaded)\n", archiveEscape(name))
+				continue
+			}
+			fmt.Fprintf(&page, "- [%s](%s)\n", archiveEscape(name), link)
+		}
+		page.WriteString("\n")
+	}
+
+	comments, err := w.source.Comments(card.ID)
+	if err != nil {
+		w.fail("Error getting comments of card %s: %v", card.Title, err)
+	}
+	if len(comments) > 0 {
+		page.WriteString("## Comments\n\n")
+		sort.SliceStable(comments, func(i, j int) bool { return comments[i].CreatedAt < comments[j].CreatedAt })
+		for _, comment := range comments {
+			author := w.names[comment.AuthorEmail]
+			if author == "" {
+				author = comment.AuthorEmail
+			}
+			heading := archiveEscape(author)
+			if comment.CreatedAt != "" {
+				heading += ", " + archiveDate(comment.CreatedAt)
+			}
+			fmt.Fprintf(&page, "### %s\n\n%s\n\n", heading, w.text(files, comment.Text))
+		}
+	}
+
+	return w.write(path.Join(boardDir, "cards", formatKaitenID(card.ID)), card.Title, page.String())
+}
+
+// text stores the images of Markdown text next to the card and points links
+// to archived cards at their pages.
+func (w *archiveWriter) text(files *archiveFiles, text string) string {
+	text = markdownImagePattern.ReplaceAllStringFunc(text, func(match string) string {
+		parts := markdownImagePattern.FindStringSubmatch(match)
+		if !w.source.IsFileURL(parts[2]) {
+			return match
+		}
+		link, err := files.save(parts[2], inlineImageName(parts[2]))
+		if err != nil {
+			w.fail("Error downloading image %s: %v", parts[2], err)
+			return match
+		}
+		return "![" + parts[1] + "](" + link + ")"
+	})
+	if w.cardLinks != nil {
+		text = w.linkCards(text)
+	}
+	return text
+}
+
+// linkCards points links to archived cards at their pages. Bare links
+// become Markdown links titled with the card.
+func (w *archiveWriter) linkCards(text string) string {
+	var out strings.Builder
+	last := 0
+	for _, match := range w.cardLinks.FindAllStringSubmatchIndex(text, -1) {
+		cardId, err := strconv.ParseFloat(text[match[2]:match[3]], 64)
+		boardId, ok := w.cardBoard[cardId]
+		if err != nil || !ok {
+			continue
+		}
+		link := w.page("..", "..", formatKaitenID(boardId), "cards", formatKaitenID(cardId))
+		out.WriteString(text[last:match[0]])
+		if match[0] > 0 && text[match[0]-1] == '(' {
+			out.WriteString(link)
+		} else {
+			fmt.Fprintf(&out, "[%s](%s)", archiveEscape(w.cardTitles[cardId]), link)
+		}
+		last = match[1]
+	}
+	out.WriteString(text[last:])
+	return out.String()
+}
+
+// archiveFiles stores the files of one card under unique names.
+type archiveFiles struct {
+	w     *archiveWriter
+	dir   string
+	names map[string]string
+	used  map[string]bool
+}
+
+// save downloads the file at fileURL straight into the card's directory and
+// returns its link relative to the card page.
+func (f *archiveFiles) save(fileURL string, name string) (string, error) {
+	if stored, ok := f.names[fileURL]; ok {
+		return f.link(stored), nil
+	}
+	name = strings.Trim(unsafeFileChars.ReplaceAllString(name, "_"), " .")
+	if name == "" {
+		name = "file"
+	}
+	stored := name
+	for i := 2; f.used[stored]; i++ {
+		ext := path.Ext(name)
+		stored = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	dir := filepath.Join(f.w.dir, f.dir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	file, err := spoolSourceFile(f.w.source, fileURL, dir)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(file.path, filepath.Join(dir, stored)); err != nil {
+		os.Remove(file.path)
+		return "", err
+	}
+	f.used[stored] = true
+	f.names[fileURL] = stored
+	return f.link(stored), nil
+}
+
+func (f *archiveFiles) link(name string) string {
+	return "../files/" + path.Base(f.dir) + "/" + url.PathEscape(name)
+}
+
+// page is the relative link to a page with the archive's extension.
+func (w *archiveWriter) page(elem ...string) string {
+	return path.Join(elem...) + w.ext()
+}
+
+func (w *archiveWriter) ext() string {
+	if w.format == archiveHTML {
+		return ".html"
+	}
+	return ".md"
+}
+
+func (w *archiveWriter) write(name string, title string, markdown string) error {
+	content := markdown
+	if w.format == archiveHTML {
+		content = "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>" + html.EscapeString(title) + "</title>\n<style>" + archiveStyle + "</style>\n</head>\n<body>\n" + markdownHTML(markdown) + "</body>\n</html>\n"
+	}
+	fullPath := filepath.Join(w.dir, filepath.FromSlash(name+w.ext()))
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	if err := os.WriteFile(fullPath, []byte(content), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+func (w *archiveWriter) fail(format string, args ...any) {
+	log.Printf(format, args...)
+	w.errors++
+}
+
+const archiveStyle = `body{font-family:sans-serif;max-width:60em;margin:2em auto;padding:0 1em;line-height:1.5}
+img{max-width:100%}pre{background:#f4f4f4;padding:.5em;overflow:auto}
+blockquote{border-left:3px solid #ccc;margin-left:0;padding-left:1em;color:#555}
+li.task{list-style:none}`
+
+var archiveSpecialChars = regexp.MustCompile("([\\\\`*_\\[\\]#<>!|])")
+
+// archiveEscape escapes Markdown in plain text such as titles.
+func archiveEscape(text string) string {
+	return archiveSpecialChars.ReplaceAllString(strings.Join(strings.Fields(text), " "), `\$1`)
+}
+
+func archiveDate(value string) string {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed.Format("2006-01-02 15:04")
+	}
+	if len(value) >= 10 {
+		return value[:10]
+	}
+	return value
+}
+
+var (
+	markdownHeading    = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	markdownListItem   = regexp.MustCompile(`^\s*([-*+]|\d+[.)])\s+(.*)$`)
+	markdownTask       = regexp.MustCompile(`^\[([ xX])\]\s+(.*)$`)
+	markdownEscaped    = regexp.MustCompile("\\\\([\\\\`*_{}\\[\\]()#+\\-.!|<>~])")
+	markdownCodeSpan   = regexp.MustCompile("`([^`]+)`")
+	markdownInlineLink = regexp.MustCompile(`(!?)\[([^\]]*)\]\(([^)\s]+)\)`)
+	markdownAutolink   = regexp.MustCompile(`https?://[^\s<>()\x00]*[^\s<>()\x00.,;:!?'"]`)
+	markdownBold       = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	markdownItalic     = regexp.MustCompile(`\*([^*\s][^*]*)\*|\b_([^_\s][^_]*)_\b`)
+	markdownStrike     = regexp.MustCompile(`~~([^~]+)~~`)
+)
+
+// markdownHTML renders the Markdown of archive pages and of Kaiten texts:
+// headings, paragraphs, lists, task items, quotes, code, links, images and
+// emphasis. Anything else is shown as text.
+func markdownHTML(markdown string) string {
+	var out strings.Builder
+	var paragraph []string
+	list := ""
+	flush := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + strings.Join(paragraph, "<br>\n") + "</p>\n")
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if list != "" {
+			out.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			closeList()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			out.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+		case trimmed == "":
+			flush()
+			closeList()
+		case markdownHeading.MatchString(trimmed):
+			flush()
+			closeList()
+			parts := markdownHeading.FindStringSubmatch(trimmed)
+			level := strconv.Itoa(len(parts[1]))
+			out.WriteString("<h" + level + ">" + markdownInline(parts[2]) + "</h" + level + ">\n")
+		case trimmed == "---" || trimmed == "***":
+			flush()
+			closeList()
+			out.WriteString("<hr>\n")
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			closeList()
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				quote = append(quote, strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">"), " "))
+			}
+			i--
+			out.WriteString("<blockquote>\n" + markdownHTML(strings.Join(quote, "\n")) + "</blockquote>\n")
+		case markdownListItem.MatchString(line):
+			flush()
+			parts := markdownListItem.FindStringSubmatch(line)
+			tag := "ul"
+			if parts[1][0] >= '0' && parts[1][0] <= '9' {
+				tag = "ol"
+			}
+			if list != tag {
+				closeList()
+				list = tag
+				out.WriteString("<" + tag + ">\n")
+			}
+			if task := markdownTask.FindStringSubmatch(parts[2]); task != nil {
+				checked := ""
+				if task[1] != " " {
+					checked = " checked"
+				}
+				out.WriteString(`<li class="task"><input type="checkbox" disabled` + checked + "> " + markdownInline(task[2]) + "</li>\n")
+			} else {
+				out.WriteString("<li>" + markdownInline(parts[2]) + "</li>\n")
+			}
+		default:
+			closeList()
+			paragraph = append(paragraph, markdownInline(trimmed))
+		}
+	}
+	flush()
+	closeList()
+	return out.String()
+}
+
+// markdownInline renders the inline Markdown of one line. Escaped
+// characters, code spans and links, bare ones too, are set aside first, so that nothing
+// inside them is taken for markup.
+func markdownInline(text string) string {
+	var held []string
+	return restoreHeld(renderInline(text, &held), held)
+}
+
+func renderInline(text string, held *[]string) string {
+	hold := func(rendered string) string {
+		*held = append(*held, rendered)
+		return "\x00" + strconv.Itoa(len(*held)-1) + "\x00"
+	}
+	text = markdownEscaped.ReplaceAllStringFunc(text, func(match string) string {
+		return hold(html.EscapeString(match[1:]))
+	})
+	text = markdownCodeSpan.ReplaceAllStringFunc(text, func(match string) string {
+		return hold("<code>" + html.EscapeString(match[1:len(match)-1]) + "</code>")
+	})
+	text = markdownInlineLink.ReplaceAllStringFunc(text, func(match string) string {
+		parts := markdownInlineLink.FindStringSubmatch(match)
+		target := html.EscapeString(parts[3])
+		// Escaped characters are already set aside; the browser sees them.
+		unescaped := html.UnescapeString(restoreHeld(parts[3], *held))
+		if parts[1] == "!" {
+			alt := html.EscapeString(restoreHeld(parts[2], *held))
+			if !safeLinkTarget(unescaped, false) {
+				return hold(alt)
+			}
+			return hold(`<img src="` + target + `" alt="` + alt + `">`)
+		}
+		if !safeLinkTarget(unescaped, true) {
+			return hold(renderInline(parts[2], held))
+		}
+		return hold(`<a href="` + target + `">` + renderInline(parts[2], held) + "</a>")
+	})
+	text = markdownAutolink.ReplaceAllStringFunc(text, func(match string) string {
+		target := html.EscapeString(match)
+		return hold(`<a href="` + target + `">` + target + "</a>")
+	})
+
+	text = html.EscapeString(text)
+	text = markdownBold.ReplaceAllString(text, "<strong>$1$2</strong>")
+	text = markdownItalic.ReplaceAllString(text, "<em>$1$2</em>")
+	return markdownStrike.ReplaceAllString(text, "<del>$1</del>")
+}
+
+// safeLinkTarget reports whether a link from card text may be followed from
+// an archive page: http, https and relative links, and mailto for links but
+// not for images. Anything else, javascript: in particular, is shown as text.
+func safeLinkTarget(target string, link bool) bool {
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "", "http", "https":
+		return true
+	case "mailto":
+		return link
+	}
+	return false
+}
+
+// restoreHeld puts set aside markup back, latest first, as it may contain
+// earlier placeholders.
+func restoreHeld(text string, held []string) string {
+	for i := len(held) - 1; i >= 0; i-- {
+		text = strings.ReplaceAll(text, "\x00"+strconv.Itoa(i)+"\x00", held[i])
+	}
+	return text
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// cachedFile is a source file known to the run. Its content is spooled to
+// the run's temp directory while it is in use. Afterwards only its checksum
+// and the URL of its first uploaded copy are kept, and the next user spools
+// it again from that copy instead of downloading it from the source again.
+type cachedFile struct {
+	key      string
+	sha256   string
+	size     int64
+	mimeType string
+	uploaded string
+
+	path  string
+	refs  int
+	ready chan struct{}
+	err   error
+}
+
+// attachmentCache spools source files to disk while they are being uploaded.
+// Callers of the same file share one download, files with identical content
+// are kept on disk only once, and a spooled file is removed once its last
+// user releases it. Failed downloads are not kept, so a later fetch tries
+// again.
+type attachmentCache struct {
+	source Source
+	sink   Sink
+	dir    string
+
+	mu       sync.Mutex
+	byURL    map[string]*cachedFile
+	byHash   map[string]*cachedFile
+	hashRefs map[string]int
+}
+
+func newAttachmentCache(source Source, sink Sink) (*attachmentCache, error) {
+	dir, err := os.MkdirTemp("", "kaiten-attachments-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create attachment cache directory: %w", err)
+	}
+	return &attachmentCache{
+		source:   source,
+		sink:     sink,
+		dir:      dir,
+		byURL:    make(map[string]*cachedFile),
+		byHash:   make(map[string]*cachedFile),
+		hashRefs: make(map[string]int),
+	}, nil
+}
+
+// Close removes all spooled files.
+func (c *attachmentCache) Close() error {
+	return os.RemoveAll(c.dir)
+}
+
+// fileKey identifies a source file regardless of its query string, which
+// Kaiten uses for signatures that differ between links to the same file.
+func (c *attachmentCache) fileKey(fileURL string) string {
+	if !c.source.IsFileURL(fileURL) {
+		return fileURL
+	}
+	parsed, err := url.Parse(fileURL)
+	if err != nil {
+		return fileURL
+	}
+	parsed.RawQuery = ""
+	parsed.Fragment = ""
+	return parsed.String()
+}
+
+// fetch returns the spooled copy of a source file, spooling it on first use
+// and again after its last user released it. Concurrent callers for the same
+// file wait for a single spool. Every successful fetch must be paired with
+// release.
+func (c *attachmentCache) fetch(fileURL string) (*cachedFile, error) {
+	key := c.fileKey(fileURL)
+
+	c.mu.Lock()
+	file, exists := c.byURL[key]
+	if !exists {
+		file = &cachedFile{key: key}
+		c.byURL[key] = file
+	}
+	spool := file.refs == 0
+	if spool {
+		file.ready = make(chan struct{})
+	}
+	file.refs++
+	uploaded := file.uploaded
+	c.mu.Unlock()
+
+	if !spool {
+		<-file.ready
+		return file, file.err
+	}
+
+	file.err = c.spool(fileURL, uploaded, file)
+	if file.err != nil {
+		c.forget(file)
+	}
+	close(file.ready)
+	return file, file.err
+}
+
+// spool writes the file to disk, from its uploaded copy when there is one
+// and from the source otherwise.
+func (c *attachmentCache) spool(fileURL string, uploaded string, file *cachedFile) error {
+	if uploaded != "" {
+		spooled, err := c.spoolUploaded(uploaded, file.sha256)
+		if err == nil {
+			c.keep(file, spooled)
+			return nil
+		}
+		log.Printf("Error reading uploaded copy of %s, downloading it again: %v", fileURL, err)
+	}
+
+	spooled, err := spoolSourceFile(c.source, fileURL, c.dir)
+	if err != nil {
+		return err
+	}
+	c.keep(file, spooled)
+	return nil
+}
+
+func (c *attachmentCache) spoolUploaded(uploaded string, sha256 string) (*cachedFile, error) {
+	download, err := c.sink.OpenAttachment(uploaded)
+	if err != nil {
+		return nil, err
+	}
+	spooled, err := spoolFile(download, uploaded, c.dir)
+	if err != nil {
+		return nil, err
+	}
+	if spooled.sha256 != sha256 {
+		os.Remove(spooled.path)
+		return nil, fmt.Errorf("checksum mismatch: expected %s, got %s", sha256, spooled.sha256)
+	}
+	return spooled, nil
+}
+
+// forget replaces a file that failed to spool, so that its current users all
+// see the error and the next fetch starts over. What is known about the file
+// is kept, but not its uploaded copy, which may be what failed.
+func (c *attachmentCache) forget(file *cachedFile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.byURL[file.key] != file {
+		return
+	}
+	if file.sha256 == "" {
+		delete(c.byURL, file.key)
+		return
+	}
+	c.byURL[file.key] = &cachedFile{key: file.key, sha256: file.sha256, size: file.size, mimeType: file.mimeType}
+}
+
+// release drops a reference taken by fetch and removes the spooled file once
+// nobody uses it. The file itself stays known for the rest of the run.
+func (c *attachmentCache) release(file *cachedFile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	file.refs--
+	if file.refs > 0 {
+		return
+	}
+	c.hashRefs[file.sha256]--
+	if c.hashRefs[file.sha256] > 0 {
+		return
+	}
+	delete(c.hashRefs, file.sha256)
+	delete(c.byHash, file.sha256)
+	os.Remove(file.path)
+}
+
+// keep records a freshly spooled file, sharing the spool of another file with
+// the same content if one is on disk. The type detected on first download
+// stays, as the uploaded copy may be served as a different one.
+func (c *attachmentCache) keep(file *cachedFile, spooled *cachedFile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	file.sha256 = spooled.sha256
+	file.size = spooled.size
+	if file.mimeType == "" {
+		file.mimeType = spooled.mimeType
+	}
+	c.hashRefs[file.sha256]++
+	if same, exists := c.byHash[file.sha256]; exists {
+		os.Remove(spooled.path)
+		file.path = same.path
+		return
+	}
+	file.path = spooled.path
+	c.byHash[file.sha256] = file
+}
+
+// spoolSourceFile downloads a source file into a new temporary file in dir,
+// hashing it and detecting its type on the way. The caller owns the file.
+func spoolSourceFile(source Source, fileURL string, dir string) (*cachedFile, error) {
+	download, err := source.OpenFile(fileURL)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %w", fileURL, err)
+	}
+	return spoolFile(download, fileURL, dir)
+}
+
+// spoolFile copies an opened file into a new temporary file in dir and
+// closes it.
+func spoolFile(download SourceFile, fileURL string, dir string) (*cachedFile, error) {
+	defer download.Body.Close()
+
+	spool, err := os.CreateTemp(dir, "download-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("error creating spool file: %w", err)
+	}
+	defer spool.Close()
+
+	hash := sha256.New()
+	sniffer := &sniffWriter{}
+	size, err := io.Copy(io.MultiWriter(spool, hash, sniffer), download.Body)
+	if err != nil {
+		os.Remove(spool.Name())
+		return nil, fmt.Errorf("error downloading %s: %w", fileURL, err)
+	}
+	if err := spool.Close(); err != nil {
+		os.Remove(spool.Name())
+		return nil, fmt.Errorf("error writing spool file: %w", err)
+	}
+
+	if length := download.Size; length >= 0 && length != size {
+		os.Remove(spool.Name())
+		return nil, fmt.Errorf("downloaded %d bytes of %s, expected %d", size, fileURL, length)
+	}
+
+	return &cachedFile{
+		path:     spool.Name(),
+		sha256:   hex.EncodeToString(hash.Sum(nil)),
+		size:     size,
+		mimeType: fileMimeType(download.ContentType, sniffer.head),
+	}, nil
+}
+
+// sniffWriter keeps the first bytes of a stream for content type detection.
+type sniffWriter struct {
+	head []byte
+}
+
+func (w *sniffWriter) Write(p []byte) (int, error) {
+	if missing := 512 - len(w.head); missing > 0 {
+		if missing > len(p) {
+			missing = len(p)
+		}
+		w.head = append(w.head, p[:missing]...)
+	}
+	return len(p), nil
+}
+
+func fileMimeType(header string, head []byte) string {
+	if mediaType, _, err := mime.ParseMediaType(header); err == nil && mediaType != "application/octet-stream" {
+		return mediaType
+	}
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	return mediaType
+}
+
+// upload uploads a spooled file to the card as the given type and checks
+// that the sink stored it intact. With checksum set the upload is read back
+// and compared by SHA-256. A failed check still returns the created
+// attachment. The first intact upload of a file is where it is spooled from
+// once it is needed again.
+func (c *attachmentCache) upload(cardId string, file *cachedFile, name string, mimeType string, authorEmail string, checksum bool) (PlankaAttachment, error) {
+	content, err := os.Open(file.path)
+	if err != nil {
+		return PlankaAttachment{}, fmt.Errorf("error opening spooled file: %w", err)
+	}
+	defer content.Close()
+
+	created, err := c.sink.UploadAttachment(cardId, content, name, mimeType, authorEmail)
+	if err != nil {
+		return PlankaAttachment{}, err
+	}
+	if err := verifyPlankaAttachment(c.sink, created, file, mimeType, checksum); err != nil {
+		return created, fmt.Errorf("attachment %s failed verification: %w", name, err)
+	}
+
+	c.mu.Lock()
+	if file.uploaded == "" {
+		file.uploaded = created.URL
+	}
+	c.mu.Unlock()
+	return created, nil
+}
+
+func verifyPlankaAttachment(sink Sink, created PlankaAttachment, file *cachedFile, mimeType string, checksum bool) error {
+	if created.Size != 0 && created.Size != file.size {
+		return fmt.Errorf("size mismatch: uploaded %d bytes, PLANKA stored %d", file.size, created.Size)
+	}
+	if created.MimeType != "" && mimeType != "" {
+		if mediaType, _, err := mime.ParseMediaType(created.MimeType); err == nil && mediaType != mimeType {
+			return fmt.Errorf("MIME type mismatch: uploaded %s, PLANKA stored %s", mimeType, mediaType)
+		}
+	}
+	if !checksum {
+		return nil
+	}
+
+	stored, err := attachmentChecksum(sink, created.URL)
+	if err != nil {
+		return fmt.Errorf("error reading attachment back: %w", err)
+	}
+	if stored != file.sha256 {
+		return fmt.Errorf("checksum mismatch: uploaded %s, PLANKA stored %s", file.sha256, stored)
+	}
+	log.Printf("Verified attachment %s (%d bytes, sha256 %s)", created.ID, file.size, stored)
+	return nil
+}
+
+// attachmentChecksum reads an attachment back from the sink and returns its
+// SHA-256 without keeping the content in memory.
+func attachmentChecksum(sink Sink, attachmentURL string) (string, error) {
+	stored, err := sink.OpenAttachment(attachmentURL)
+	if err != nil {
+		return "", err
+	}
+	defer stored.Body.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, stored.Body); err != nil {
+		return "", fmt.Errorf("failed to read attachment: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// uploadAttachment uploads a Kaiten file on behalf of its original uploader,
+// with the MIME type Kaiten recorded for it. PLANKA sets the upload time
+// itself, so the Kaiten one goes into attachmentsComment. An attachment that
+// was created but failed verification is returned with the error.
+func (m *migration) uploadAttachment(cardId string, attachment KaitenAttachment) (string, error) {
+	file, err := m.files.fetch(attachment.URL)
+	if err != nil {
+		return "", fmt.Errorf("error downloading attachment %s: %w", attachment.Name, err)
+	}
+	defer m.files.release(file)
+	if attachment.Size > 0 && int64(attachment.Size) != file.size {
+		return "", fmt.Errorf("attachment %s has %d bytes, Kaiten reports %d", attachment.Name, file.size, int64(attachment.Size))
+	}
+
+	mimeType := file.mimeType
+	if mediaType, _, err := mime.ParseMediaType(attachment.MimeType); err == nil && mediaType != "application/octet-stream" {
+		mimeType = mediaType
+	}
+	author, _ := m.inactive.author(attachment.AuthorEmail)
+	created, err := m.files.upload(cardId, file, attachment.Name, mimeType, author, m.config.verifyChecksums)
+	if err != nil && created.ID == "" && author != "" {
+		log.Printf("Uploading %s as %s failed, uploading as administrator: %v", attachment.Name, author, err)
+		created, err = m.files.upload(cardId, file, attachment.Name, mimeType, "", m.config.verifyChecksums)
+	}
+	if err != nil {
+		return created.ID, err
+	}
+	log.Printf("Attachment %s uploaded to card %s\n", attachment.Name, cardId)
+	return created.ID, nil
+}
+
+// processCardAttachments uploads the card's files, makes the Kaiten cover
+// image the PLANKA card cover and lists who uploaded what and when in a
+// comment.
+func (m *migration) processCardAttachments(cardId string, attachments []KaitenAttachment) {
+	wg := &sync.WaitGroup{}
+	var coverMu sync.Mutex
+	coverId := ""
+
+	wg.Add(len(attachments))
+	for _, attachment := range attachments {
+		go func(attachment KaitenAttachment) {
+			defer wg.Done()
+			attachmentId, err := m.uploadAttachment(cardId, attachment)
+			if err != nil {
+				log.Printf("Error creating Planka attachment for card %s: %v", cardId, err)
+			}
+			if attachment.Cover && attachmentId != "" {
+				coverMu.Lock()
+				coverId = attachmentId
+				coverMu.Unlock()
+			}
+		}(attachment)
+	}
+	wg.Wait()
+
+	if coverId != "" {
+		if err := m.sink.UpdateCard(cardId, map[string]any{"coverAttachmentId": coverId}); err != nil {
+			log.Printf("Error setting cover for card %s: %v", cardId, err)
+		}
+	}
+	if text := attachmentsComment(attachments); text != "" {
+		if _, err := m.sink.CreateComment(cardId, KaitenComment{Text: text}); err != nil {
+			log.Printf("Error creating attachments comment for card %s: %v", cardId, err)
+		}
+	}
+}
+
+// attachmentsComment lists the uploader and upload time of the attachments
+// that have one.
+func attachmentsComment(attachments []KaitenAttachment) string {
+	var text strings.Builder
+	for _, attachment := range attachments {
+		if attachment.CreatedAt == "" {
+			continue
+		}
+		if text.Len() == 0 {
+			text.WriteString("## Вложения\n\n| Файл | Загрузил | Дата |\n|---|---|---|\n")
+		}
+		author := attachment.AuthorName
+		if author == "" {
+			author = attachment.AuthorEmail
+		}
+		fmt.Fprintf(&text, "| %s | %s | %s |\n", strings.ReplaceAll(attachment.Name, "|", "\\|"), author, archiveDate(attachment.CreatedAt))
+	}
+	return text.String()
+}
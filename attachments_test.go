@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+// countingSource counts how often each file is downloaded.
+type countingSource struct {
+	*memSource
+	mu     sync.Mutex
+	opened map[string]int
+}
+
+func (s *countingSource) OpenFile(fileURL string) (SourceFile, error) {
+	s.mu.Lock()
+	s.opened[fileURL]++
+	s.mu.Unlock()
+	return s.memSource.OpenFile(fileURL)
+}
+
+func TestAttachmentCacheDownloadsOnce(t *testing.T) {
+	const fileURL = "https://kaiten.example/files/report.pdf"
+
+	for _, test := range []struct {
+		name      string
+		upload    bool
+		unstored  bool
+		downloads int
+	}{
+		{"reuses the uploaded copy", true, false, 1},
+		{"downloads again without an uploaded copy", false, false, 3},
+		{"downloads again when the copy is unreadable", true, true, 3},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			source := &countingSource{
+				memSource: &memSource{files: map[string]string{fileURL: "%PDF-1.4 report"}},
+				opened:    make(map[string]int),
+			}
+			sink := newRecordingSink()
+			if test.unstored {
+				sink.attachmentErr = fmt.Errorf("not stored")
+			}
+			files, err := newAttachmentCache(source, sink)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer files.Close()
+
+			for i := 0; i < 3; i++ {
+				file, err := files.fetch(fileURL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if file.mimeType != "application/pdf" {
+					t.Errorf("MIME type = %q, want application/pdf", file.mimeType)
+				}
+				if test.upload {
+					if _, err := files.upload(fmt.Sprintf("card:%d", i), file, "report.pdf", file.mimeType, "", false); err != nil {
+						t.Fatal(err)
+					}
+				}
+				files.release(file)
+				if _, err := os.Stat(file.path); !os.IsNotExist(err) {
+					t.Errorf("spooled file %s kept after release", file.path)
+				}
+			}
+
+			if n := source.opened[fileURL]; n != test.downloads {
+				t.Errorf("downloaded %d times, want %d", n, test.downloads)
+			}
+			if test.upload && sink.count("UploadAttachment card:2 report.pdf application/pdf %PDF-1.4 report") != 1 {
+				t.Errorf("calls = %q", sink.calls)
+			}
+		})
+	}
+}
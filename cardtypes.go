@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+const defaultCardTypeRules = "*=label"
+
+// cardTypeRule says how a Kaiten card type is expressed in PLANKA: as the
+// PLANKA card type, as a board label, or both.
+type cardTypeRule struct {
+	PlankaType string
+	Label      bool
+}
+
+// cardTypeRules maps lower-cased Kaiten card type names to rules; the "*" key
+// holds the rule for types that are not listed.
+type cardTypeRules map[string]cardTypeRule
+
+// parseCardTypeRules parses rules like "Баг=story+label,Фича=project,*=label".
+func parseCardTypeRules(spec string) (cardTypeRules, error) {
+	rules := cardTypeRules{"*": {PlankaType: "project"}}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, targets, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("card type rule %q has no target", entry)
+		}
+		rule := cardTypeRule{PlankaType: "project"}
+		for _, target := range strings.Split(targets, "+") {
+			switch strings.TrimSpace(target) {
+			case "project", "story":
+				rule.PlankaType = strings.TrimSpace(target)
+			case "label":
+				rule.Label = true
+			default:
+				return nil, fmt.Errorf("card type rule %q has unknown target %q", entry, target)
+			}
+		}
+		rules[strings.ToLower(strings.TrimSpace(name))] = rule
+	}
+	return rules, nil
+}
+
+func (r cardTypeRules) rule(cardType KaitenCardType) cardTypeRule {
+	if cardType.Name != "" {
+		if rule, ok := r[strings.ToLower(cardType.Name)]; ok {
+			return rule
+		}
+	}
+	return r["*"]
+}
+
+func (m *migration) processCardType(card KaitenCard, cardId string, boardId string) {
+	if card.Type.Name == "" || !m.config.cardTypes.rule(card.Type).Label {
+		return
+	}
+
+	label, err := m.labels.ensure(boardId, labelKindCardType, m.labels.tagLabel(KaitenTag{Name: card.Type.Name, Color: card.Type.Color, ColorHex: card.Type.ColorHex}))
+	if err != nil {
+		log.Printf("Error creating label for card type %s: %v", card.Type.Name, err)
+		return
+	}
+
+	if err := m.sink.AddCardLabel(cardId, label.Id); err != nil {
+		log.Printf("Error setting card type label for card %s: %v", cardId, err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestCardTypeRules(t *testing.T) {
+	rules, err := parseCardTypeRules("Баг=story+label, Фича=project, *=label")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name string
+		want cardTypeRule
+	}{
+		{"Баг", cardTypeRule{PlankaType: "story", Label: true}},
+		{"баг", cardTypeRule{PlankaType: "story", Label: true}},
+		{"Фича", cardTypeRule{PlankaType: "project"}},
+		{"Задача", cardTypeRule{PlankaType: "project", Label: true}},
+		{"", cardTypeRule{PlankaType: "project", Label: true}},
+	} {
+		if got := rules.rule(KaitenCardType{Name: test.name}); got != test.want {
+			t.Errorf("rule(%q) = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+
+	defaults, err := parseCardTypeRules("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := defaults.rule(KaitenCardType{Name: "Баг"}); got != (cardTypeRule{PlankaType: "project"}) {
+		t.Errorf("rule without rules = %+v", got)
+	}
+
+	for _, spec := range []string{"Баг", "Баг=epic", "Баг=story+tag"} {
+		if _, err := parseCardTypeRules(spec); err == nil {
+			t.Errorf("%q was accepted", spec)
+		}
+	}
+}
+
+func TestProcessCardTypeAddsLabel(t *testing.T) {
+	rules, err := parseCardTypeRules("Баг=story+label,Фича=project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := newRecordingSink()
+	m := &migration{
+		sink:   sink,
+		labels: newLabelRegistry(sink, &mappingStore{Entries: make(map[string]map[string]string)}, nil),
+		config: migrationConfig{cardTypes: rules},
+	}
+
+	m.processCardType(KaitenCard{Type: KaitenCardType{Name: "Баг", Color: 2}}, "card:1", "board")
+	m.processCardType(KaitenCard{Type: KaitenCardType{Name: "Баг", Color: 2}}, "card:2", "board")
+	m.processCardType(KaitenCard{Type: KaitenCardType{Name: "Фича"}}, "card:3", "board")
+	m.processCardType(KaitenCard{}, "card:4", "board")
+
+	if n := sink.count("CreateLabel board Баг "); n != 1 {
+		t.Errorf("card type label created %d times, want once", n)
+	}
+	for _, call := range []string{"AddCardLabel card:1 label:Баг", "AddCardLabel card:2 label:Баг"} {
+		if !sink.has(call) {
+			t.Errorf("missing call %q", call)
+		}
+	}
+	if sink.count("AddCardLabel card:3 ")+sink.count("AddCardLabel card:4 ") != 0 {
+		t.Error("card types without a label rule got labels")
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const defaultPlankaColor = "muddy-grey"
+
+type paletteColor struct {
+	name string
+	hex  string
+}
+
+// plankaPalette lists every PLANKA label colour with its hex value.
+var plankaPalette = []paletteColor{
+	{"muddy-grey", "#4b4a47"},
+	{"autumn-leafs", "#9b7e4e"},
+	{"morning-sky", "#52bad5"},
+	{"antique-blue", "#6c99bb"},
+	{"egg-yellow", "#f7d036"},
+	{"desert-sand", "#edcb76"},
+	{"dark-granite", "#8b8680"},
+	{"fresh-salad", "#8bc34a"},
+	{"lagoon-blue", "#109dc0"},
+	{"midnight-blue", "#004d73"},
+	{"light-orange", "#ffc66d"},
+	{"pumpkin-orange", "#f0982d"},
+	{"light-concrete", "#afb0a4"},
+	{"sunny-grass", "#bfca02"},
+	{"navy-blue", "#166a8f"},
+	{"lilac-eyes", "#b89ad8"},
+	{"apricot-red", "#fd8a7a"},
+	{"orange-peel", "#fab623"},
+	{"silver-glint", "#c4c9cc"},
+	{"bright-moss", "#a5c261"},
+	{"deep-ocean", "#0b6ea8"},
+	{"summer-sky", "#3ab1e6"},
+	{"berry-red", "#e04556"},
+	{"light-cocoa", "#87564a"},
+	{"grey-stone", "#6f7378"},
+	{"tank-green", "#8aa177"},
+	{"coral-green", "#2b6a6c"},
+	{"sugar-plum", "#9b4f9c"},
+	{"pink-tulip", "#f97394"},
+	{"shady-rust", "#a16246"},
+	{"wet-rock", "#9da4ad"},
+	{"wet-moss", "#4a8753"},
+	{"turquoise-sea", "#26c0b1"},
+	{"lavender-fields", "#9d6fd1"},
+	{"piggy-red", "#f0627d"},
+	{"light-mud", "#c7a57b"},
+	{"gun-metal", "#355263"},
+	{"modern-green", "#44af4b"},
+	{"french-coast", "#4b79d3"},
+	{"sweet-lilac", "#e6a5d4"},
+	{"red-burgundy", "#ad5f7d"},
+	{"pirate-gold", "#b69e3d"},
+}
+
+// kaitenPalette maps Kaiten colour indexes to their hex values.
+var kaitenPalette = map[int]string{
+	1:  "#f44336",
+	2:  "#e91e63",
+	3:  "#9c27b0",
+	4:  "#673ab7",
+	5:  "#3f51b5",
+	6:  "#2196f3",
+	7:  "#03a9f4",
+	8:  "#00bcd4",
+	9:  "#009688",
+	10: "#4caf50",
+	11: "#8bc34a",
+	12: "#cddc39",
+	13: "#ffeb3b",
+	14: "#ffc107",
+	15: "#ff9800",
+	16: "#ff5722",
+	17: "#795548",
+	18: "#9e9e9e",
+	19: "#607d8b",
+	20: "#000000",
+	21: "#d7ccc8",
+	22: "#b2dfdb",
+	23: "#f8bbd0",
+	24: "#c5cae9",
+}
+
+// kaitenIndexHex returns the hex value of a Kaiten colour index, or false
+// when the index is not in kaitenPalette.
+func kaitenIndexHex(index float64) (string, bool) {
+	i := int(index)
+	if index != float64(i) {
+		return "", false
+	}
+	hex, ok := kaitenPalette[i]
+	return hex, ok
+}
+
+// parseColorOverrides parses overrides like "3=berry-red,#ff8800=pumpkin-orange".
+func parseColorOverrides(spec string) (map[string]string, error) {
+	overrides := make(map[string]string)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		source, target, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("colour override %q has no target", entry)
+		}
+		target = strings.TrimSpace(target)
+		if !isPlankaColor(target) {
+			return nil, fmt.Errorf("colour override %q uses unknown PLANKA colour %q", entry, target)
+		}
+		source = strings.ToLower(strings.TrimSpace(source))
+		if index, err := strconv.Atoi(source); err == nil {
+			source = strconv.Itoa(index)
+		} else if !strings.HasPrefix(source, "#") {
+			source = "#" + source
+		}
+		overrides[source] = target
+	}
+	return overrides, nil
+}
+
+// plankaLabelColor picks the PLANKA colour for a Kaiten colour given as a
+// palette index or a hex value: indexes are looked up in kaitenPalette, and
+// the hex value gets the nearest PLANKA colour. It never fails: unknown
+// colours get the default PLANKA colour. overrides maps Kaiten colour indexes
+// or hex values to PLANKA colours and takes precedence over the match.
+func plankaLabelColor(index float64, hex string, overrides map[string]string) string {
+	hex = strings.ToLower(strings.TrimSpace(hex))
+	if hex == "" {
+		if target, ok := overrides[strconv.Itoa(int(index))]; ok {
+			return target
+		}
+		var ok bool
+		if hex, ok = kaitenIndexHex(index); !ok {
+			log.Printf("Unknown Kaiten colour index %v, using %s", index, defaultPlankaColor)
+			return defaultPlankaColor
+		}
+	} else if !strings.HasPrefix(hex, "#") {
+		hex = "#" + hex
+	}
+
+	if target, ok := overrides[hex]; ok {
+		return target
+	}
+	return nearestPlankaColor(hex)
+}
+
+func nearestPlankaColor(hex string) string {
+	target, ok := hexToLab(hex)
+	if !ok {
+		return defaultPlankaColor
+	}
+
+	best := defaultPlankaColor
+	bestDistance := math.Inf(1)
+	for _, color := range plankaPalette {
+		lab, _ := hexToLab(color.hex)
+		distance := math.Sqrt(sq(lab[0]-target[0]) + sq(lab[1]-target[1]) + sq(lab[2]-target[2]))
+		if distance < bestDistance {
+			best = color.name
+			bestDistance = distance
+		}
+	}
+	return best
+}
+
+func isPlankaColor(name string) bool {
+	for _, color := range plankaPalette {
+		if color.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hexToLab converts "#rrggbb" or "#rgb" to CIELAB (D65), where euclidean
+// distance follows perceived colour difference.
+func hexToLab(hex string) ([3]float64, bool) {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return [3]float64{}, false
+	}
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return [3]float64{}, false
+	}
+
+	linear := func(channel uint64) float64 {
+		c := float64(channel) / 255
+		if c <= 0.04045 {
+			return c / 12.92
+		}
+		return math.Pow((c+0.055)/1.055, 2.4)
+	}
+	r, g, b := linear(value>>16&0xff), linear(value>>8&0xff), linear(value&0xff)
+
+	x := (0.4124*r + 0.3576*g + 0.1805*b) / 0.95047
+	y := 0.2126*r + 0.7152*g + 0.0722*b
+	z := (0.0193*r + 0.1192*g + 0.9505*b) / 1.08883
+
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return [3]float64{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}, true
+}
+
+func sq(v float64) float64 {
+	return v * v
+}
+
+// kaitenColor splits a raw Kaiten colour, which is either a palette index or
+// a hex string, into the KaitenTag/KaitenCardType colour fields.
+func kaitenColor(value any) (float64, string) {
+	switch v := value.(type) {
+	case float64:
+		return v, ""
+	case string:
+		if index, err := strconv.Atoi(v); err == nil {
+			return float64(index), ""
+		}
+		return 0, v
+	}
+	return 0, ""
+}
@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+func TestPlankaLabelColor(t *testing.T) {
+	overrides, err := parseColorOverrides("3=berry-red, 07=egg-yellow, FF8800=pumpkin-orange, #2196F3=navy-blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name  string
+		index float64
+		hex   string
+		want  string
+	}{
+		{"red index", 1, "", "berry-red"},
+		{"green index", 10, "", "modern-green"},
+		{"brown index", 17, "", "light-cocoa"},
+		{"black index", 20, "", "muddy-grey"},
+		{"unknown index", 99, "", defaultPlankaColor},
+		{"fractional index", 1.5, "", defaultPlankaColor},
+		{"exact hex", 0, "#109dc0", "lagoon-blue"},
+		{"hex without hash", 0, "F7D036", "egg-yellow"},
+		{"short hex", 0, "#fff", "silver-glint"},
+		{"bad hex", 0, "#zzzzzz", defaultPlankaColor},
+		{"index override", 3, "", "berry-red"},
+		{"padded index override", 7, "", "egg-yellow"},
+		{"hex override", 0, "#ff8800", "pumpkin-orange"},
+		{"index through hex override", 6, "", "navy-blue"},
+	} {
+		if got := plankaLabelColor(test.index, test.hex, overrides); got != test.want {
+			t.Errorf("%s: plankaLabelColor(%v, %q) = %q, want %q", test.name, test.index, test.hex, got, test.want)
+		}
+	}
+}
+
+func TestKaitenPaletteIndexesAreDistinct(t *testing.T) {
+	seen := make(map[string]int)
+	for index, hex := range kaitenPalette {
+		if other, ok := seen[hex]; ok {
+			t.Errorf("indexes %d and %d are both %s", other, index, hex)
+		}
+		seen[hex] = index
+		if color := nearestPlankaColor(hex); !isPlankaColor(color) {
+			t.Errorf("index %d maps to %q", index, color)
+		}
+	}
+}
+
+func TestParseColorOverridesRejectsBadEntries(t *testing.T) {
+	for _, spec := range []string{"3", "3=rainbow", "#ff0000="} {
+		if _, err := parseColorOverrides(spec); err == nil {
+			t.Errorf("%q was accepted", spec)
+		}
+	}
+}
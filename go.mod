@@ -1,4 +1,4 @@
-module main
+module github.com/lapinuelle/kaiten-planka-migrator
 
 go 1.25.0
 
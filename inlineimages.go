@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const maxInlineImageUploads = 4
+
+var markdownImagePattern = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+
+// inlineImages re-hosts images embedded in card and comment text: Kaiten
+// image URLs are downloaded and uploaded as attachments of the same card, and
+// the text is pointed at the PLANKA copies. Each image is uploaded once per
+// card; concurrent callers of the same image wait for the one uploading it,
+// while different images upload in parallel.
+type inlineImages struct {
+	mu       sync.Mutex
+	source   Source
+	sink     Sink
+	files    *attachmentCache
+	checksum bool
+	uploaded map[inlineImageKey]*inlineImageUpload
+}
+
+type inlineImageKey struct {
+	cardId   string
+	imageURL string
+}
+
+type inlineImageUpload struct {
+	url   string
+	err   error
+	ready chan struct{}
+}
+
+func newInlineImages(source Source, sink Sink, files *attachmentCache, checksum bool) *inlineImages {
+	return &inlineImages{source: source, sink: sink, files: files, checksum: checksum, uploaded: make(map[inlineImageKey]*inlineImageUpload)}
+}
+
+// rewrite returns Markdown text with Kaiten image URLs replaced by PLANKA
+// attachment URLs of the card. The images of the text upload concurrently, at
+// most maxInlineImageUploads at a time. Images that fail to re-host keep
+// their URL.
+func (i *inlineImages) rewrite(cardId string, text string) string {
+	imageURLs := make(map[string]struct{})
+	for _, parts := range markdownImagePattern.FindAllStringSubmatch(text, -1) {
+		if imageURL := parts[2]; i.source.IsFileURL(imageURL) {
+			imageURLs[imageURL] = struct{}{}
+		}
+	}
+	if len(imageURLs) == 0 {
+		return text
+	}
+
+	plankaImageURLs := make(map[string]string, len(imageURLs))
+
+	var mu sync.Mutex
+	wg := &sync.WaitGroup{}
+	semaphore := make(chan struct{}, maxInlineImageUploads)
+	wg.Add(len(imageURLs))
+	for imageURL := range imageURLs {
+		go func(imageURL string) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			plankaImageURL, err := i.upload(cardId, imageURL)
+			if err != nil {
+				log.Printf("Error re-hosting image %s for card %s: %v", imageURL, cardId, err)
+				return
+			}
+			mu.Lock()
+			plankaImageURLs[imageURL] = plankaImageURL
+			mu.Unlock()
+		}(imageURL)
+	}
+	wg.Wait()
+
+	return markdownImagePattern.ReplaceAllStringFunc(text, func(match string) string {
+		parts := markdownImagePattern.FindStringSubmatch(match)
+		plankaImageURL := plankaImageURLs[parts[2]]
+		if plankaImageURL == "" {
+			return match
+		}
+		return "![" + parts[1] + "](" + plankaImageURL + ")"
+	})
+}
+
+// upload returns the PLANKA URL of the image on the card, uploading it on
+// first use. Failures are not kept, so a later call tries again.
+func (i *inlineImages) upload(cardId string, imageURL string) (string, error) {
+	key := inlineImageKey{cardId: cardId, imageURL: imageURL}
+	i.mu.Lock()
+	upload, exists := i.uploaded[key]
+	if !exists {
+		upload = &inlineImageUpload{ready: make(chan struct{})}
+		i.uploaded[key] = upload
+	}
+	i.mu.Unlock()
+
+	if exists {
+		<-upload.ready
+		return upload.url, upload.err
+	}
+
+	upload.url, upload.err = i.uploadFile(cardId, imageURL)
+	if upload.err != nil {
+		i.mu.Lock()
+		delete(i.uploaded, key)
+		i.mu.Unlock()
+	}
+	close(upload.ready)
+	return upload.url, upload.err
+}
+
+func (i *inlineImages) uploadFile(cardId string, imageURL string) (string, error) {
+	file, err := i.files.fetch(imageURL)
+	if err != nil {
+		return "", fmt.Errorf("error downloading image: %w", err)
+	}
+	defer i.files.release(file)
+
+	attachment, err := i.files.upload(cardId, file, inlineImageName(imageURL), file.mimeType, "", i.checksum)
+	if err != nil {
+		return "", err
+	}
+	return attachment.URL, nil
+}
+
+func inlineImageName(imageURL string) string {
+	parsed, err := url.Parse(imageURL)
+	if err != nil {
+		return "image"
+	}
+	name, err := url.PathUnescape(path.Base(parsed.Path))
+	if err != nil || name == "" || name == "/" || name == "." {
+		return "image"
+	}
+	return strings.TrimSpace(name)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInlineImagesRewrite(t *testing.T) {
+	source := &memSource{files: map[string]string{
+		"https://kaiten.example/files/a.png":      "A",
+		"https://kaiten.example/files/b%20c.png":  "B",
+		"https://kaiten.example/files/other.jpeg": "C",
+	}}
+
+	for _, test := range []struct {
+		name    string
+		text    string
+		want    string
+		uploads int
+	}{
+		{"no images", "Просто текст", "Просто текст", 0},
+		{
+			"external image",
+			"![logo](https://example.com/logo.png)",
+			"![logo](https://example.com/logo.png)",
+			0,
+		},
+		{
+			"kaiten image",
+			"До ![схема](https://kaiten.example/files/a.png) после",
+			"До ![схема](https://planka.example/attachments/a.png) после",
+			1,
+		},
+		{
+			"escaped name",
+			"![](https://kaiten.example/files/b%20c.png)",
+			"![](https://planka.example/attachments/b c.png)",
+			1,
+		},
+		{
+			"same image twice",
+			"![1](https://kaiten.example/files/a.png) ![2](https://kaiten.example/files/a.png) ![3](https://kaiten.example/files/other.jpeg)",
+			"![1](https://planka.example/attachments/a.png) ![2](https://planka.example/attachments/a.png) ![3](https://planka.example/attachments/other.jpeg)",
+			2,
+		},
+		{
+			"missing file",
+			"![x](https://kaiten.example/files/gone.png) ![a](https://kaiten.example/files/a.png)",
+			"![x](https://kaiten.example/files/gone.png) ![a](https://planka.example/attachments/a.png)",
+			1,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sink := newRecordingSink()
+			files, err := newAttachmentCache(source, sink)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer files.Close()
+
+			images := newInlineImages(source, sink, files, false)
+			if got := images.rewrite("card", test.text); got != test.want {
+				t.Errorf("rewrite = %q, want %q", got, test.want)
+			}
+			if n := sink.count("UploadAttachment card "); n != test.uploads {
+				t.Errorf("%d uploads, want %d", n, test.uploads)
+			}
+		})
+	}
+}
+
+// gatedSource holds every OpenFile call until want calls are in flight.
+type gatedSource struct {
+	*memSource
+	want    int
+	mu      sync.Mutex
+	waiting int
+	open    chan struct{}
+}
+
+func (s *gatedSource) OpenFile(fileURL string) (SourceFile, error) {
+	s.mu.Lock()
+	s.waiting++
+	if s.waiting == s.want {
+		close(s.open)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-s.open:
+		return s.memSource.OpenFile(fileURL)
+	case <-time.After(5 * time.Second):
+		return SourceFile{}, fmt.Errorf("%s was opened alone", fileURL)
+	}
+}
+
+func TestInlineImagesUploadConcurrently(t *testing.T) {
+	source := &gatedSource{
+		memSource: &memSource{files: map[string]string{
+			"https://kaiten.example/files/a.png": "A",
+			"https://kaiten.example/files/b.png": "B",
+		}},
+		want: 2,
+		open: make(chan struct{}),
+	}
+	sink := newRecordingSink()
+	files, err := newAttachmentCache(source, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer files.Close()
+
+	images := newInlineImages(source, sink, files, false)
+	got := images.rewrite("card", "![](https://kaiten.example/files/a.png) ![](https://kaiten.example/files/b.png)")
+	if want := "![](https://planka.example/attachments/a.png) ![](https://planka.example/attachments/b.png)"; got != want {
+		t.Errorf("rewrite = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,544 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jiraText converts a Jira description or comment to Markdown. Jira Cloud's
+// v3 API returns Atlassian Document Format, CSV exports and the v2 API return
+// wiki markup.
+func jiraText(value any) string {
+	switch value := value.(type) {
+	case string:
+		return jiraWikiMarkdown(value)
+	case map[string]any:
+		return strings.TrimSpace(adfBlocks(adfChildren(value), "\n\n"))
+	}
+	return ""
+}
+
+func adfChildren(node map[string]any) []map[string]any {
+	content, _ := node["content"].([]any)
+	var children []map[string]any
+	for _, child := range content {
+		if child, ok := child.(map[string]any); ok {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+func adfAttr(node map[string]any, name string) string {
+	attrs, _ := node["attrs"].(map[string]any)
+	switch value := attrs[name].(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return ""
+}
+
+// adfBlocks renders block nodes, skipping the ones that render to nothing.
+func adfBlocks(nodes []map[string]any, separator string) string {
+	var blocks []string
+	for _, node := range nodes {
+		if block := adfBlock(node); strings.TrimSpace(block) != "" {
+			blocks = append(blocks, block)
+		}
+	}
+	return strings.Join(blocks, separator)
+}
+
+func adfBlock(node map[string]any) string {
+	children := adfChildren(node)
+	switch node["type"] {
+	case "paragraph":
+		return adfInline(children)
+	case "heading":
+		level, _ := strconv.Atoi(adfAttr(node, "level"))
+		if level < 1 || level > 6 {
+			level = 1
+		}
+		return strings.Repeat("#", level) + " " + adfInline(children)
+	case "bulletList", "orderedList", "taskList", "decisionList":
+		return adfList(node)
+	case "codeBlock":
+		return "```" + adfAttr(node, "language") + "\n" + adfPlainText(children) + "\n```"
+	case "blockquote", "panel":
+		return quoteMarkdown(adfBlocks(children, "\n\n"))
+	case "rule":
+		return "---"
+	case "table":
+		var rows [][]string
+		for _, row := range children {
+			var cells []string
+			for _, cell := range adfChildren(row) {
+				cells = append(cells, adfBlocks(adfChildren(cell), " "))
+			}
+			rows = append(rows, cells)
+		}
+		return tableMarkdown(rows)
+	case "mediaSingle", "mediaGroup", "media":
+		// Files are carried over as attachments.
+		return ""
+	}
+	if len(children) > 0 {
+		return adfBlocks(children, "\n\n")
+	}
+	return adfInline([]map[string]any{node})
+}
+
+func adfList(node map[string]any) string {
+	start, err := strconv.Atoi(adfAttr(node, "order"))
+	if err != nil {
+		start = 1
+	}
+	var items []string
+	for i, item := range adfChildren(node) {
+		var marker, body string
+		switch node["type"] {
+		case "orderedList":
+			marker = strconv.Itoa(start+i) + ". "
+		case "taskList", "decisionList":
+			marker = "- [ ] "
+			if state := adfAttr(item, "state"); state == "DONE" || state == "DECIDED" {
+				marker = "- [x] "
+			}
+		default:
+			marker = "- "
+		}
+		if item["type"] == "listItem" {
+			body = adfBlocks(adfChildren(item), "\n")
+		} else {
+			body = adfInline(adfChildren(item))
+		}
+		items = append(items, marker+indentMarkdown(body, len(marker)))
+	}
+	return strings.Join(items, "\n")
+}
+
+func adfInline(nodes []map[string]any) string {
+	var text strings.Builder
+	for _, node := range nodes {
+		switch node["type"] {
+		case "text":
+			value, _ := node["text"].(string)
+			text.WriteString(adfMarks(node, value))
+		case "hardBreak":
+			text.WriteString("\n")
+		case "mention", "status":
+			text.WriteString(adfAttr(node, "text"))
+		case "emoji":
+			if value := adfAttr(node, "text"); value != "" {
+				text.WriteString(value)
+			} else {
+				text.WriteString(adfAttr(node, "shortName"))
+			}
+		case "inlineCard", "blockCard", "embedCard":
+			text.WriteString(adfAttr(node, "url"))
+		case "date":
+			if ms, err := strconv.ParseInt(adfAttr(node, "timestamp"), 10, 64); err == nil {
+				text.WriteString(time.UnixMilli(ms).UTC().Format("2006-01-02"))
+			}
+		default:
+			text.WriteString(adfInline(adfChildren(node)))
+		}
+	}
+	return text.String()
+}
+
+// adfMarks applies the text's formatting marks. Code goes first so that
+// emphasis and links wrap it, as Markdown expects.
+func adfMarks(node map[string]any, text string) string {
+	marks, _ := node["marks"].([]any)
+	var href string
+	wrappers := map[string]string{}
+	for _, mark := range marks {
+		mark, ok := mark.(map[string]any)
+		if !ok {
+			continue
+		}
+		switch kind, _ := mark["type"].(string); kind {
+		case "code":
+			wrappers["code"] = "`"
+		case "strong":
+			wrappers["strong"] = "**"
+		case "em":
+			wrappers["em"] = "_"
+		case "strike":
+			wrappers["strike"] = "~~"
+		case "link":
+			href = adfAttr(mark, "href")
+		}
+	}
+	for _, kind := range []string{"code", "em", "strong", "strike"} {
+		if wrapper, ok := wrappers[kind]; ok {
+			text = wrapMarkdown(text, wrapper)
+		}
+	}
+	if href != "" && text != href {
+		return "[" + text + "](" + href + ")"
+	}
+	return text
+}
+
+// wrapMarkdown puts a Markdown marker around text, keeping surrounding
+// spaces outside of it, where Markdown would not recognise the marker.
+func wrapMarkdown(text string, marker string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	start := strings.Index(text, trimmed)
+	return text[:start] + marker + trimmed + marker + text[start+len(trimmed):]
+}
+
+func adfPlainText(nodes []map[string]any) string {
+	var text strings.Builder
+	for _, node := range nodes {
+		if value, ok := node["text"].(string); ok {
+			text.WriteString(value)
+		} else if node["type"] == "hardBreak" {
+			text.WriteString("\n")
+		}
+		text.WriteString(adfPlainText(adfChildren(node)))
+	}
+	return text.String()
+}
+
+func quoteMarkdown(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("> "+line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// indentMarkdown indents every line but the first, so that the text stays
+// inside a list item.
+func indentMarkdown(text string, width int) string {
+	lines := strings.Split(text, "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = strings.Repeat(" ", width) + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// tableMarkdown renders rows as a Markdown table with the first row as its
+// header.
+func tableMarkdown(rows [][]string) string {
+	var lines []string
+	for i, row := range rows {
+		cells := make([]string, len(row))
+		for j, cell := range row {
+			cell = strings.TrimSpace(strings.ReplaceAll(cell, "\n", " "))
+			cells[j] = strings.ReplaceAll(cell, "|", `\|`)
+		}
+		lines = append(lines, "| "+strings.Join(cells, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, strings.Repeat("|---", len(row))+"|")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+var (
+	wikiCodeStartPattern = regexp.MustCompile(`^\{(code|noformat)(?::([^}]*))?\}`)
+	wikiHeadingPattern   = regexp.MustCompile(`^h([1-6])\.\s+(.*)$`)
+	wikiQuoteLinePattern = regexp.MustCompile(`^bq\.\s+(.*)$`)
+	wikiListPattern      = regexp.MustCompile(`^([*#]+|-)\s+(.*)$`)
+	wikiRulePattern      = regexp.MustCompile(`^-{4,}$`)
+
+	wikiMonospacePattern = regexp.MustCompile(`\{\{(.+?)\}\}`)
+	wikiLinkPattern      = regexp.MustCompile(`\[([^\[\]\n]+)\]`)
+	wikiImagePattern     = regexp.MustCompile(`!([^!\s][^!\n]*)!`)
+	wikiURLPattern       = regexp.MustCompile(`\b(?:https?|ftp)://[^\s\]|)]+|\bmailto:[^\s\]|)]+`)
+	wikiMacroPattern     = regexp.MustCompile(`\{(?:color|panel|quote)(?::[^}]*)?\}`)
+	wikiBoldPattern      = regexp.MustCompile(`(^|[\s(\[{>"'])\*([^*\s](?:[^*\n]*[^*\s])?)\*($|[\s.,:;!?)\]}<"'])`)
+	wikiStrikePattern    = regexp.MustCompile(`(^|[\s(\[{>"'])-([^-\s](?:[^-\n]*[^-\s])?)-($|[\s.,:;!?)\]}<"'])`)
+	wikiInsertPattern    = regexp.MustCompile(`(^|[\s(\[{>"'])\+([^+\s](?:[^+\n]*[^+\s])?)\+($|[\s.,:;!?)\]}<"'])`)
+	wikiCitationPattern  = regexp.MustCompile(`\?\?([^?\n]+)\?\?`)
+	wikiPlaceholder      = regexp.MustCompile("\x00([0-9]+)\x00")
+)
+
+// jiraWikiMarkdown converts Jira wiki markup to Markdown: headings, lists,
+// quotes, code blocks, tables, links and text formatting.
+func jiraWikiMarkdown(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	var out []string
+	// counters numbers ordered list items per depth, listKinds keeps the
+	// markers of the previous item.
+	var counters []int
+	var listKinds string
+	codeEnd := ""
+	quote := false
+	table := false
+
+	emit := func(line string) {
+		if quote {
+			line = strings.TrimRight("> "+line, " ")
+		}
+		out = append(out, line)
+	}
+	separate := func() {
+		if len(out) > 0 && out[len(out)-1] != "" && out[len(out)-1] != ">" {
+			emit("")
+		}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		if codeEnd != "" {
+			if before, after, found := strings.Cut(line, codeEnd); found {
+				if before != "" {
+					emit(before)
+				}
+				emit("```")
+				codeEnd = ""
+				if strings.TrimSpace(after) != "" {
+					emit(jiraWikiInline(after))
+				}
+			} else {
+				emit(line)
+			}
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "{quote}") {
+			quote = !quote
+			trimmed = strings.TrimSpace(strings.TrimPrefix(trimmed, "{quote}"))
+			if trimmed == "" {
+				continue
+			}
+		}
+		closeQuote := quote && strings.HasSuffix(trimmed, "{quote}")
+		if closeQuote {
+			trimmed = strings.TrimSpace(strings.TrimSuffix(trimmed, "{quote}"))
+		}
+
+		isTable := strings.HasPrefix(trimmed, "|")
+		if table && !isTable {
+			table = false
+			if trimmed != "" {
+				emit("")
+			}
+		}
+		if match := wikiListPattern.FindStringSubmatch(trimmed); match == nil || wikiRulePattern.MatchString(trimmed) {
+			counters, listKinds = nil, ""
+		}
+
+		switch match := wikiCodeStartPattern.FindStringSubmatch(trimmed); {
+		case match != nil:
+			separate()
+			emit("```" + wikiCodeLanguage(match[2]))
+			codeEnd = "{" + match[1] + "}"
+			rest := trimmed[len(match[0]):]
+			if before, after, found := strings.Cut(rest, codeEnd); found {
+				if before != "" {
+					emit(before)
+				}
+				emit("```")
+				codeEnd = ""
+				if strings.TrimSpace(after) != "" {
+					emit(jiraWikiInline(after))
+				}
+			} else if rest != "" {
+				emit(rest)
+			}
+		case trimmed == "":
+			emit("")
+		case wikiRulePattern.MatchString(trimmed):
+			emit("---")
+		case wikiHeadingPattern.MatchString(trimmed):
+			match := wikiHeadingPattern.FindStringSubmatch(trimmed)
+			level, _ := strconv.Atoi(match[1])
+			emit(strings.Repeat("#", level) + " " + jiraWikiInline(match[2]))
+		case wikiQuoteLinePattern.MatchString(trimmed):
+			emit("> " + jiraWikiInline(wikiQuoteLinePattern.FindStringSubmatch(trimmed)[1]))
+		case wikiListPattern.MatchString(trimmed):
+			match := wikiListPattern.FindStringSubmatch(trimmed)
+			markers := match[1]
+			if markers == "-" {
+				markers = "*"
+			}
+			depth := len(markers)
+			for len(counters) < depth {
+				counters = append(counters, 0)
+			}
+			counters = counters[:depth]
+			if kinds := listKinds; len(kinds) >= depth && kinds[depth-1] != markers[depth-1] {
+				counters[depth-1] = 0
+			}
+			listKinds = markers
+			counters[depth-1]++
+			indent := 0
+			for _, marker := range markers[:depth-1] {
+				if marker == '#' {
+					indent += 3
+				} else {
+					indent += 2
+				}
+			}
+			marker := "- "
+			if markers[depth-1] == '#' {
+				marker = strconv.Itoa(counters[depth-1]) + ". "
+			}
+			emit(strings.Repeat(" ", indent) + marker + jiraWikiInline(match[2]))
+		case isTable:
+			if !table {
+				separate()
+			}
+			header := strings.HasPrefix(trimmed, "||")
+			var cells []string
+			for _, cell := range wikiTableCells(trimmed) {
+				cells = append(cells, jiraWikiInline(cell))
+			}
+			row := tableMarkdown([][]string{cells})
+			if table || !header {
+				row = strings.SplitN(row, "\n", 2)[0]
+			}
+			if !table && !header {
+				// Markdown tables need a header, so a table without one
+				// gets an empty header row.
+				row = tableMarkdown([][]string{make([]string, len(cells))}) + "\n" + row
+			}
+			emit(row)
+			table = true
+		default:
+			emit(jiraWikiInline(trimmed))
+		}
+
+		if closeQuote {
+			quote = false
+		}
+	}
+	if codeEnd != "" {
+		emit("```")
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// wikiCodeLanguage picks the language out of {code} parameters, given either
+// first ("{code:java}") or as language=.
+func wikiCodeLanguage(params string) string {
+	for i, param := range strings.Split(params, "|") {
+		key, value, found := strings.Cut(param, "=")
+		if !found && i == 0 {
+			return strings.TrimSpace(key)
+		}
+		if found && strings.TrimSpace(key) == "language" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// wikiTableCells splits a table row at the cell separators outside of links
+// and monospace text.
+func wikiTableCells(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(strings.TrimPrefix(row, "|"), "|")
+	row = strings.TrimSuffix(strings.TrimSuffix(row, "|"), "|")
+	var cells []string
+	var cell strings.Builder
+	brackets, braces := 0, 0
+	for i := 0; i < len(row); i++ {
+		switch c := row[i]; {
+		case c == '[':
+			brackets++
+		case c == ']' && brackets > 0:
+			brackets--
+		case c == '{':
+			braces++
+		case c == '}' && braces > 0:
+			braces--
+		case c == '|' && brackets == 0 && braces == 0:
+			cells = append(cells, cell.String())
+			cell.Reset()
+			if i+1 < len(row) && row[i+1] == '|' {
+				i++
+			}
+			continue
+		}
+		cell.WriteByte(row[i])
+	}
+	return append(cells, cell.String())
+}
+
+// jiraWikiInline converts inline wiki markup. Monospace text, links and URLs
+// are set aside first, so that formatting rules do not touch them.
+func jiraWikiInline(text string) string {
+	var kept []string
+	keep := func(markdown string) string {
+		kept = append(kept, markdown)
+		return "\x00" + strconv.Itoa(len(kept)-1) + "\x00"
+	}
+
+	text = wikiMonospacePattern.ReplaceAllStringFunc(text, func(match string) string {
+		return keep("`" + wikiMonospacePattern.FindStringSubmatch(match)[1] + "`")
+	})
+	text = wikiLinkPattern.ReplaceAllStringFunc(text, func(match string) string {
+		inner := wikiLinkPattern.FindStringSubmatch(match)[1]
+		switch {
+		case strings.HasPrefix(inner, "~"):
+			return keep("@" + strings.TrimPrefix(strings.TrimPrefix(inner, "~"), "accountid:"))
+		case strings.HasPrefix(inner, "^"):
+			return keep(strings.TrimPrefix(inner, "^"))
+		}
+		label, target, found := strings.Cut(inner, "|")
+		if !found {
+			if wikiURLPattern.MatchString(inner) {
+				return keep(inner)
+			}
+			return match
+		}
+		target, _, _ = strings.Cut(target, "|")
+		return keep("[" + wikiFormat(strings.TrimSpace(label)) + "](" + strings.TrimSpace(target) + ")")
+	})
+	text = wikiImagePattern.ReplaceAllStringFunc(text, func(match string) string {
+		name, _, _ := strings.Cut(wikiImagePattern.FindStringSubmatch(match)[1], "|")
+		if wikiURLPattern.MatchString(name) {
+			return keep("![](" + name + ")")
+		}
+		return keep(name)
+	})
+	text = wikiURLPattern.ReplaceAllStringFunc(text, keep)
+	text = strings.ReplaceAll(text, `\\`, "\n")
+
+	text = wikiFormat(text)
+	return wikiPlaceholder.ReplaceAllStringFunc(text, func(match string) string {
+		index, _ := strconv.Atoi(wikiPlaceholder.FindStringSubmatch(match)[1])
+		return kept[index]
+	})
+}
+
+// wikiFormat converts bold, strikethrough, inserted and cited text. Each rule
+// runs until nothing changes, because neighbouring spans share the space
+// between them.
+func wikiFormat(text string) string {
+	text = wikiMacroPattern.ReplaceAllString(text, "")
+	for _, rule := range []struct {
+		pattern     *regexp.Regexp
+		replacement string
+	}{
+		{wikiBoldPattern, "${1}**${2}**${3}"},
+		{wikiStrikePattern, "${1}~~${2}~~${3}"},
+		{wikiInsertPattern, "${1}${2}${3}"},
+		{wikiCitationPattern, "_${1}_"},
+	} {
+		for {
+			replaced := rule.pattern.ReplaceAllString(text, rule.replacement)
+			if replaced == text {
+				break
+			}
+			text = replaced
+		}
+	}
+	return text
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJiraWikiMarkdown(t *testing.T) {
+	tests := []struct {
+		name, wiki, want string
+	}{
+		{"heading", "h2. Plan", "## Plan"},
+		{"formatting", "*bold* and -gone- and +under+ and {{a_b}} and ??cite??", "**bold** and ~~gone~~ and under and `a_b` and _cite_"},
+		{"neighbours", "*one* *two*", "**one** **two**"},
+		{"words", "well-known 2*3*4 snake_case", "well-known 2*3*4 snake_case"},
+		{"links", "See [the docs|https://example.com/a_b_c] or [https://example.com] or https://x.test/a-b-", "See [the docs](https://example.com/a_b_c) or https://example.com or https://x.test/a-b-"},
+		{"mention", "ask [~jdoe] about [^log.txt]", "ask @jdoe about log.txt"},
+		{"lists", "* one\n** nested\n# first\n# second\n- dash", "- one\n  - nested\n1. first\n2. second\n- dash"},
+		{"code", "{code:java}\nint *a* = 1;\n{code}\nafter", "```java\nint *a* = 1;\n```\nafter"},
+		{"noformat", "{noformat}*raw*{noformat}", "```\n*raw*\n```"},
+		{"quote", "{quote}\nwise *words*\n{quote}\nbq. short", "> wise **words**\n> short"},
+		{"table", "intro\n||Name||Link||\n|a|[x|https://e.test]|\nafter", "intro\n\n| Name | Link |\n|---|---|\n| a | [x](https://e.test) |\n\nafter"},
+		{"rule", "above\n----\nbelow", "above\n---\nbelow"},
+		{"image", "!screen.png|thumbnail!", "screen.png"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := jiraWikiMarkdown(test.wiki); got != test.want {
+				t.Errorf("jiraWikiMarkdown(%q) =\n%s\nwant\n%s", test.wiki, got, test.want)
+			}
+		})
+	}
+}
+
+func TestJiraDocumentMarkdown(t *testing.T) {
+	const document = `{"type": "doc", "content": [
+		{"type": "heading", "attrs": {"level": 2}, "content": [{"type": "text", "text": "Steps"}]},
+		{"type": "paragraph", "content": [
+			{"type": "text", "text": "Read "},
+			{"type": "text", "text": "the guide", "marks": [{"type": "link", "attrs": {"href": "https://example.com"}}]},
+			{"type": "text", "text": ", "},
+			{"type": "text", "text": "carefully ", "marks": [{"type": "strong"}]},
+			{"type": "text", "text": "run", "marks": [{"type": "code"}]},
+			{"type": "hardBreak"},
+			{"type": "mention", "attrs": {"text": "@Ann"}}
+		]},
+		{"type": "orderedList", "content": [
+			{"type": "listItem", "content": [
+				{"type": "paragraph", "content": [{"type": "text", "text": "first"}]},
+				{"type": "bulletList", "content": [
+					{"type": "listItem", "content": [{"type": "paragraph", "content": [{"type": "text", "text": "detail", "marks": [{"type": "em"}]}]}]}
+				]}
+			]},
+			{"type": "listItem", "content": [{"type": "paragraph", "content": [{"type": "text", "text": "second"}]}]}
+		]},
+		{"type": "codeBlock", "attrs": {"language": "go"}, "content": [{"type": "text", "text": "x := 1"}]},
+		{"type": "table", "content": [
+			{"type": "tableRow", "content": [
+				{"type": "tableHeader", "content": [{"type": "paragraph", "content": [{"type": "text", "text": "A"}]}]},
+				{"type": "tableHeader", "content": [{"type": "paragraph", "content": [{"type": "text", "text": "B"}]}]}
+			]},
+			{"type": "tableRow", "content": [
+				{"type": "tableCell", "content": [{"type": "paragraph", "content": [{"type": "text", "text": "1"}]}]},
+				{"type": "tableCell", "content": [{"type": "paragraph", "content": [{"type": "text", "text": "a|b"}]}]}
+			]}
+		]},
+		{"type": "taskList", "content": [
+			{"type": "taskItem", "attrs": {"state": "DONE"}, "content": [{"type": "text", "text": "done"}]}
+		]}
+	]}`
+	const want = "## Steps\n\n" +
+		"Read [the guide](https://example.com), **carefully** `run`\n@Ann\n\n" +
+		"1. first\n   - _detail_\n2. second\n\n" +
+		"```go\nx := 1\n```\n\n" +
+		"| A | B |\n|---|---|\n| 1 | a\\|b |\n\n" +
+		"- [x] done"
+
+	var value any
+	if err := json.Unmarshal([]byte(document), &value); err != nil {
+		t.Fatal(err)
+	}
+	if got := jiraText(value); got != want {
+		t.Errorf("jiraText =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,865 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultJiraProject        = "Jira"
+	defaultJiraAttachmentsDir = "jira-attachments"
+	defaultJiraEmailDomain    = "jira.local"
+	jiraRootUID               = "jira"
+	subtasksTasklistName      = "Subtasks"
+)
+
+// jiraIssue is an issue read from a CSV or JSON export.
+type jiraIssue struct {
+	ID          string
+	Key         string
+	Project     string
+	ProjectName string
+	Type        string
+	Status      string
+	// StatusCategory is "new", "indeterminate" or "done" when the export
+	// has it.
+	StatusCategory string
+	Resolved       bool
+	Summary        string
+	Description    string
+	Assignee       string
+	Reporter       string
+	DueDate        string
+	Created        string
+	Labels         []string
+	Components     []string
+	// Parent is the ID or key of the parent of a subtask.
+	Parent      string
+	Comments    []jiraComment
+	Attachments []jiraAttachment
+}
+
+type jiraComment struct {
+	ID      string
+	Author  string
+	Created string
+	Body    string
+}
+
+type jiraAttachment struct {
+	ID       string
+	Name     string
+	Size     float64
+	MimeType string
+	Created  string
+	Author   string
+}
+
+type jiraUser struct {
+	ID    string
+	Name  string
+	Email string
+}
+
+// jiraSource reads Jira issue exports. All Jira projects go to one PLANKA
+// project: every Jira project becomes a board in a subspace of a root space
+// named after JIRA_PROJECT, and statuses become its lists through
+// JIRA_STATUS_LISTS. Subtasks become tasks of their parent.
+type jiraSource struct {
+	project        string
+	attachmentsDir string
+	statusLists    map[string]string
+	listOrder      []string
+	emails         map[string]string
+
+	issues   []*jiraIssue
+	byID     map[float64]*jiraIssue
+	subtasks map[string][]*jiraIssue
+	users    map[string]*jiraUser
+	// userOrder keeps users in the order they were first seen.
+	userOrder []string
+}
+
+// newJiraSource loads the exports at paths, CSV or JSON files or
+// directories of them.
+func newJiraSource(paths []string) (*jiraSource, error) {
+	s := &jiraSource{
+		project:        getEnvDefault("JIRA_PROJECT", defaultJiraProject),
+		attachmentsDir: getEnvDefault("JIRA_ATTACHMENTS_DIR", defaultJiraAttachmentsDir),
+		byID:           make(map[float64]*jiraIssue),
+		subtasks:       make(map[string][]*jiraIssue),
+		users:          make(map[string]*jiraUser),
+	}
+	var err error
+	if s.statusLists, s.listOrder, err = parseJiraStatusLists(getEnvDefault("JIRA_STATUS_LISTS", "")); err != nil {
+		return nil, fmt.Errorf("invalid JIRA_STATUS_LISTS: %w", err)
+	}
+	if s.emails, err = parseJiraUserEmails(getEnvDefault("JIRA_USER_EMAILS", "")); err != nil {
+		return nil, fmt.Errorf("invalid JIRA_USER_EMAILS: %w", err)
+	}
+
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open Jira export: %w", err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		for _, pattern := range []string{"*.csv", "*.json"} {
+			matches, err := filepath.Glob(filepath.Join(path, pattern))
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, matches...)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no Jira exports given")
+	}
+
+	for _, file := range files {
+		var issues []*jiraIssue
+		var err error
+		if strings.EqualFold(filepath.Ext(file), ".csv") {
+			issues, err = s.readCSV(file)
+		} else {
+			issues, err = s.readJSON(file)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Jira export %s: %w", file, err)
+		}
+		s.issues = append(s.issues, issues...)
+	}
+
+	keys := make(map[string]bool)
+	for _, issue := range s.issues {
+		keys[issue.ID] = true
+		keys[issue.Key] = true
+	}
+	for _, issue := range s.issues {
+		s.byID[syntheticID(issue.ID)] = issue
+		if issue.Parent != "" && keys[issue.Parent] {
+			s.subtasks[issue.Parent] = append(s.subtasks[issue.Parent], issue)
+		}
+	}
+	return s, nil
+}
+
+// parseJiraStatusLists parses rules like "Open=To Do,Reopened=To Do". It
+// returns the list of every status and the lists in the order given.
+func parseJiraStatusLists(spec string) (map[string]string, []string, error) {
+	lists := make(map[string]string)
+	var order []string
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		status, list, found := strings.Cut(entry, "=")
+		status, list = strings.TrimSpace(status), strings.TrimSpace(list)
+		if !found || status == "" || list == "" {
+			return nil, nil, fmt.Errorf("status rule %q is not status=list", entry)
+		}
+		lists[strings.ToLower(status)] = list
+		if !seen[list] {
+			seen[list] = true
+			order = append(order, list)
+		}
+	}
+	return lists, order, nil
+}
+
+// parseJiraUserEmails parses e-mails of Jira users like
+// "John Doe=john@example.com,557058:f1=ann@example.com", by display name or
+// account ID.
+func parseJiraUserEmails(spec string) (map[string]string, error) {
+	emails := make(map[string]string)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		user, email, found := strings.Cut(entry, "=")
+		if !found || !strings.Contains(email, "@") {
+			return nil, fmt.Errorf("user e-mail %q is not user=email", entry)
+		}
+		emails[strings.TrimSpace(user)] = strings.TrimSpace(email)
+	}
+	return emails, nil
+}
+
+// user registers a Jira user and returns its ID. The e-mail comes from the
+// export, JIRA_USER_EMAILS, or is made up from the name.
+func (s *jiraSource) user(id string, name string, email string) string {
+	if id == "" {
+		id = name
+	}
+	if id == "" {
+		return ""
+	}
+	user, exists := s.users[id]
+	if !exists {
+		user = &jiraUser{ID: id}
+		s.users[id] = user
+		s.userOrder = append(s.userOrder, id)
+	}
+	if user.Name == "" {
+		user.Name = name
+	}
+	if user.Email == "" {
+		user.Email = email
+	}
+	return id
+}
+
+func (s *jiraSource) email(userId string) string {
+	user, ok := s.users[userId]
+	if !ok {
+		return ""
+	}
+	if user.Email != "" {
+		return user.Email
+	}
+	for _, key := range []string{user.ID, user.Name} {
+		if email, ok := s.emails[key]; ok {
+			return email
+		}
+	}
+	local := strings.Trim(usernameInvalidChars.ReplaceAllString(strings.ToLower(user.Name), "_"), "_.")
+	if local == "" {
+		local = "jira_" + formatKaitenID(syntheticID(user.ID))
+	}
+	return local + "@" + defaultJiraEmailDomain
+}
+
+// readCSV reads a CSV export. Jira repeats columns such as Labels, Comment
+// and Attachment once per value.
+func (s *jiraSource) readCSV(path string) ([]*jiraIssue, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	columns := make(map[string][]int)
+	for i, name := range rows[0] {
+		name = strings.ToLower(strings.TrimSpace(name))
+		columns[name] = append(columns[name], i)
+	}
+
+	var issues []*jiraIssue
+	for _, row := range rows[1:] {
+		all := func(names ...string) []string {
+			var values []string
+			for _, name := range names {
+				for _, i := range columns[name] {
+					if i < len(row) && strings.TrimSpace(row[i]) != "" {
+						values = append(values, strings.TrimSpace(row[i]))
+					}
+				}
+			}
+			return values
+		}
+		first := func(names ...string) string {
+			if values := all(names...); len(values) > 0 {
+				return values[0]
+			}
+			return ""
+		}
+
+		issue := &jiraIssue{
+			ID:             first("issue id"),
+			Key:            first("issue key"),
+			Project:        first("project key"),
+			ProjectName:    first("project name"),
+			Type:           first("issue type"),
+			Status:         first("status"),
+			StatusCategory: jiraStatusCategory(first("status category")),
+			Resolved:       first("resolution") != "",
+			Summary:        first("summary"),
+			Description:    jiraText(first("description")),
+			Assignee:       s.user(first("assignee id"), first("assignee"), ""),
+			DueDate:        jiraTime(first("due date")),
+			Created:        jiraTime(first("created")),
+			Labels:         all("labels"),
+			Components:     all("component/s", "components"),
+			Parent:         first("parent id", "parent", "parent key"),
+		}
+		if issue.ID == "" {
+			issue.ID = issue.Key
+		}
+		if issue.ID == "" {
+			continue
+		}
+		issue.Reporter = s.user(first("reporter id"), first("reporter"), "")
+
+		// Comments are "date;author;text", attachments
+		// "date;author;name;url".
+		for i, value := range all("comment") {
+			parts := strings.SplitN(value, ";", 3)
+			comment := jiraComment{ID: issue.ID + "/" + fmt.Sprint(i), Body: jiraText(value)}
+			if len(parts) == 3 {
+				comment.Created = jiraTime(parts[0])
+				comment.Author = s.user(parts[1], "", "")
+				comment.Body = jiraText(parts[2])
+			}
+			issue.Comments = append(issue.Comments, comment)
+		}
+		for _, value := range all("attachment") {
+			parts := strings.SplitN(value, ";", 4)
+			if len(parts) < 4 {
+				continue
+			}
+			attachment := jiraAttachment{Name: parts[2], Created: jiraTime(parts[0]), Author: s.user(parts[1], "", "")}
+			if _, rest, found := strings.Cut(parts[3], "/attachment/"); found {
+				attachment.ID, _, _ = strings.Cut(rest, "/")
+			}
+			issue.Attachments = append(issue.Attachments, attachment)
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+type jiraJSONUser struct {
+	AccountID    string `json:"accountId"`
+	Name         string `json:"name"`
+	DisplayName  string `json:"displayName"`
+	EmailAddress string `json:"emailAddress"`
+}
+
+// readJSON reads issues as the Jira REST API returns them: a search result
+// with an "issues" array, or a bare array of issues.
+func (s *jiraSource) readJSON(path string) ([]*jiraIssue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	type jsonIssue struct {
+		ID     string `json:"id"`
+		Key    string `json:"key"`
+		Fields struct {
+			Summary     string `json:"summary"`
+			Description any    `json:"description"`
+			Status      struct {
+				Name           string `json:"name"`
+				StatusCategory struct {
+					Key string `json:"key"`
+				} `json:"statusCategory"`
+			} `json:"status"`
+			Resolution any `json:"resolution"`
+			Project    struct {
+				Key  string `json:"key"`
+				Name string `json:"name"`
+			} `json:"project"`
+			IssueType struct {
+				Name string `json:"name"`
+			} `json:"issuetype"`
+			Labels     []string `json:"labels"`
+			Components []struct {
+				Name string `json:"name"`
+			} `json:"components"`
+			Assignee *jiraJSONUser `json:"assignee"`
+			Reporter *jiraJSONUser `json:"reporter"`
+			DueDate  string        `json:"duedate"`
+			Created  string        `json:"created"`
+			Parent   *struct {
+				ID  string `json:"id"`
+				Key string `json:"key"`
+			} `json:"parent"`
+			Comment struct {
+				Comments []struct {
+					ID      string        `json:"id"`
+					Author  *jiraJSONUser `json:"author"`
+					Body    any           `json:"body"`
+					Created string        `json:"created"`
+				} `json:"comments"`
+			} `json:"comment"`
+			Attachment []struct {
+				ID       string        `json:"id"`
+				Filename string        `json:"filename"`
+				Size     float64       `json:"size"`
+				MimeType string        `json:"mimeType"`
+				Created  string        `json:"created"`
+				Author   *jiraJSONUser `json:"author"`
+			} `json:"attachment"`
+		} `json:"fields"`
+	}
+
+	var jsonIssues []jsonIssue
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		err = json.Unmarshal(data, &jsonIssues)
+	} else {
+		var search struct {
+			Issues []jsonIssue `json:"issues"`
+		}
+		err = json.Unmarshal(data, &search)
+		jsonIssues = search.Issues
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	jsonUser := func(user *jiraJSONUser) string {
+		if user == nil {
+			return ""
+		}
+		id := user.AccountID
+		if id == "" {
+			id = user.Name
+		}
+		return s.user(id, user.DisplayName, user.EmailAddress)
+	}
+
+	var issues []*jiraIssue
+	for _, jsonIssue := range jsonIssues {
+		fields := jsonIssue.Fields
+		issue := &jiraIssue{
+			ID:             jsonIssue.ID,
+			Key:            jsonIssue.Key,
+			Project:        fields.Project.Key,
+			ProjectName:    fields.Project.Name,
+			Type:           fields.IssueType.Name,
+			Status:         fields.Status.Name,
+			StatusCategory: fields.Status.StatusCategory.Key,
+			Resolved:       fields.Resolution != nil,
+			Summary:        fields.Summary,
+			Description:    jiraText(fields.Description),
+			Assignee:       jsonUser(fields.Assignee),
+			Reporter:       jsonUser(fields.Reporter),
+			DueDate:        jiraTime(fields.DueDate),
+			Created:        jiraTime(fields.Created),
+			Labels:         fields.Labels,
+		}
+		if issue.ID == "" {
+			issue.ID = issue.Key
+		}
+		for _, component := range fields.Components {
+			issue.Components = append(issue.Components, component.Name)
+		}
+		if fields.Parent != nil {
+			issue.Parent = fields.Parent.ID
+			if issue.Parent == "" {
+				issue.Parent = fields.Parent.Key
+			}
+		}
+		for _, comment := range fields.Comment.Comments {
+			issue.Comments = append(issue.Comments, jiraComment{
+				ID:      comment.ID,
+				Author:  jsonUser(comment.Author),
+				Created: jiraTime(comment.Created),
+				Body:    jiraText(comment.Body),
+			})
+		}
+		for _, attachment := range fields.Attachment {
+			issue.Attachments = append(issue.Attachments, jiraAttachment{
+				ID:       attachment.ID,
+				Name:     attachment.Filename,
+				Size:     attachment.Size,
+				MimeType: attachment.MimeType,
+				Created:  jiraTime(attachment.Created),
+				Author:   jsonUser(attachment.Author),
+			})
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+func jiraStatusCategory(name string) string {
+	switch strings.ToLower(name) {
+	case "to do", "new":
+		return "new"
+	case "in progress", "indeterminate":
+		return "indeterminate"
+	case "done":
+		return "done"
+	}
+	return ""
+}
+
+// jiraTime converts Jira's export timestamps to RFC 3339. Values in an
+// unknown format are kept as they are.
+func jiraTime(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05.000-0700", time.RFC3339, "02/Jan/06 3:04 PM", "02/Jan/06 15:04", "02/Jan/06", "2006-01-02 15:04", "2006-01-02"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			if layout == "2006-01-02" {
+				return value
+			}
+			return parsed.UTC().Format(time.RFC3339)
+		}
+	}
+	return value
+}
+
+func (s *jiraSource) isSubtask(issue *jiraIssue) bool {
+	if issue.Parent == "" {
+		return false
+	}
+	for _, subtask := range s.subtasks[issue.Parent] {
+		if subtask == issue {
+			return true
+		}
+	}
+	return false
+}
+
+// list returns the list an issue goes to: the one its status is mapped to,
+// or one named after the status.
+func (s *jiraSource) list(issue *jiraIssue) string {
+	if list, ok := s.statusLists[strings.ToLower(issue.Status)]; ok {
+		return list
+	}
+	if issue.Status == "" {
+		return "No status"
+	}
+	return issue.Status
+}
+
+// URL is empty: Jira links use issue keys, not IDs.
+func (s *jiraSource) URL() string {
+	return ""
+}
+
+func (s *jiraSource) Users() ([]KaitenUser, error) {
+	var users []KaitenUser
+	for _, id := range s.userOrder {
+		users = append(users, KaitenUser{
+			ID:          syntheticID(id),
+			Email:       s.email(id),
+			FullName:    s.users[id].Name,
+			CompanyRole: kaitenCompanyRoleUser,
+		})
+	}
+	return users, nil
+}
+
+// Tags are the labels and components of all issues.
+func (s *jiraSource) Tags() (map[float64]KaitenTag, error) {
+	tags := make(map[float64]KaitenTag)
+	for _, issue := range s.issues {
+		for _, label := range issue.Labels {
+			tags[syntheticID("label/"+label)] = KaitenTag{Id: syntheticID("label/" + label), Name: label}
+		}
+		for _, component := range issue.Components {
+			tags[syntheticID("component/"+component)] = KaitenTag{Id: syntheticID("component/" + component), Name: component}
+		}
+	}
+	return tags, nil
+}
+
+func (s *jiraSource) CustomProperties() (map[string]KaitenCustomProperty, error) {
+	return map[string]KaitenCustomProperty{}, nil
+}
+
+func (s *jiraSource) Spaces() (map[string]KaitenSpace, error) {
+	root := KaitenSpace{ID: syntheticID(jiraRootUID), Name: s.project, UID: jiraRootUID}
+	spaces := map[string]KaitenSpace{}
+	for _, issue := range s.issues {
+		uid := jiraRootUID + "/" + issue.Project
+		if _, exists := spaces[uid]; exists {
+			continue
+		}
+		name := issue.ProjectName
+		if name == "" {
+			name = issue.Project
+		}
+		spaces[uid] = KaitenSpace{ID: syntheticID(uid), Name: name, ParentID: jiraRootUID, UID: uid}
+		root.ChildIdDs = append(root.ChildIdDs, uid)
+	}
+	spaces[jiraRootUID] = root
+	return spaces, nil
+}
+
+func (s *jiraSource) Boards(space KaitenSpace) ([]KaitenBoard, error) {
+	if space.ParentID == "" {
+		return nil, nil
+	}
+	return []KaitenBoard{{ID: space.ID, Title: space.Name}}, nil
+}
+
+func (s *jiraSource) projectIssues(boardId float64) []*jiraIssue {
+	var issues []*jiraIssue
+	for _, issue := range s.issues {
+		if syntheticID(jiraRootUID+"/"+issue.Project) == boardId && !s.isSubtask(issue) {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// Columns are the lists of JIRA_STATUS_LISTS in their order, followed by a
+// list for every other status of the project, ordered by status category.
+func (s *jiraSource) Columns(board KaitenBoard) ([]KaitenColumn, error) {
+	categoryRank := map[string]int{"new": 0, "": 1, "indeterminate": 1, "done": 2}
+	lists := append([]string(nil), s.listOrder...)
+	seen := make(map[string]bool)
+	for _, list := range lists {
+		seen[list] = true
+	}
+	var others []string
+	rank := make(map[string]int)
+	for _, issue := range s.projectIssues(board.ID) {
+		list := s.list(issue)
+		if !seen[list] {
+			seen[list] = true
+			others = append(others, list)
+			rank[list] = categoryRank[issue.StatusCategory]
+		}
+	}
+	sort.SliceStable(others, func(i, j int) bool { return rank[others[i]] < rank[others[j]] })
+	lists = append(lists, others...)
+
+	var columns []KaitenColumn
+	for i, list := range lists {
+		columns = append(columns, KaitenColumn{
+			Position: float64(i + 1),
+			Name:     list,
+			Id:       syntheticID(formatKaitenID(board.ID) + "/" + list),
+			BoardID:  board.ID,
+		})
+	}
+	return columns, nil
+}
+
+// Cards are the project's issues in export order. The assignee becomes the
+// responsible member and the issue type the card type.
+func (s *jiraSource) Cards(column KaitenColumn) ([]KaitenCard, error) {
+	var cards []KaitenCard
+	for i, issue := range s.projectIssues(column.BoardID) {
+		if s.list(issue) != column.Name {
+			continue
+		}
+		card := KaitenCard{
+			ID:          syntheticID(issue.ID),
+			BoardID:     column.BoardID,
+			Title:       issue.Summary,
+			Description: issue.Description,
+			SortOrder:   float64(i + 1),
+			DueDate:     issue.DueDate,
+			Type:        KaitenCardType{Name: issue.Type},
+		}
+		if issue.Key != "" {
+			card.Title = issue.Key + " " + issue.Summary
+		}
+		if issue.Assignee != "" {
+			card.Members = append(card.Members, KaitenCardMember{Email: s.email(issue.Assignee), FullName: s.users[issue.Assignee].Name, Type: kaitenMemberTypeResponsible})
+		}
+		for _, label := range issue.Labels {
+			card.TagIds = append(card.TagIds, syntheticID("label/"+label))
+		}
+		for _, component := range issue.Components {
+			card.TagIds = append(card.TagIds, syntheticID("component/"+component))
+		}
+		if len(s.subtasks[issue.ID])+len(s.subtasks[issue.Key]) > 0 {
+			card.Checklists = []float64{syntheticID(issue.ID + "/" + subtasksTasklistName)}
+		}
+		cards = append(cards, card)
+	}
+	return cards, nil
+}
+
+func (s *jiraSource) issue(cardId float64) (*jiraIssue, error) {
+	issue, ok := s.byID[cardId]
+	if !ok {
+		return nil, fmt.Errorf("issue %s is not in the export", formatKaitenID(cardId))
+	}
+	return issue, nil
+}
+
+func (s *jiraSource) Comments(cardId float64) ([]KaitenComment, error) {
+	issue, err := s.issue(cardId)
+	if err != nil {
+		return nil, err
+	}
+	var comments []KaitenComment
+	for _, comment := range issue.Comments {
+		comments = append(comments, KaitenComment{
+			ID:          syntheticID(comment.ID),
+			AuthorEmail: s.email(comment.Author),
+			CreatedAt:   comment.Created,
+			Text:        comment.Body,
+		})
+	}
+	return comments, nil
+}
+
+// Attachments are looked up in JIRA_ATTACHMENTS_DIR as <issue key>/<file
+// name>, <issue key>/<attachment ID>, <attachment ID> or <file name>. Keys,
+// names and IDs come from the export, so only their last path element is
+// used.
+func (s *jiraSource) Attachments(cardId float64) ([]KaitenAttachment, error) {
+	issue, err := s.issue(cardId)
+	if err != nil {
+		return nil, err
+	}
+	key := jiraPathElement(issue.Key)
+	var attachments []KaitenAttachment
+	for _, attachment := range issue.Attachments {
+		name, id := jiraPathElement(attachment.Name), jiraPathElement(attachment.ID)
+		var candidates []string
+		if key != "" && name != "" {
+			candidates = append(candidates, filepath.Join(key, name))
+		}
+		if key != "" && id != "" {
+			candidates = append(candidates, filepath.Join(key, id))
+		}
+		if id != "" {
+			candidates = append(candidates, id)
+		}
+		if name != "" {
+			candidates = append(candidates, name)
+		}
+		if len(candidates) == 0 {
+			log.Printf("Skipping attachment %q of %s: it has no usable file name", attachment.Name, issue.Key)
+			continue
+		}
+
+		path := filepath.Join(s.attachmentsDir, candidates[0])
+		for _, candidate := range candidates {
+			if _, err := os.Stat(filepath.Join(s.attachmentsDir, candidate)); err == nil {
+				path = filepath.Join(s.attachmentsDir, candidate)
+				break
+			}
+		}
+		attachments = append(attachments, KaitenAttachment{
+			ID:          syntheticID(issue.ID + "/" + attachment.ID + "/" + attachment.Name),
+			Name:        attachment.Name,
+			URL:         path,
+			Size:        attachment.Size,
+			MimeType:    attachment.MimeType,
+			CreatedAt:   attachment.Created,
+			AuthorEmail: s.email(attachment.Author),
+		})
+	}
+	return attachments, nil
+}
+
+// Checklist lists the subtasks, done when resolved or in a done status.
+func (s *jiraSource) Checklist(cardId float64, checklistId float64) (KaitenChecklist, error) {
+	issue, err := s.issue(cardId)
+	if err != nil {
+		return KaitenChecklist{}, err
+	}
+	checklist := KaitenChecklist{Name: subtasksTasklistName}
+	for _, subtask := range append(s.subtasks[issue.ID], s.subtasks[issue.Key]...) {
+		name := subtask.Summary
+		if subtask.Key != "" {
+			name = subtask.Key + " " + subtask.Summary
+		}
+		checklist.Items = append(checklist.Items, KaitenChecklistItem{Text: name, Checked: subtask.Resolved || subtask.StatusCategory == "done"})
+	}
+	return checklist, nil
+}
+
+func (s *jiraSource) Subscribers(cardId float64) ([]string, error) {
+	return nil, nil
+}
+
+func (s *jiraSource) TimeLogs(cardId float64) ([]KaitenTimeLog, error) {
+	return nil, nil
+}
+
+// SpaceAccess gives everybody who appears in a project's issues write access
+// to its board. Exports do not include project permissions.
+func (s *jiraSource) SpaceAccess(space KaitenSpace) ([]KaitenAccess, error) {
+	seen := make(map[string]bool)
+	var access []KaitenAccess
+	grant := func(userId string) {
+		if userId == "" || seen[userId] {
+			return
+		}
+		seen[userId] = true
+		access = append(access, KaitenAccess{UserID: syntheticID(userId), Email: s.email(userId), Role: kaitenAccessWriter})
+	}
+	for _, issue := range s.issues {
+		if jiraRootUID+"/"+issue.Project != space.UID {
+			continue
+		}
+		grant(issue.Assignee)
+		grant(issue.Reporter)
+		for _, comment := range issue.Comments {
+			grant(comment.Author)
+		}
+		for _, attachment := range issue.Attachments {
+			grant(attachment.Author)
+		}
+	}
+	return access, nil
+}
+
+// BoardAccess fails, so that boards get the access of their space.
+func (s *jiraSource) BoardAccess(board KaitenBoard) ([]KaitenAccess, error) {
+	return nil, fmt.Errorf("board %s inherits the access of its space", board.Title)
+}
+
+func (s *jiraSource) GroupUsers(groupUID string) ([]float64, error) {
+	return nil, fmt.Errorf("Jira exports have no user groups")
+}
+
+// IsFileURL is false: Jira embeds images by attachment name, not by URL.
+func (s *jiraSource) IsFileURL(fileURL string) bool {
+	return false
+}
+
+// jiraPathElement returns the last element of a path from the export, or ""
+// when nothing usable is left.
+func jiraPathElement(name string) string {
+	name = filepath.Base(strings.ReplaceAll(strings.TrimSpace(name), `\`, "/"))
+	if name == "." || name == ".." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+// OpenFile opens a file in JIRA_ATTACHMENTS_DIR. Paths that resolve outside
+// of it, also through symbolic links, are refused.
+func (s *jiraSource) OpenFile(fileURL string) (SourceFile, error) {
+	dir, err := filepath.EvalSymlinks(s.attachmentsDir)
+	if err != nil {
+		return SourceFile{}, fmt.Errorf("attachment is not in %s: %w", s.attachmentsDir, err)
+	}
+	path, err := filepath.EvalSymlinks(fileURL)
+	if err != nil {
+		return SourceFile{}, fmt.Errorf("attachment is not in %s: %w", s.attachmentsDir, err)
+	}
+	if rel, err := filepath.Rel(dir, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return SourceFile{}, fmt.Errorf("attachment %s is outside of %s", fileURL, s.attachmentsDir)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return SourceFile{}, fmt.Errorf("attachment is not in %s: %w", s.attachmentsDir, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return SourceFile{}, err
+	}
+	return SourceFile{Body: file, Size: info.Size()}, nil
+}
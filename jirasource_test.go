@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJiraAttachmentsStayInAttachmentsDir(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "attachments")
+	if err := os.MkdirAll(filepath.Join(dir, "PRJ-1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "PRJ-1", "passwd"), []byte("ok"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "secret"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "secret"), filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	issue := &jiraIssue{ID: "1", Key: "PRJ-1", Attachments: []jiraAttachment{{Name: "../../etc/passwd"}}}
+	s := &jiraSource{attachmentsDir: dir, byID: map[float64]*jiraIssue{syntheticID("1"): issue}, users: map[string]*jiraUser{}}
+
+	attachments, err := s.Attachments(syntheticID("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attachments) != 1 || attachments[0].URL != filepath.Join(dir, "PRJ-1", "passwd") {
+		t.Fatalf("attachments = %+v, want PRJ-1/passwd inside the attachments directory", attachments)
+	}
+
+	for _, path := range []string{filepath.Join(root, "secret"), filepath.Join(dir, "..", "secret"), filepath.Join(dir, "link")} {
+		if file, err := s.OpenFile(path); err == nil {
+			file.Body.Close()
+			t.Errorf("OpenFile(%s) succeeded outside the attachments directory", path)
+		}
+	}
+	file, err := s.OpenFile(attachments[0].URL)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	file.Body.Close()
+}
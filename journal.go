@@ -0,0 +1,572 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	journalKindUser        = "user"
+	journalKindProject     = "project"
+	journalKindBoard       = "board"
+	journalKindList        = "list"
+	journalKindCard        = "card"
+	journalKindLabel       = "label"
+	journalKindComment     = "comment"
+	journalKindAttachment  = "attachment"
+	journalKindTaskList    = "taskList"
+	journalKindTask        = "task"
+	journalKindFieldGroup  = "customFieldGroup"
+	journalKindCustomField = "customField"
+	// journalKindUpdated entries record an object's updatedAt at the end of
+	// the run, and for cards their cardStates fingerprint, so that rollback
+	// can tell later manual edits.
+	journalKindUpdated = "updated"
+)
+
+// journalEntry is a line of a run journal. Parent is the object the entry
+// was created in, e.g. the card of a comment.
+type journalEntry struct {
+	Kind      string `json:"kind"`
+	ID        string `json:"id"`
+	Parent    string `json:"parent,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+	State     string `json:"state,omitempty"`
+}
+
+// runJournal appends every PLANKA object a run creates to <dir>/<run-id>.jsonl
+// as soon as it exists, so that even a crashed run can be rolled back.
+type runJournal struct {
+	mu      sync.Mutex
+	id      string
+	file    *os.File
+	encoder *json.Encoder
+	created map[string][]string
+}
+
+func newRunJournal(dir string) (*runJournal, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+	suffix := make([]byte, 2)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("failed to generate run ID: %w", err)
+	}
+	id := time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+
+	file, err := os.OpenFile(runJournalPath(dir, id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create run journal: %w", err)
+	}
+	return &runJournal{id: id, file: file, encoder: json.NewEncoder(file), created: make(map[string][]string)}, nil
+}
+
+func runJournalPath(dir string, runId string) string {
+	return filepath.Join(dir, runId+".jsonl")
+}
+
+func (j *runJournal) record(entry journalEntry) {
+	if entry.ID == "" {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if entry.Kind != journalKindUpdated {
+		j.created[entry.Kind] = append(j.created[entry.Kind], entry.ID)
+	}
+	if err := j.encoder.Encode(entry); err != nil {
+		log.Printf("Error writing run journal %s: %v", j.id, err)
+	}
+}
+
+// seal records the current updatedAt of every created user, project, board,
+// list and card, and the state of the cards. It runs after the migration has
+// made its own last changes.
+func (j *runJournal) seal() {
+	j.mu.Lock()
+	users := make(map[string]bool, len(j.created[journalKindUser]))
+	for _, userId := range j.created[journalKindUser] {
+		users[userId] = true
+	}
+	projects := j.created[journalKindProject]
+	boards := j.created[journalKindBoard]
+	j.mu.Unlock()
+
+	if len(users) > 0 {
+		plankaUsers, err := getPlankaUsers()
+		if err != nil {
+			log.Printf("Error reading users for run journal: %v", err)
+		}
+		for _, user := range plankaUsers {
+			if users[user.ID] {
+				j.record(journalEntry{Kind: journalKindUpdated, ID: user.ID, UpdatedAt: user.UpdatedAt})
+			}
+		}
+	}
+	for _, projectId := range projects {
+		project, err := getPlankaProjectInfo(projectId)
+		if err != nil {
+			log.Printf("Error reading project %s for run journal: %v", projectId, err)
+			continue
+		}
+		j.record(journalEntry{Kind: journalKindUpdated, ID: project.ID, UpdatedAt: project.UpdatedAt})
+	}
+	for _, boardId := range boards {
+		contents, err := getPlankaBoardContents(boardId)
+		if err != nil {
+			log.Printf("Error reading board %s for run journal: %v", boardId, err)
+			continue
+		}
+		j.record(journalEntry{Kind: journalKindUpdated, ID: boardId, UpdatedAt: contents.Board.UpdatedAt})
+		for _, list := range contents.Lists {
+			j.record(journalEntry{Kind: journalKindUpdated, ID: list.ID, UpdatedAt: list.UpdatedAt})
+		}
+		states := cardStates(contents)
+		for _, card := range contents.Cards {
+			j.record(journalEntry{Kind: journalKindUpdated, ID: card.ID, UpdatedAt: card.UpdatedAt, State: states[card.ID]})
+		}
+	}
+}
+
+// cardStates fingerprints the parts of every card that PLANKA changes without
+// touching the card's updatedAt: tasks, labels, members and custom field
+// values.
+func cardStates(contents PlankaBoardContents) map[string]string {
+	parts := make(map[string][]string, len(contents.Cards))
+	taskListCards := make(map[string]string, len(contents.TaskLists))
+	for _, taskList := range contents.TaskLists {
+		taskListCards[taskList.ID] = taskList.CardID
+		parts[taskList.CardID] = append(parts[taskList.CardID], "taskList "+taskList.ID+" "+taskList.Name)
+	}
+	for _, task := range contents.Tasks {
+		cardId := taskListCards[task.TaskListID]
+		parts[cardId] = append(parts[cardId], fmt.Sprintf("task %s %s %t %s", task.ID, task.TaskListID, task.IsCompleted, task.Name))
+	}
+	for _, cardLabel := range contents.CardLabels {
+		parts[cardLabel.CardID] = append(parts[cardLabel.CardID], "label "+cardLabel.LabelID)
+	}
+	for _, member := range contents.CardMemberships {
+		parts[member.CardID] = append(parts[member.CardID], "member "+member.UserID)
+	}
+	for _, value := range contents.CustomFieldValues {
+		parts[value.CardID] = append(parts[value.CardID], "value "+value.CustomFieldGroupID+" "+value.CustomFieldID+" "+value.Content)
+	}
+
+	states := make(map[string]string, len(contents.Cards))
+	for _, card := range contents.Cards {
+		cardParts := parts[card.ID]
+		sort.Strings(cardParts)
+		sum := sha256.Sum256([]byte(strings.Join(cardParts, "\n")))
+		states[card.ID] = hex.EncodeToString(sum[:8])
+	}
+	return states
+}
+
+func (j *runJournal) Close() error {
+	return j.file.Close()
+}
+
+// journalSink records everything created through the wrapped sink. Objects
+// created inside others, e.g. board memberships or card labels, go away with
+// them and are not recorded.
+type journalSink struct {
+	Sink
+	journal *runJournal
+}
+
+func newJournalSink(sink Sink, journal *runJournal) *journalSink {
+	return &journalSink{Sink: sink, journal: journal}
+}
+
+func (s *journalSink) CreateUser(user PlankaUser) (string, error) {
+	id, err := s.Sink.CreateUser(user)
+	s.journal.record(journalEntry{Kind: journalKindUser, ID: id})
+	return id, err
+}
+
+func (s *journalSink) CreateProject(space KaitenSpace) (PlankaProject, error) {
+	project, err := s.Sink.CreateProject(space)
+	if err == nil && !project.Existing {
+		s.journal.record(journalEntry{Kind: journalKindProject, ID: project.ID})
+	}
+	return project, err
+}
+
+func (s *journalSink) CreateBoard(projectId string, board KaitenBoard, prefix string) (PlankaBoard, error) {
+	created, err := s.Sink.CreateBoard(projectId, board, prefix)
+	s.journal.record(journalEntry{Kind: journalKindBoard, ID: created.ID, Parent: projectId})
+	return created, err
+}
+
+func (s *journalSink) CreateList(boardId string, column KaitenColumn) (PlankaList, error) {
+	list, err := s.Sink.CreateList(boardId, column)
+	s.journal.record(journalEntry{Kind: journalKindList, ID: list.ID, Parent: boardId})
+	return list, err
+}
+
+func (s *journalSink) CreateCard(listId string, card KaitenCard, cardType string) (string, error) {
+	id, err := s.Sink.CreateCard(listId, card, cardType)
+	s.journal.record(journalEntry{Kind: journalKindCard, ID: id, Parent: listId})
+	return id, err
+}
+
+func (s *journalSink) CreateComment(cardId string, comment KaitenComment) (string, error) {
+	id, err := s.Sink.CreateComment(cardId, comment)
+	s.journal.record(journalEntry{Kind: journalKindComment, ID: id, Parent: cardId})
+	return id, err
+}
+
+func (s *journalSink) UploadAttachment(cardId string, content io.Reader, name string, mimeType string, authorEmail string) (PlankaAttachment, error) {
+	attachment, err := s.Sink.UploadAttachment(cardId, content, name, mimeType, authorEmail)
+	s.journal.record(journalEntry{Kind: journalKindAttachment, ID: attachment.ID, Parent: cardId})
+	return attachment, err
+}
+
+func (s *journalSink) CreateTaskList(cardId string, name string) (string, error) {
+	id, err := s.Sink.CreateTaskList(cardId, name)
+	s.journal.record(journalEntry{Kind: journalKindTaskList, ID: id, Parent: cardId})
+	return id, err
+}
+
+func (s *journalSink) CreateTask(listId string, task PlankaTask) (string, error) {
+	id, err := s.Sink.CreateTask(listId, task)
+	s.journal.record(journalEntry{Kind: journalKindTask, ID: id, Parent: listId})
+	return id, err
+}
+
+func (s *journalSink) CreateLabel(boardId string, label PlankaLabel) (PlankaLabel, error) {
+	created, err := s.Sink.CreateLabel(boardId, label)
+	s.journal.record(journalEntry{Kind: journalKindLabel, ID: created.Id, Parent: boardId})
+	return created, err
+}
+
+func (s *journalSink) CreateCustomFieldGroup(boardId string, name string) (string, error) {
+	id, err := s.Sink.CreateCustomFieldGroup(boardId, name)
+	s.journal.record(journalEntry{Kind: journalKindFieldGroup, ID: id, Parent: boardId})
+	return id, err
+}
+
+func (s *journalSink) CreateCustomField(groupId string, field PlankaCustomField) (string, error) {
+	id, err := s.Sink.CreateCustomField(groupId, field)
+	s.journal.record(journalEntry{Kind: journalKindCustomField, ID: id, Parent: groupId})
+	return id, err
+}
+
+// runRollback deletes what a run created, cards first and users last. An
+// object is kept when its updatedAt or, for cards, its tasks, labels, members
+// or custom field values changed since the run, or when it holds anything the
+// run did not create, and then so is everything it is in. On kept boards the
+// run's comments of kept cards and its unused labels and custom field groups
+// are still deleted.
+type runRollback struct {
+	created  map[string]map[string]journalEntry
+	order    map[string][]string
+	updated  map[string]string
+	states   map[string]string
+	comments map[string][]string
+	sealed   bool
+	// removed holds the IDs of the objects that are gone after the rollback.
+	removed map[string]bool
+
+	deleted int
+	kept    int
+}
+
+func loadRunRollback(dir string, runId string) (*runRollback, error) {
+	file, err := os.Open(runJournalPath(dir, runId))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no journal for run %s in %s", runId, dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open run journal: %w", err)
+	}
+	defer file.Close()
+
+	r := &runRollback{
+		created:  make(map[string]map[string]journalEntry),
+		order:    make(map[string][]string),
+		updated:  make(map[string]string),
+		states:   make(map[string]string),
+		comments: make(map[string][]string),
+		removed:  make(map[string]bool),
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// The last line of a crashed run may be cut off.
+			log.Printf("Skipping unreadable journal line: %v", err)
+			continue
+		}
+		if entry.Kind == journalKindUpdated {
+			r.updated[entry.ID] = entry.UpdatedAt
+			if entry.State != "" {
+				r.states[entry.ID] = entry.State
+			}
+			r.sealed = true
+			continue
+		}
+		if r.created[entry.Kind] == nil {
+			r.created[entry.Kind] = make(map[string]journalEntry)
+		}
+		r.created[entry.Kind][entry.ID] = entry
+		r.order[entry.Kind] = append(r.order[entry.Kind], entry.ID)
+		if entry.Kind == journalKindComment {
+			r.comments[entry.Parent] = append(r.comments[entry.Parent], entry.ID)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read run journal: %w", err)
+	}
+	if !r.sealed {
+		log.Printf("Run %s did not finish, manual edits of its objects cannot be detected", runId)
+	}
+	return r, nil
+}
+
+func (r *runRollback) isCreated(kind string, id string) bool {
+	_, ok := r.created[kind][id]
+	return ok
+}
+
+// edited reports whether the object changed after the run.
+func (r *runRollback) edited(id string, updatedAt string) bool {
+	baseline, ok := r.updated[id]
+	return ok && baseline != updatedAt
+}
+
+// changed reports whether the card's cardStates fingerprint changed after the
+// run. Journals written before fingerprints existed never report a change.
+func (r *runRollback) changed(cardId string, state string) bool {
+	baseline, ok := r.states[cardId]
+	return ok && baseline != state
+}
+
+func (r *runRollback) keep(format string, args ...any) {
+	log.Printf("Keeping "+format, args...)
+	r.kept++
+}
+
+// delete deletes the object at endpoint, whose last segment is its ID.
+func (r *runRollback) delete(endpoint string) bool {
+	if err := deletePlankaObject(endpoint); err != nil && !isPlankaNotFound(err) {
+		log.Printf("Error during rollback: %v", err)
+		r.kept++
+		return false
+	}
+	r.removed[path.Base(endpoint)] = true
+	r.deleted++
+	return true
+}
+
+// forget removes the objects the rollback deleted from the ID mapping and
+// returns how many entries it removed.
+func (r *runRollback) forget(mapping *mappingStore) int {
+	return mapping.RemoveTargets(r.removed)
+}
+
+func (r *runRollback) run() error {
+	boards := r.order[journalKindBoard]
+	for i := len(boards) - 1; i >= 0; i-- {
+		r.board(boards[i])
+	}
+
+	projects := r.order[journalKindProject]
+	for i := len(projects) - 1; i >= 0; i-- {
+		r.project(projects[i])
+	}
+
+	users := r.order[journalKindUser]
+	if r.kept > 0 && len(users) > 0 {
+		log.Printf("Keeping %d users of the run, since some of its objects were kept", len(users))
+	} else if len(users) > 0 {
+		plankaUsers, err := getPlankaUsers()
+		if err != nil {
+			return fmt.Errorf("error fetching Planka users: %w", err)
+		}
+		updated := make(map[string]string, len(plankaUsers))
+		for _, user := range plankaUsers {
+			updated[user.ID] = user.UpdatedAt
+		}
+		for i := len(users) - 1; i >= 0; i-- {
+			updatedAt, exists := updated[users[i]]
+			switch {
+			case !exists:
+			case r.edited(users[i], updatedAt):
+				r.keep("user %s: edited after the run", users[i])
+			default:
+				r.delete("/api/users/" + users[i])
+			}
+		}
+	}
+
+	log.Printf("Rollback finished: %d objects deleted, %d kept", r.deleted, r.kept)
+	return nil
+}
+
+func (r *runRollback) board(boardId string) {
+	contents, err := getPlankaBoardContents(boardId)
+	if isPlankaNotFound(err) {
+		r.removed[boardId] = true
+		return
+	}
+	if err != nil {
+		r.keep("board %s: %v", boardId, err)
+		return
+	}
+
+	foreign := make(map[string]bool)
+	for _, attachment := range contents.Attachments {
+		if !r.isCreated(journalKindAttachment, attachment.ID) {
+			foreign[attachment.CardID] = true
+		}
+	}
+	for _, taskList := range contents.TaskLists {
+		if !r.isCreated(journalKindTaskList, taskList.ID) {
+			foreign[taskList.CardID] = true
+		}
+	}
+
+	states := cardStates(contents)
+	keptCards := make(map[string]bool)
+	keptLists := make(map[string]bool)
+	keptAny := false
+	for _, card := range contents.Cards {
+		reason := ""
+		switch {
+		case !r.isCreated(journalKindCard, card.ID):
+			reason = "not created by the run"
+		case r.edited(card.ID, card.UpdatedAt):
+			reason = "edited after the run"
+		case r.changed(card.ID, states[card.ID]):
+			reason = "tasks, labels, members or custom fields changed after the run"
+		case foreign[card.ID]:
+			reason = "has attachments or task lists added after the run"
+		case card.CommentsTotal != nil && *card.CommentsTotal > len(r.comments[card.ID]):
+			reason = "has comments added after the run"
+		}
+		if reason == "" && r.delete("/api/cards/"+card.ID) {
+			continue
+		}
+		if reason != "" {
+			r.keep("card %q: %s", card.Name, reason)
+		}
+		keptCards[card.ID] = true
+		keptLists[card.ListID] = true
+		keptAny = true
+	}
+
+	for _, list := range contents.Lists {
+		if list.Type != "active" && list.Type != "closed" {
+			continue
+		}
+		reason := ""
+		switch {
+		case !r.isCreated(journalKindList, list.ID):
+			reason = "not created by the run"
+		case r.edited(list.ID, list.UpdatedAt):
+			reason = "edited after the run"
+		case keptLists[list.ID]:
+			reason = "holds kept cards"
+		}
+		if reason == "" && r.delete("/api/lists/"+list.ID) {
+			continue
+		}
+		if reason != "" {
+			r.keep("list %q: %s", list.Name, reason)
+		}
+		keptAny = true
+	}
+
+	switch {
+	case r.edited(boardId, contents.Board.UpdatedAt):
+		r.keep("board %q: edited after the run", contents.Board.Name)
+	case keptAny:
+		r.keep("board %q: holds kept lists or cards", contents.Board.Name)
+	default:
+		if r.delete("/api/boards/" + boardId) {
+			// The board's labels go with it.
+			for _, label := range contents.Labels {
+				r.removed[label.Id] = true
+			}
+			return
+		}
+	}
+	r.keptBoard(contents, keptCards)
+}
+
+// keptBoard deletes what the run added to a board that stays: its comments
+// on kept cards, and its labels and custom field groups no kept card uses.
+func (r *runRollback) keptBoard(contents PlankaBoardContents, keptCards map[string]bool) {
+	for cardId := range keptCards {
+		for _, commentId := range r.comments[cardId] {
+			r.delete("/api/comments/" + commentId)
+		}
+	}
+
+	usedLabels := make(map[string]bool)
+	for _, cardLabel := range contents.CardLabels {
+		if keptCards[cardLabel.CardID] {
+			usedLabels[cardLabel.LabelID] = true
+		}
+	}
+	for _, label := range contents.Labels {
+		switch {
+		case !r.isCreated(journalKindLabel, label.Id):
+		case usedLabels[label.Id]:
+			r.keep("label %q: used by kept cards", label.Name)
+		default:
+			r.delete("/api/labels/" + label.Id)
+		}
+	}
+
+	usedGroups := make(map[string]bool)
+	for _, value := range contents.CustomFieldValues {
+		if keptCards[value.CardID] {
+			usedGroups[value.CustomFieldGroupID] = true
+		}
+	}
+	for _, group := range contents.CustomFieldGroups {
+		switch {
+		case !r.isCreated(journalKindFieldGroup, group.ID):
+		case usedGroups[group.ID]:
+			r.keep("custom field group %q: used by kept cards", group.Name)
+		default:
+			r.delete("/api/custom-field-groups/" + group.ID)
+		}
+	}
+}
+
+func (r *runRollback) project(projectId string) {
+	project, err := getPlankaProjectInfo(projectId)
+	if isPlankaNotFound(err) {
+		r.removed[projectId] = true
+		return
+	}
+	switch {
+	case err != nil:
+		r.keep("project %s: %v", projectId, err)
+	case r.edited(projectId, project.UpdatedAt):
+		r.keep("project %q: edited after the run", project.Name)
+	case len(project.Boards) > 0:
+		r.keep("project %q: holds boards", project.Name)
+	default:
+		r.delete("/api/projects/" + projectId)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCardStatesNoticeChildChanges(t *testing.T) {
+	base := PlankaBoardContents{
+		Cards:           []PlankaCardInfo{{ID: "c1"}, {ID: "c2"}},
+		TaskLists:       []PlankaTaskListInfo{{ID: "tl1", CardID: "c1", Name: "Steps"}},
+		Tasks:           []PlankaTaskInfo{{ID: "t1", TaskListID: "tl1", Name: "plan"}},
+		CardLabels:      []PlankaCardLabelInfo{{CardID: "c1", LabelID: "l1"}, {CardID: "c1", LabelID: "l3"}},
+		CardMemberships: []PlankaCardMemberInfo{{CardID: "c1", UserID: "u1"}},
+	}
+	before := cardStates(base)
+
+	for name, edit := range map[string]func(*PlankaBoardContents){
+		"task checked": func(c *PlankaBoardContents) { c.Tasks[0].IsCompleted = true },
+		"task added": func(c *PlankaBoardContents) {
+			c.Tasks = append(c.Tasks, PlankaTaskInfo{ID: "t2", TaskListID: "tl1", Name: "ship"})
+		},
+		"label added": func(c *PlankaBoardContents) {
+			c.CardLabels = append(c.CardLabels, PlankaCardLabelInfo{CardID: "c1", LabelID: "l2"})
+		},
+		"member removed": func(c *PlankaBoardContents) { c.CardMemberships = nil },
+		"field set": func(c *PlankaBoardContents) {
+			c.CustomFieldValues = []PlankaCustomFieldValueInfo{{CardID: "c1", CustomFieldGroupID: "g", CustomFieldID: "f", Content: "x"}}
+		},
+	} {
+		contents := base
+		contents.Tasks = append([]PlankaTaskInfo(nil), base.Tasks...)
+		contents.CardLabels = append([]PlankaCardLabelInfo(nil), base.CardLabels...)
+		edit(&contents)
+		after := cardStates(contents)
+		if after["c1"] == before["c1"] {
+			t.Errorf("%s: state of c1 did not change", name)
+		}
+		if after["c2"] != before["c2"] {
+			t.Errorf("%s: state of c2 changed", name)
+		}
+	}
+
+	reordered := base
+	reordered.CardLabels = []PlankaCardLabelInfo{base.CardLabels[1], base.CardLabels[0]}
+	if cardStates(reordered)["c1"] != before["c1"] {
+		t.Error("state depends on the order PLANKA lists labels in")
+	}
+}
+
+func TestRollbackForgetsRolledBackIDs(t *testing.T) {
+	var mu sync.Mutex
+	var deleted []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/boards/b1", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"item": {"id": "b1", "name": "Board"}, "included": {
+			"lists": [{"id": "l1", "type": "active", "name": "Todo"}],
+			"cards": [{"id": "c1", "listId": "l1", "name": "Card"}],
+			"labels": [{"id": "lb1", "name": "bug"}]}}`)
+	})
+	mux.HandleFunc("GET /api/boards/b2", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"code": "E_NOT_FOUND"}`, http.StatusNotFound)
+	})
+	mux.HandleFunc("GET /api/projects/p1", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"item": {"id": "p1", "name": "Project"}, "included": {"boards": []}}`)
+	})
+	mux.HandleFunc("DELETE /api/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		deleted = append(deleted, r.URL.Path)
+		mu.Unlock()
+		io.WriteString(w, `{"item": {}}`)
+	})
+	useTestServers(t, mux)
+
+	dir := t.TempDir()
+	var journal strings.Builder
+	encoder := json.NewEncoder(&journal)
+	for _, entry := range []journalEntry{
+		{Kind: journalKindProject, ID: "p1"},
+		{Kind: journalKindBoard, ID: "b1", Parent: "p1"},
+		{Kind: journalKindBoard, ID: "b2", Parent: "p1"},
+		{Kind: journalKindLabel, ID: "lb1", Parent: "b1"},
+		{Kind: journalKindList, ID: "l1", Parent: "b1"},
+		{Kind: journalKindCard, ID: "c1", Parent: "l1"},
+	} {
+		encoder.Encode(entry)
+	}
+	if err := os.WriteFile(runJournalPath(dir, "run1"), []byte(journal.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	mappingPath := filepath.Join(dir, "mapping.json")
+	mapping, err := loadMappingStore(mappingPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapping.Set("project", "10", "p1")
+	mapping.Set("board", "20", "b1")
+	mapping.Set("board", "21", "b2")
+	mapping.Set("label", "20/5", "lb1")
+	mapping.Set("list", "30", "l1")
+	mapping.Set("card", "40", "c1")
+	mapping.Set("card", "41", "c-other")
+	if err := mapping.Save(); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("RUN_JOURNAL_DIR", dir)
+	t.Setenv("MAPPING_FILE", mappingPath)
+
+	if err := runRollbackCommand("run1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deleted) != 4 {
+		t.Errorf("deleted %v, want the card, list, board and project", deleted)
+	}
+	saved, err := loadMappingStore(mappingPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range []struct{ kind, sourceId string }{
+		{"project", "10"}, {"board", "20"}, {"board", "21"}, {"label", "20/5"}, {"list", "30"}, {"card", "40"},
+	} {
+		if targetId, ok := saved.Get(entry.kind, entry.sourceId); ok {
+			t.Errorf("%s %s still maps to %s", entry.kind, entry.sourceId, targetId)
+		}
+	}
+	if targetId, _ := saved.Get("card", "41"); targetId != "c-other" {
+		t.Errorf("card 41 maps to %q, want the entry outside the run kept", targetId)
+	}
+}
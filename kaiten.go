@@ -1,15 +1,22 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/time/rate"
@@ -28,6 +35,16 @@ type KaitenBoard struct {
 	Title string  `json:"title"`
 }
 
+// KaitenAccess is a user's or group's access to a space or board. Role is
+// one of the kaitenAccess* roles.
+type KaitenAccess struct {
+	UserID    float64 `json:"user_id,omitempty"`
+	Email     string  `json:"email,omitempty"`
+	GroupUID  string  `json:"group_uid,omitempty"`
+	GroupName string  `json:"group_name,omitempty"`
+	Role      string  `json:"role"`
+}
+
 type KaitenColumn struct {
 	Position float64 `json:"position"`
 	Name     string  `json:"name"`
@@ -36,19 +53,62 @@ type KaitenColumn struct {
 	BoardID  float64 `json:"board_id"`
 }
 
+type KaitenLane struct {
+	ID        float64 `json:"id"`
+	Title     string  `json:"title"`
+	SortOrder float64 `json:"sort_order"`
+	BoardID   float64 `json:"board_id"`
+}
+
 type KaitenCard struct {
-	ID          float64   `json:"id"`
-	BoardID     float64   `json:"board_id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	SortOrder   float64   `json:"sort_order"`
-	Members     []string  `json:"members"`
-	DueDate     string    `json:"due_date,omitempty"`
-	StartDate   string    `json:"start_date,omitempty"`
-	EndDate     string    `json:"end_date,omitempty"`
-	TagIds      []float64 `json:"tag_ids,omitempty"`
-	Archived    bool      `json:"archived"`
-	Checklists  []float64 `json:"checklists,omitempty"`
+	ID          float64            `json:"id"`
+	BoardID     float64            `json:"board_id"`
+	Title       string             `json:"title"`
+	Description string             `json:"description"`
+	SortOrder   float64            `json:"sort_order"`
+	Members     []KaitenCardMember `json:"members"`
+	Subscribers []string           `json:"subscribers,omitempty"`
+	DueDate     string             `json:"due_date,omitempty"`
+	StartDate   string             `json:"start_date,omitempty"`
+	EndDate     string             `json:"end_date,omitempty"`
+	TagIds      []float64          `json:"tag_ids,omitempty"`
+	Archived    bool               `json:"archived"`
+	Checklists  []float64          `json:"checklists,omitempty"`
+	Properties  map[string]any     `json:"properties,omitempty"`
+	Type        KaitenCardType     `json:"type"`
+	State       float64            `json:"state"`
+	ParentIds   []float64          `json:"parent_ids,omitempty"`
+	ChildIds    []float64          `json:"child_ids,omitempty"`
+	Blockers    []KaitenBlocker    `json:"blockers,omitempty"`
+	Size        float64            `json:"size,omitempty"`
+	SizeText    string             `json:"size_text,omitempty"`
+}
+
+const (
+	kaitenMemberTypeMember      = 1
+	kaitenMemberTypeResponsible = 2
+)
+
+type KaitenCardMember struct {
+	Email    string  `json:"email"`
+	FullName string  `json:"full_name"`
+	Type     float64 `json:"type"`
+}
+
+type KaitenBlocker struct {
+	ID               float64 `json:"id"`
+	Reason           string  `json:"reason"`
+	BlockerCardID    float64 `json:"blocker_card_id,omitempty"`
+	BlockerCardTitle string  `json:"blocker_card_title,omitempty"`
+	Released         bool    `json:"released"`
+}
+
+type KaitenCardType struct {
+	ID       float64 `json:"id"`
+	Name     string  `json:"name"`
+	Letter   string  `json:"letter"`
+	Color    float64 `json:"color"`
+	ColorHex string  `json:"color_hex,omitempty"`
 }
 
 type KaitenComment struct {
@@ -59,8 +119,25 @@ type KaitenComment struct {
 }
 
 type KaitenAttachment struct {
-	Name string `json:"name"`
-	URL  string `json:"url"`
+	ID          float64 `json:"id"`
+	Name        string  `json:"name"`
+	URL         string  `json:"url"`
+	Size        float64 `json:"size,omitempty"`
+	MimeType    string  `json:"mime_type,omitempty"`
+	CreatedAt   string  `json:"created,omitempty"`
+	AuthorEmail string  `json:"author_email,omitempty"`
+	AuthorName  string  `json:"author_name,omitempty"`
+	Cover       bool    `json:"card_cover,omitempty"`
+}
+
+type KaitenTimeLog struct {
+	ID        float64 `json:"id"`
+	UserID    float64 `json:"user_id"`
+	UserName  string  `json:"user_name"`
+	UserEmail string  `json:"user_email"`
+	Minutes   float64 `json:"time_spent"`
+	ForDate   string  `json:"for_date"`
+	Comment   string  `json:"comment,omitempty"`
 }
 
 type KaitenChecklist struct {
@@ -74,17 +151,31 @@ type KaitenChecklistItem struct {
 }
 
 type KaitenTag struct {
-	Id    float64 `json:"id"`
-	Name  string  `json:"name"`
-	Color float64 `json:"color"`
+	Id       float64 `json:"id"`
+	Name     string  `json:"name"`
+	Color    float64 `json:"color"`
+	ColorHex string  `json:"color_hex,omitempty"`
+}
+
+type KaitenCustomProperty struct {
+	ID           float64           `json:"id"`
+	Name         string            `json:"name"`
+	Type         string            `json:"type"`
+	SelectValues map[string]string `json:"select_values,omitempty"`
 }
 
 type KaitenUser struct {
-	Email    string `json:"email"`
-	FullName string `json:"full_name"`
-	Username string `json:"username"`
+	ID       float64 `json:"id"`
+	Email    string  `json:"email"`
+	FullName string  `json:"full_name"`
+	Username string  `json:"username"`
+	// CompanyRole is one of the kaitenCompanyRole* roles.
+	CompanyRole string `json:"company_role,omitempty"`
+	Inactive    bool   `json:"inactive,omitempty"`
 }
 
+const kaitenMaxAttempts = 5
+
 var (
 	kaitenLimiter = rate.NewLimiter(rate.Every(time.Second/4), 1)
 
@@ -109,6 +200,19 @@ func initKaitenEnv() error {
 		}
 
 		kaitenURL = strings.TrimRight(kaitenURL, "/")
+
+		if spec := getEnvDefault("KAITEN_ACCESS_ROLE_IDS", ""); spec != "" {
+			if kaitenAccessRoleIds, envInitErr = parseKaitenRoleIds(spec, kaitenAccessReader, kaitenAccessCommenter, kaitenAccessWriter, kaitenAccessOwner); envInitErr != nil {
+				envInitErr = fmt.Errorf("invalid KAITEN_ACCESS_ROLE_IDS: %w", envInitErr)
+				return
+			}
+		}
+		if spec := getEnvDefault("KAITEN_COMPANY_ROLE_IDS", ""); spec != "" {
+			if kaitenCompanyRoleIds, envInitErr = parseKaitenRoleIds(spec, kaitenCompanyRoleAdmin, kaitenCompanyRoleUser, kaitenCompanyRoleGuest); envInitErr != nil {
+				envInitErr = fmt.Errorf("invalid KAITEN_COMPANY_ROLE_IDS: %w", envInitErr)
+				return
+			}
+		}
 	})
 	return envInitErr
 }
@@ -118,31 +222,37 @@ func kaitenAPICall(url string, method string) ([]byte, error) {
 }
 
 func kaitenAPICallWithContext(ctx context.Context, url string, method string) ([]byte, error) {
+	return kaitenAPISend(ctx, url, method, nil, false)
+}
+
+// kaitenAPISend sends a request with an optional JSON payload to the Kaiten API.
+// creates marks requests that create an object, see kaitenDo.
+func kaitenAPISend(ctx context.Context, url string, method string, jsonPayload []byte, creates bool) ([]byte, error) {
 	if err := initKaitenEnv(); err != nil {
 		return nil, err
 	}
 
 	fullURL := kaitenURL + "/" + strings.TrimPrefix(url, "/")
 
-	req, err := http.NewRequestWithContext(ctx, method, fullURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Authorization", "Bearer "+kaitenToken)
-	req.Header.Set("Content-Type", "application/json")
-
 	client := clientPool.Get().(*http.Client)
 	defer clientPool.Put(client)
 
-	if err := kaitenLimiter.Wait(ctx); err != nil {
-		return nil, fmt.Errorf("failed to wait for rate limiter: %w", err)
-	}
-
-	resp, err := client.Do(req)
+	resp, err := kaitenDo(ctx, client, creates, func() (*http.Request, error) {
+		var body io.Reader
+		if jsonPayload != nil {
+			body = bytes.NewReader(jsonPayload)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, fullURL, body)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Authorization", "Bearer "+kaitenToken)
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -158,10 +268,150 @@ func kaitenAPICallWithContext(ctx context.Context, url string, method string) ([
 	return body, nil
 }
 
-func getKaitenUsers() (interface{}, error) {
+// kaitenDo sends a Kaiten request through the rate limiter and retries it on
+// network errors, 429 and 5xx responses. Requests that create an object are
+// only retried on 429 or when they never reached Kaiten, since a retry after
+// Kaiten got them may create a duplicate. newRequest is called per attempt.
+func kaitenDo(ctx context.Context, client *http.Client, creates bool, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+
+		if err := kaitenLimiter.Wait(ctx); err != nil {
+			return nil, fmt.Errorf("failed to wait for rate limiter: %w", err)
+		}
+
+		var sent atomic.Bool
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+			WroteHeaders: func() { sent.Store(true) },
+		}))
+
+		resp, err := client.Do(req)
+		var retryable bool
+		switch {
+		case creates && err != nil:
+			retryable = !sent.Load()
+		case creates:
+			retryable = resp.StatusCode == http.StatusTooManyRequests
+		default:
+			retryable = err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		}
+		if !retryable || attempt == kaitenMaxAttempts {
+			if err != nil {
+				return nil, fmt.Errorf("failed to send request: %w", err)
+			}
+			return resp, nil
+		}
+
+		wait := backoff
+		if err == nil {
+			if seconds, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && seconds > 0 {
+				wait = time.Duration(seconds) * time.Second
+			}
+			resp.Body.Close()
+			log.Printf("Kaiten responded %d to %s, retrying in %s", resp.StatusCode, req.URL.Path, wait)
+		} else {
+			log.Printf("Kaiten request %s failed: %v, retrying in %s", req.URL.Path, err, wait)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// kaitenDownload opens a Kaiten file for reading. The Kaiten token is only
+// sent to Kaiten hosts, relative URLs are resolved against KAITEN_URL.
+func kaitenDownload(ctx context.Context, fileURL string) (*http.Response, error) {
+	if err := initKaitenEnv(); err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(fileURL, "/") {
+		fileURL = kaitenURL + fileURL
+	}
+
+	resp, err := kaitenDo(ctx, streamClient, false, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", fileURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		if isKaitenFileURL(fileURL) {
+			req.Header.Set("Authorization", "Bearer "+kaitenToken)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+	}
+	return resp, nil
+}
+
+// isKaitenFileURL reports whether the URL points at the Kaiten instance or
+// Kaiten's file storage.
+func isKaitenFileURL(fileURL string) bool {
+	if strings.HasPrefix(fileURL, "/") {
+		return true
+	}
+	parsed, err := url.Parse(fileURL)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if base, err := url.Parse(kaitenURL); err == nil && strings.EqualFold(base.Hostname(), host) {
+		return true
+	}
+	return strings.HasSuffix(host, ".kaiten.ru") || strings.HasSuffix(host, ".kaiten.io")
+}
+
+func kaitenCardURL(cardId string) string {
+	return kaitenURL + "/card/" + cardId
+}
+
+func getKaitenUsers() ([]byte, error) {
 	return kaitenAPICall("/api/latest/users", "GET")
 }
 
+// getKaitenUserList returns the users of the Kaiten company. Users whose
+// company role cannot be read are skipped and logged.
+func getKaitenUserList() ([]KaitenUser, error) {
+	body, err := getKaitenUsers()
+	if err != nil {
+		return nil, err
+	}
+	var rawUsers []any
+	if err := json.Unmarshal(body, &rawUsers); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+
+	var users []KaitenUser
+	for _, rawUser := range rawUsers {
+		userMap, ok := rawUser.(map[string]any)
+		if !ok {
+			continue
+		}
+		user, ok, err := parseKaitenUser(userMap)
+		if err != nil {
+			log.Printf("Skipping Kaiten user: %v", err)
+			continue
+		}
+		if ok {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
 func getKaitenTags() (map[float64]KaitenTag, error) {
 	body, err := kaitenAPICall("/api/latest/tags", "GET")
 	if err != nil {
@@ -171,7 +421,7 @@ func getKaitenTags() (map[float64]KaitenTag, error) {
 	type Tag struct {
 		ID    float64 `json:"id"`
 		Name  string  `json:"name"`
-		Color float64 `json:"color"`
+		Color any     `json:"color"`
 	}
 
 	var tags []Tag
@@ -181,16 +431,65 @@ func getKaitenTags() (map[float64]KaitenTag, error) {
 
 	result := make(map[float64]KaitenTag)
 	for _, tag := range tags {
+		color, colorHex := kaitenColor(tag.Color)
 		result[tag.ID] = KaitenTag{
-			Name:  tag.Name,
-			Id:    tag.ID,
-			Color: tag.Color,
+			Name:     tag.Name,
+			Id:       tag.ID,
+			Color:    color,
+			ColorHex: colorHex,
 		}
 	}
 
 	return result, nil
 }
 
+// getKaitenCustomProperties returns company custom property definitions keyed
+// the same way card properties are ("id_<property id>").
+func getKaitenCustomProperties() (map[string]KaitenCustomProperty, error) {
+	body, err := kaitenAPICall("/api/latest/company/custom-properties", "GET")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get custom properties from Kaiten: %w", err)
+	}
+
+	var jsonProperties []KaitenCustomProperty
+	if err := json.Unmarshal(body, &jsonProperties); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON response: %w", err)
+	}
+
+	result := make(map[string]KaitenCustomProperty, len(jsonProperties))
+	for _, property := range jsonProperties {
+		if property.Type == "select" || property.Type == "multi_select" {
+			values, err := getKaitenCustomPropertySelectValues(property.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get values of property %s: %w", property.Name, err)
+			}
+			property.SelectValues = values
+		}
+		result["id_"+strconv.FormatFloat(property.ID, 'f', -1, 64)] = property
+	}
+	return result, nil
+}
+
+func getKaitenCustomPropertySelectValues(propertyId float64) (map[string]string, error) {
+	body, err := kaitenAPICall("/api/latest/company/custom-properties/"+strconv.FormatFloat(propertyId, 'f', -1, 64)+"/select-values", "GET")
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	var jsonValues []struct {
+		ID    float64 `json:"id"`
+		Value string  `json:"value"`
+	}
+	if err := json.Unmarshal(body, &jsonValues); err != nil {
+		return nil, fmt.Errorf("error parsing JSON: %w", err)
+	}
+	values := make(map[string]string, len(jsonValues))
+	for _, value := range jsonValues {
+		values[strconv.FormatFloat(value.ID, 'f', -1, 64)] = value.Value
+	}
+	return values, nil
+}
+
 func getKaitenSpaces() (map[string]KaitenSpace, error) {
 	body, err := kaitenAPICall("/api/latest/spaces", "GET")
 
@@ -258,6 +557,95 @@ func getKaitenBoardsForSpace(space KaitenSpace) ([]KaitenBoard, error) {
 
 }
 
+// getKaitenSpaceAccess returns the users and groups with access to a space.
+func getKaitenSpaceAccess(spaceId float64) ([]KaitenAccess, error) {
+	id := formatKaitenID(spaceId)
+	users, err := getKaitenAccessList("/api/latest/spaces/" + id + "/users")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users of space %s: %w", id, err)
+	}
+	groups, err := getKaitenAccessList("/api/latest/spaces/" + id + "/groups")
+	if err != nil {
+		log.Printf("Error getting groups of space %s, using direct access only: %v", id, err)
+	}
+	return append(users, groups...), nil
+}
+
+// getKaitenBoardAccess returns access granted on the board itself. Boards
+// without their own access list inherit the space access.
+func getKaitenBoardAccess(boardId float64) ([]KaitenAccess, error) {
+	return getKaitenAccessList("/api/latest/boards/" + formatKaitenID(boardId) + "/users")
+}
+
+// getKaitenGroupUsers returns the IDs of the group's members.
+func getKaitenGroupUsers(groupUID string) ([]float64, error) {
+	body, err := kaitenAPICall("/api/latest/company/groups/"+groupUID+"/users", "GET")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users of group %s: %w", groupUID, err)
+	}
+	var users []map[string]interface{}
+	if err := json.Unmarshal(body, &users); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON response: %w", err)
+	}
+	var ids []float64
+	for _, user := range users {
+		if id, ok := user["id"].(float64); ok {
+			ids = append(ids, id)
+		} else if id, ok := user["user_id"].(float64); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func getKaitenAccessList(url string) ([]KaitenAccess, error) {
+	body, err := kaitenAPICall(url, "GET")
+	if err != nil {
+		return nil, err
+	}
+	var entries []map[string]interface{}
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON response: %w", err)
+	}
+
+	var access []KaitenAccess
+	for _, entry := range entries {
+		item := KaitenAccess{}
+		item.Email, _ = entry["email"].(string)
+		if groupUID, ok := entry["group_uid"].(string); ok {
+			item.GroupUID = groupUID
+		} else if _, isUser := entry["email"]; !isUser {
+			item.GroupUID, _ = entry["uid"].(string)
+		}
+		if item.GroupUID != "" {
+			item.GroupName, _ = entry["title"].(string)
+			if item.GroupName == "" {
+				item.GroupName, _ = entry["name"].(string)
+			}
+		}
+		if id, ok := entry["user_id"].(float64); ok {
+			item.UserID = id
+		} else if id, ok := entry["id"].(float64); ok && item.GroupUID == "" {
+			item.UserID = id
+		}
+		if item.UserID == 0 && item.Email == "" && item.GroupUID == "" {
+			continue
+		}
+		if item.Role, err = kaitenAccessRole(entry); err != nil {
+			subject := item.Email
+			if item.GroupUID != "" {
+				subject = "group " + item.GroupUID
+			} else if subject == "" {
+				subject = "user " + formatKaitenID(item.UserID)
+			}
+			log.Printf("Skipping access of %s listed at %s: %v", subject, url, err)
+			continue
+		}
+		access = append(access, item)
+	}
+	return access, nil
+}
+
 func getKaitenColumnsForBoard(boardId float64) ([]KaitenColumn, error) {
 	body, err := kaitenAPICall("/api/latest/boards/"+strconv.FormatFloat(boardId, 'f', -1, 64)+"/columns", "GET")
 	if err != nil {
@@ -281,6 +669,27 @@ func getKaitenColumnsForBoard(boardId float64) ([]KaitenColumn, error) {
 	return columns, nil
 }
 
+func getKaitenLanesForBoard(boardId float64) ([]KaitenLane, error) {
+	body, err := kaitenAPICall("/api/latest/boards/"+strconv.FormatFloat(boardId, 'f', -1, 64)+"/lanes", "GET")
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	var jsonLanes []map[string]any
+	if err := json.Unmarshal(body, &jsonLanes); err != nil {
+		return nil, fmt.Errorf("error parsing JSON: %w", err)
+	}
+	var lanes []KaitenLane
+	for _, jsonLane := range jsonLanes {
+		lane := KaitenLane{BoardID: boardId}
+		lane.ID, _ = jsonLane["id"].(float64)
+		lane.Title, _ = jsonLane["title"].(string)
+		lane.SortOrder, _ = jsonLane["sort_order"].(float64)
+		lanes = append(lanes, lane)
+	}
+	return lanes, nil
+}
+
 func getKaitenCardsForColumn(columnId float64) ([]KaitenCard, error) {
 	body, err := kaitenAPICall("/api/latest/cards?column_ids="+strconv.FormatFloat(columnId, 'f', -1, 64), "GET")
 	if err != nil {
@@ -324,12 +733,7 @@ func getKaitenCardById(cardId float64) (KaitenCard, error) {
 	}
 	card.ID = jsonCard["id"].(float64)
 	card.Title = jsonCard["title"].(string)
-	if jsonCard["description"] == nil || jsonCard["description"] == "" {
-		card.Description = " "
-
-	} else {
-		card.Description = jsonCard["description"].(string)
-	}
+	card.Description, _ = jsonCard["description"].(string)
 	if jsonCard["archived"] != nil {
 		card.Archived = jsonCard["archived"].(bool)
 	} else {
@@ -367,19 +771,73 @@ func getKaitenCardById(cardId float64) (KaitenCard, error) {
 
 	if jsonCard["members"] != nil {
 		for _, member := range jsonCard["members"].([]interface{}) {
-			card.Members = append(card.Members, member.(map[string]interface{})["email"].(string))
+			memberMap, ok := member.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			var cardMember KaitenCardMember
+			cardMember.Email, _ = memberMap["email"].(string)
+			cardMember.FullName, _ = memberMap["full_name"].(string)
+			cardMember.Type, _ = memberMap["type"].(float64)
+			card.Members = append(card.Members, cardMember)
 		}
 	}
-	if jsonCard["properties"] != nil {
-		if jsonCard["properties"].(map[string]interface{}) != nil {
-			for _, value := range jsonCard["properties"].(map[string]interface{}) {
-				card.Description = "## Детализация\n\n" + value.(string) + "\n\n## Описание" + card.Description
+	if cardType, ok := jsonCard["type"].(map[string]interface{}); ok {
+		card.Type.ID, _ = cardType["id"].(float64)
+		card.Type.Name, _ = cardType["name"].(string)
+		card.Type.Letter, _ = cardType["letter"].(string)
+		card.Type.Color, card.Type.ColorHex = kaitenColor(cardType["color"])
+	}
+	card.State, _ = jsonCard["state"].(float64)
+	card.Size, _ = jsonCard["size"].(float64)
+	card.SizeText, _ = jsonCard["size_text"].(string)
+	card.ParentIds = kaitenRelatedCardIds(jsonCard, "parents_ids", "parents")
+	card.ChildIds = kaitenRelatedCardIds(jsonCard, "children_ids", "children")
+	if blockers, ok := jsonCard["blockers"].([]interface{}); ok {
+		for _, blocker := range blockers {
+			blockerMap, ok := blocker.(map[string]interface{})
+			if !ok {
+				continue
 			}
+			var kaitenBlocker KaitenBlocker
+			kaitenBlocker.ID, _ = blockerMap["id"].(float64)
+			kaitenBlocker.Reason, _ = blockerMap["reason"].(string)
+			kaitenBlocker.BlockerCardID, _ = blockerMap["blocker_card_id"].(float64)
+			kaitenBlocker.BlockerCardTitle, _ = blockerMap["blocker_card_title"].(string)
+			kaitenBlocker.Released, _ = blockerMap["released"].(bool)
+			card.Blockers = append(card.Blockers, kaitenBlocker)
 		}
 	}
+	if properties, ok := jsonCard["properties"].(map[string]interface{}); ok && len(properties) > 0 {
+		card.Properties = properties
+	}
 	return card, nil
 }
 
+// kaitenRelatedCardIds reads related card IDs either from a plain ID list or
+// from a list of embedded card objects.
+func kaitenRelatedCardIds(jsonCard map[string]any, idsKey string, cardsKey string) []float64 {
+	var ids []float64
+	if list, ok := jsonCard[idsKey].([]interface{}); ok {
+		for _, id := range list {
+			if id, ok := id.(float64); ok {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+	if list, ok := jsonCard[cardsKey].([]interface{}); ok {
+		for _, related := range list {
+			if relatedMap, ok := related.(map[string]interface{}); ok {
+				if id, ok := relatedMap["id"].(float64); ok {
+					ids = append(ids, id)
+				}
+			}
+		}
+	}
+	return ids
+}
+
 func getKaitenCommentsForCard(cardId float64) ([]KaitenComment, error) {
 	body, err := kaitenAPICall("/api/latest/cards/"+strconv.FormatFloat(cardId, 'f', -1, 64)+"/comments", "GET")
 	if err != nil {
@@ -396,12 +854,21 @@ func getKaitenCommentsForCard(cardId float64) ([]KaitenComment, error) {
 	}
 	var comments []KaitenComment
 	for _, cmt := range jsonComments {
-		comments = append(comments, KaitenComment{
-			ID:          cmt.(map[string]interface{})["id"].(float64),
-			AuthorEmail: cmt.(map[string]interface{})["author"].(map[string]interface{})["email"].(string),
-			CreatedAt:   cmt.(map[string]interface{})["created"].(string),
-			Text:        cmt.(map[string]interface{})["text"].(string),
-		})
+		cmtMap, ok := cmt.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var comment KaitenComment
+		comment.ID, _ = cmtMap["id"].(float64)
+		comment.CreatedAt, _ = cmtMap["created"].(string)
+		comment.Text, _ = cmtMap["text"].(string)
+		if author, ok := cmtMap["author"].(map[string]interface{}); ok {
+			comment.AuthorEmail, _ = author["email"].(string)
+		}
+		if comment.AuthorEmail == "" {
+			comment.Text = "**" + unknownAuthorName + "**:\n\n" + comment.Text
+		}
+		comments = append(comments, comment)
 	}
 	return comments, nil
 }
@@ -420,15 +887,80 @@ func getKaitenAttachmentsForCard(cardId float64) ([]KaitenAttachment, error) {
 	}
 	var kaitenAttachments []KaitenAttachment
 	for _, att := range attachmentsInterface {
-		kaitenAttachments = append(kaitenAttachments, KaitenAttachment{
-			Name: att.(map[string]interface{})["name"].(string),
-			URL:  att.(map[string]interface{})["url"].(string),
-		})
-
+		attMap, ok := att.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var attachment KaitenAttachment
+		attachment.URL, _ = attMap["url"].(string)
+		if attachment.URL == "" {
+			log.Printf("Skipping attachment of card %s without URL", formatKaitenID(cardId))
+			continue
+		}
+		attachment.Name, _ = attMap["name"].(string)
+		if attachment.Name == "" {
+			attachment.Name = inlineImageName(attachment.URL)
+		}
+		attachment.ID, _ = attMap["id"].(float64)
+		attachment.Size, _ = attMap["size"].(float64)
+		attachment.MimeType, _ = attMap["mime_type"].(string)
+		attachment.CreatedAt, _ = attMap["created"].(string)
+		attachment.Cover, _ = attMap["card_cover"].(bool)
+		if author, ok := attMap["author"].(map[string]interface{}); ok {
+			attachment.AuthorEmail, _ = author["email"].(string)
+			attachment.AuthorName, _ = author["full_name"].(string)
+		}
+		kaitenAttachments = append(kaitenAttachments, attachment)
 	}
 	return kaitenAttachments, nil
 }
 
+func getKaitenSubscribersForCard(cardId float64) ([]string, error) {
+	body, err := kaitenAPICall("/api/latest/cards/"+strconv.FormatFloat(cardId, 'f', -1, 64)+"/subscribers", "GET")
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	var jsonSubscribers []map[string]interface{}
+	if err := json.Unmarshal(body, &jsonSubscribers); err != nil {
+		return nil, fmt.Errorf("error parsing JSON: %w", err)
+	}
+	var emails []string
+	for _, subscriber := range jsonSubscribers {
+		if email, ok := subscriber["email"].(string); ok && email != "" {
+			emails = append(emails, email)
+		}
+	}
+	return emails, nil
+}
+
+func getKaitenTimeLogsForCard(cardId float64) ([]KaitenTimeLog, error) {
+	body, err := kaitenAPICall("/api/latest/cards/"+strconv.FormatFloat(cardId, 'f', -1, 64)+"/time-logs", "GET")
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	var jsonLogs []map[string]interface{}
+	if err := json.Unmarshal(body, &jsonLogs); err != nil {
+		return nil, fmt.Errorf("error parsing JSON: %w", err)
+	}
+	var timeLogs []KaitenTimeLog
+	for _, jsonLog := range jsonLogs {
+		var timeLog KaitenTimeLog
+		timeLog.ID, _ = jsonLog["id"].(float64)
+		timeLog.UserID, _ = jsonLog["user_id"].(float64)
+		timeLog.Minutes, _ = jsonLog["time_spent"].(float64)
+		timeLog.ForDate, _ = jsonLog["for_date"].(string)
+		timeLog.Comment, _ = jsonLog["comment"].(string)
+		if user, ok := jsonLog["user"].(map[string]interface{}); ok {
+			timeLog.UserName, _ = user["full_name"].(string)
+			timeLog.UserEmail, _ = user["email"].(string)
+		}
+		timeLogs = append(timeLogs, timeLog)
+	}
+	return timeLogs, nil
+}
+
 func getKaitenChecklistsForCard(cardId float64, checklistId float64) (KaitenChecklist, error) {
 	data, err := kaitenAPICall("/api/latest/cards/"+strconv.FormatFloat(cardId, 'f', -1, 64)+"/checklists/"+strconv.FormatFloat(checklistId, 'f', -1, 64), "GET")
 	if err != nil {
@@ -438,17 +970,214 @@ func getKaitenChecklistsForCard(cardId float64, checklistId float64) (KaitenChec
 	if err := json.Unmarshal(data, &checklistJson); err != nil {
 		return KaitenChecklist{}, fmt.Errorf("error parsing JSON: %w", err)
 	}
-	var checklistItemsJson []interface{}
-	checklistItemsJson = checklistJson.(map[string]interface{})["items"].([]interface{})
-	var checklistItems []KaitenChecklistItem
+	checklistMap, ok := checklistJson.(map[string]interface{})
+	if !ok {
+		return KaitenChecklist{}, fmt.Errorf("checklist %s is not an object", formatKaitenID(checklistId))
+	}
 	var checklist KaitenChecklist
-	checklist.Name = checklistJson.(map[string]interface{})["name"].(string)
-	for _, item := range checklistItemsJson {
-		checklistItems = append(checklistItems, KaitenChecklistItem{
-			Text:    item.(map[string]interface{})["text"].(string),
-			Checked: item.(map[string]interface{})["checked"].(bool),
-		})
-		checklist.Items = checklistItems
+	checklist.Name, _ = checklistMap["name"].(string)
+	items, _ := checklistMap["items"].([]interface{})
+	for _, item := range items {
+		itemMap, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var checklistItem KaitenChecklistItem
+		checklistItem.Text, _ = itemMap["text"].(string)
+		checklistItem.Checked, _ = itemMap["checked"].(bool)
+		checklist.Items = append(checklist.Items, checklistItem)
 	}
 	return checklist, nil
 }
+
+// kaitenCreate posts the payload and returns the ID of the created object.
+func kaitenCreate(url string, method string, payload any) (float64, error) {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("error marshalling payload: %w", err)
+	}
+	body, err := kaitenAPISend(context.Background(), url, method, jsonPayload, true)
+	if err != nil {
+		return 0, err
+	}
+	var created struct {
+		ID float64 `json:"id"`
+	}
+	if err := json.Unmarshal(body, &created); err != nil {
+		return 0, fmt.Errorf("error parsing JSON: %w", err)
+	}
+	return created.ID, nil
+}
+
+func kaitenUpdate(url string, payload any) error {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshalling payload: %w", err)
+	}
+	_, err = kaitenAPISend(context.Background(), url, "PATCH", jsonPayload, false)
+	return err
+}
+
+func getKaitenCurrentUser() (KaitenUser, error) {
+	body, err := kaitenAPICall("/api/latest/users/current", "GET")
+	if err != nil {
+		return KaitenUser{}, fmt.Errorf("failed to get current Kaiten user: %w", err)
+	}
+	var userMap map[string]any
+	if err := json.Unmarshal(body, &userMap); err != nil {
+		return KaitenUser{}, fmt.Errorf("error parsing JSON: %w", err)
+	}
+	user, _, err := parseKaitenUser(userMap)
+	return user, err
+}
+
+func createKaitenSpace(title string) (float64, error) {
+	return kaitenCreate("/api/latest/spaces", "POST", map[string]any{"title": title})
+}
+
+func addKaitenSpaceUser(spaceId float64, userId float64, roleId float64) error {
+	_, err := kaitenCreate("/api/latest/spaces/"+formatKaitenID(spaceId)+"/users", "POST", map[string]any{"user_id": userId, "role_id": roleId})
+	return err
+}
+
+func createKaitenBoard(spaceId float64, title string) (float64, error) {
+	return kaitenCreate("/api/latest/spaces/"+formatKaitenID(spaceId)+"/boards", "POST", map[string]any{"title": title})
+}
+
+func createKaitenLane(boardId float64, title string) (float64, error) {
+	return kaitenCreate("/api/latest/boards/"+formatKaitenID(boardId)+"/lanes", "POST", map[string]any{"title": title})
+}
+
+func createKaitenColumn(boardId float64, title string, sortOrder float64) (float64, error) {
+	return kaitenCreate("/api/latest/boards/"+formatKaitenID(boardId)+"/columns", "POST", map[string]any{"title": title, "sort_order": sortOrder})
+}
+
+func createKaitenCard(fields map[string]any) (float64, error) {
+	return kaitenCreate("/api/latest/cards", "POST", fields)
+}
+
+func updateKaitenCard(cardId float64, fields map[string]any) error {
+	return kaitenUpdate("/api/latest/cards/"+formatKaitenID(cardId), fields)
+}
+
+func addKaitenCardMember(cardId float64, userId float64) error {
+	_, err := kaitenCreate("/api/latest/cards/"+formatKaitenID(cardId)+"/members", "POST", map[string]any{"user_id": userId})
+	return err
+}
+
+func addKaitenCardSubscriber(cardId float64, userId float64) error {
+	_, err := kaitenCreate("/api/latest/cards/"+formatKaitenID(cardId)+"/subscribers", "POST", map[string]any{"user_id": userId})
+	return err
+}
+
+// addKaitenCardTag tags the card, creating the company-wide tag on first use.
+func addKaitenCardTag(cardId float64, name string) error {
+	_, err := kaitenCreate("/api/latest/cards/"+formatKaitenID(cardId)+"/tags", "POST", map[string]any{"name": name})
+	return err
+}
+
+func createKaitenComment(cardId float64, text string) (float64, error) {
+	return kaitenCreate("/api/latest/cards/"+formatKaitenID(cardId)+"/comments", "POST", map[string]any{"text": text})
+}
+
+func updateKaitenComment(cardId float64, commentId float64, text string) error {
+	return kaitenUpdate("/api/latest/cards/"+formatKaitenID(cardId)+"/comments/"+formatKaitenID(commentId), map[string]any{"text": text})
+}
+
+func createKaitenChecklist(cardId float64, name string) (float64, error) {
+	return kaitenCreate("/api/latest/cards/"+formatKaitenID(cardId)+"/checklists", "POST", map[string]any{"name": name})
+}
+
+func createKaitenChecklistItem(cardId float64, checklistId float64, text string, checked bool) (float64, error) {
+	return kaitenCreate("/api/latest/cards/"+formatKaitenID(cardId)+"/checklists/"+formatKaitenID(checklistId)+"/items", "POST", map[string]any{"text": text, "checked": checked})
+}
+
+func setKaitenCardCover(cardId float64, fileId float64) error {
+	return kaitenUpdate("/api/latest/cards/"+formatKaitenID(cardId)+"/files/"+formatKaitenID(fileId), map[string]any{"card_cover": true})
+}
+
+// uploadKaitenFile attaches a file to the card. The PUT creates a new file,
+// so it is retried like a create. content is read again when the upload is
+// retried, so it must be seekable to be streamed; other readers
+// are buffered in memory.
+func uploadKaitenFile(cardId float64, content io.Reader, name string, mimeType string) (KaitenAttachment, error) {
+	if err := initKaitenEnv(); err != nil {
+		return KaitenAttachment{}, err
+	}
+	seeker, ok := content.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return KaitenAttachment{}, fmt.Errorf("failed to read file: %w", err)
+		}
+		seeker = bytes.NewReader(data)
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	ctx := context.Background()
+	fileURL := kaitenURL + "/api/latest/cards/" + formatKaitenID(cardId) + "/files"
+	var previous chan struct{}
+	resp, err := kaitenDo(ctx, streamClient, true, func() (*http.Request, error) {
+		// The transport closes the body of a finished attempt, which stops its
+		// writer before the content is rewound.
+		if previous != nil {
+			<-previous
+		}
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		pipeReader, pipeWriter := io.Pipe()
+		writer := multipart.NewWriter(pipeWriter)
+		done := make(chan struct{})
+		previous = done
+		go func() {
+			defer close(done)
+			header := make(textproto.MIMEHeader)
+			header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": "file", "filename": name}))
+			header.Set("Content-Type", mimeType)
+			part, err := writer.CreatePart(header)
+			if err == nil {
+				_, err = io.Copy(part, seeker)
+			}
+			if err == nil {
+				err = writer.Close()
+			}
+			pipeWriter.CloseWithError(err)
+		}()
+
+		req, err := http.NewRequestWithContext(ctx, "PUT", fileURL, pipeReader)
+		if err != nil {
+			pipeReader.Close()
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+kaitenToken)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		return req, nil
+	})
+	if err != nil {
+		return KaitenAttachment{}, fmt.Errorf("failed to upload file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 10*1024*1024))
+	if err != nil {
+		return KaitenAttachment{}, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return KaitenAttachment{}, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+	}
+
+	var uploaded struct {
+		ID       float64 `json:"id"`
+		Name     string  `json:"name"`
+		URL      string  `json:"url"`
+		Size     float64 `json:"size"`
+		MimeType string  `json:"mime_type"`
+	}
+	if err := json.Unmarshal(body, &uploaded); err != nil {
+		return KaitenAttachment{}, fmt.Errorf("error parsing JSON: %w", err)
+	}
+	return KaitenAttachment{ID: uploaded.ID, Name: uploaded.Name, URL: uploaded.URL, Size: uploaded.Size, MimeType: uploaded.MimeType}, nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useKaitenServer points the Kaiten client at a test server.
+func useKaitenServer(t *testing.T, handler http.Handler) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	envInitOnce.Do(func() {})
+	previousURL, previousToken := kaitenURL, kaitenToken
+	kaitenURL, kaitenToken = server.URL, "test-token"
+	t.Cleanup(func() { kaitenURL, kaitenToken = previousURL, previousToken })
+}
+
+func TestUploadKaitenFileRetriesOnlyWhenNothingWasCreated(t *testing.T) {
+	content := strings.Repeat("attachment data ", 64*1024)
+	for _, tc := range []struct {
+		name         string
+		firstStatus  int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{"rate limited upload is sent again from the start", http.StatusTooManyRequests, 2, false},
+		{"failed upload is not sent again", http.StatusServiceUnavailable, 1, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var received []string
+			useKaitenServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPut || r.URL.Path != "/api/latest/cards/7/files" {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				}
+				_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+				if err != nil {
+					t.Fatalf("bad content type: %v", err)
+				}
+				part, err := multipart.NewReader(r.Body, params["boundary"]).NextPart()
+				if err != nil {
+					t.Fatalf("bad form: %v", err)
+				}
+				data, err := io.ReadAll(part)
+				if err != nil {
+					t.Fatalf("reading upload: %v", err)
+				}
+				received = append(received, string(data))
+				if len(received) == 1 {
+					w.WriteHeader(tc.firstStatus)
+					return
+				}
+				w.Write([]byte(`{"id": 1, "name": "notes.txt", "size": 1048576}`))
+			}))
+
+			attachment, err := uploadKaitenFile(7, bytes.NewReader([]byte(content)), "notes.txt", "text/plain")
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("upload error = %v, want error %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && attachment.Name != "notes.txt" {
+				t.Errorf("attachment name = %q", attachment.Name)
+			}
+			if len(received) != tc.wantAttempts {
+				t.Fatalf("got %d attempts, want %d", len(received), tc.wantAttempts)
+			}
+			for i, data := range received {
+				if data != content {
+					t.Errorf("attempt %d sent %d bytes, want %d", i+1, len(data), len(content))
+				}
+			}
+		})
+	}
+}
+
+func TestKaitenDownloadFailsWhenStalled(t *testing.T) {
+	streamClient.CloseIdleConnections()
+	previous := streamIdleTimeout
+	streamIdleTimeout = 100 * time.Millisecond
+	t.Cleanup(func() {
+		streamClient.CloseIdleConnections()
+		streamIdleTimeout = previous
+	})
+
+	release := make(chan struct{})
+	defer close(release)
+	useKaitenServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "10")
+		w.Write([]byte("part"))
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+
+	resp, err := kaitenDownload(t.Context(), "/files/stalled.bin")
+	if err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(resp.Body)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("stalled download finished without an error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stalled download did not time out")
+	}
+}
+
+func TestKaitenUsersWithBadRolesAreSkipped(t *testing.T) {
+	useKaitenServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `[
+			{"id": 1, "email": "ann@example.com", "role": 1},
+			{"id": 2, "email": "bob@example.com", "role": 7},
+			{"id": 3, "email": "carol@example.com"},
+			{"id": 4, "email": "dave@example.com", "role": 3}
+		]`)
+	}))
+
+	users, err := getKaitenUserList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var emails []string
+	for _, user := range users {
+		emails = append(emails, user.Email)
+	}
+	if got := strings.Join(emails, ","); got != "ann@example.com,dave@example.com" {
+		t.Errorf("users = %s, want ann and dave", got)
+	}
+}
+
+func TestKaitenAccessWithBadRolesIsSkipped(t *testing.T) {
+	useKaitenServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `[
+			{"user_id": 1, "email": "ann@example.com", "role_id": 3},
+			{"user_id": 2, "email": "bob@example.com", "role_id": 9},
+			{"group_uid": "g1", "title": "Support"},
+			{"user_id": 4, "email": "dave@example.com", "role_id": 1}
+		]`)
+	}))
+
+	access, err := getKaitenAccessList("/api/latest/spaces/1/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range access {
+		got = append(got, entry.Email+"="+entry.Role)
+	}
+	if strings.Join(got, ",") != "ann@example.com=owner,dave@example.com=reader" {
+		t.Errorf("access = %v, want ann as owner and dave as reader", got)
+	}
+}
+
+func TestKaitenCommentsAndChecklistsWithNullAuthors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/latest/cards/7/comments", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `[
+			{"id": 1, "text": "Готово", "created": "2024-03-01T10:00:00Z", "author": {"email": "ann@example.com"}},
+			{"id": 2, "text": "Кто это написал?", "created": "2024-03-02T10:00:00Z", "author": null},
+			{"id": 3, "text": null, "author": {"email": null}}
+		]`)
+	})
+	mux.HandleFunc("GET /api/latest/cards/7/checklists/5", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"name": "Шаги", "author": null, "items": [
+			{"text": "Первый", "checked": true, "author": null},
+			null,
+			{"text": "Второй", "checked": null}
+		]}`)
+	})
+	useKaitenServer(t, mux)
+
+	comments, err := getKaitenCommentsForCard(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []KaitenComment{
+		{ID: 1, AuthorEmail: "ann@example.com", CreatedAt: "2024-03-01T10:00:00Z", Text: "Готово"},
+		{ID: 2, CreatedAt: "2024-03-02T10:00:00Z", Text: "**Неизвестный автор**:\n\nКто это написал?"},
+		{ID: 3, Text: "**Неизвестный автор**:\n\n"},
+	}
+	if len(comments) != len(want) {
+		t.Fatalf("comments = %+v, want %+v", comments, want)
+	}
+	for i := range want {
+		if comments[i] != want[i] {
+			t.Errorf("comment %d = %+v, want %+v", i, comments[i], want[i])
+		}
+	}
+
+	checklist, err := getKaitenChecklistsForCard(7, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checklist.Name != "Шаги" || len(checklist.Items) != 2 || checklist.Items[0] != (KaitenChecklistItem{Text: "Первый", Checked: true}) || checklist.Items[1] != (KaitenChecklistItem{Text: "Второй"}) {
+		t.Errorf("checklist = %+v", checklist)
+	}
+}
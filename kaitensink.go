@@ -0,0 +1,540 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// kaitenSink writes to a Kaiten account through its REST API, for migrating
+// back from PLANKA. Sink IDs are Kaiten IDs formatted as strings. Labels are
+// Kaiten's company-wide tags and are identified by name.
+type kaitenSink struct {
+	account KaitenUser
+
+	mu     sync.Mutex
+	users  map[string]float64
+	spaces map[string]float64
+	lanes  map[string]float64
+	// columns, checklists and comments hold the board or card each of them
+	// belongs to, since Kaiten addresses them through it.
+	columns    map[string]float64
+	checklists map[string]float64
+	comments   map[string]float64
+	// spaceUsers holds the users added to each space, who keep their first
+	// role there.
+	spaceUsers map[float64]map[float64]bool
+}
+
+func newKaitenSink() (*kaitenSink, error) {
+	if err := initKaitenEnv(); err != nil {
+		return nil, fmt.Errorf("cannot get variable values for Kaiten API: %w", err)
+	}
+	account, err := getKaitenCurrentUser()
+	if err != nil {
+		return nil, err
+	}
+	return &kaitenSink{
+		account:    account,
+		users:      make(map[string]float64),
+		spaces:     make(map[string]float64),
+		lanes:      make(map[string]float64),
+		columns:    make(map[string]float64),
+		checklists: make(map[string]float64),
+		comments:   make(map[string]float64),
+		spaceUsers: make(map[float64]map[float64]bool),
+	}, nil
+}
+
+func parseKaitenID(id string) (float64, error) {
+	value, err := strconv.ParseFloat(id, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Kaiten ID %q", id)
+	}
+	return value, nil
+}
+
+// parent looks up the board or card a column, checklist or comment was
+// created in.
+func (s *kaitenSink) parent(parents map[string]float64, id string) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	parentId, ok := parents[id]
+	if !ok {
+		return 0, fmt.Errorf("object %s was not created by this run", id)
+	}
+	return parentId, nil
+}
+
+func (s *kaitenSink) AccountEmail() string {
+	return s.account.Email
+}
+
+func (s *kaitenSink) Users() ([]PlankaUserInfo, error) {
+	kaitenUsers, err := getKaitenUserList()
+	if err != nil {
+		return nil, err
+	}
+	users := make([]PlankaUserInfo, 0, len(kaitenUsers))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range kaitenUsers {
+		s.users[user.Email] = user.ID
+		users = append(users, PlankaUserInfo{ID: formatKaitenID(user.ID), Email: user.Email, Username: user.Username, Name: user.FullName})
+	}
+	return users, nil
+}
+
+// CreateUser fails: Kaiten users join a company by invitation, which the
+// migrator cannot accept for them.
+func (s *kaitenSink) CreateUser(user PlankaUser) (string, error) {
+	return "", fmt.Errorf("user %s is not in the Kaiten company, invite them before the migration", user.Email)
+}
+
+// SetUserRole does nothing, company roles are managed by the Kaiten account
+// owner.
+func (s *kaitenSink) SetUserRole(userId string, role string) error {
+	return nil
+}
+
+// DeactivateUser does nothing, Kaiten licences are managed by the account
+// owner.
+func (s *kaitenSink) DeactivateUser(userId string) error {
+	return nil
+}
+
+func (s *kaitenSink) CreateProject(space KaitenSpace) (PlankaProject, error) {
+	spaceId, err := createKaitenSpace(space.Name)
+	if err != nil {
+		return PlankaProject{}, fmt.Errorf("failed to create space: %w", err)
+	}
+	return PlankaProject{Name: space.Name, ID: formatKaitenID(spaceId), KaitenSpaceUID: space.UID}, nil
+}
+
+// addSpaceUser gives the user access to the space. Kaiten grants access per
+// space, so a user keeps the first role they get in it; managers are added
+// before board members and so stay owners.
+func (s *kaitenSink) addSpaceUser(spaceId float64, userId string, role string) error {
+	user, err := parseKaitenID(userId)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if s.spaceUsers[spaceId] == nil {
+		s.spaceUsers[spaceId] = make(map[float64]bool)
+	}
+	added := s.spaceUsers[spaceId][user]
+	s.spaceUsers[spaceId][user] = true
+	s.mu.Unlock()
+	if added {
+		return nil
+	}
+
+	for roleId, name := range kaitenAccessRoleIds {
+		if name == role {
+			return addKaitenSpaceUser(spaceId, user, roleId)
+		}
+	}
+	return fmt.Errorf("no Kaiten space role for %s", role)
+}
+
+func (s *kaitenSink) AddProjectManager(projectId string, userId string) error {
+	spaceId, err := parseKaitenID(projectId)
+	if err != nil {
+		return err
+	}
+	return s.addSpaceUser(spaceId, userId, kaitenAccessOwner)
+}
+
+// CreateBoard keeps the board title without the prefix, since Kaiten boards
+// live in their space. A board needs a lane for cards, one is added when
+// Kaiten did not create it.
+func (s *kaitenSink) CreateBoard(projectId string, board KaitenBoard, prefix string) (PlankaBoard, error) {
+	spaceId, err := parseKaitenID(projectId)
+	if err != nil {
+		return PlankaBoard{}, err
+	}
+	boardId, err := createKaitenBoard(spaceId, board.Title)
+	if err != nil {
+		return PlankaBoard{}, fmt.Errorf("failed to create board: %w", err)
+	}
+	lanes, err := getKaitenLanesForBoard(boardId)
+	if err != nil {
+		return PlankaBoard{}, err
+	}
+	var laneId float64
+	if len(lanes) > 0 {
+		laneId = lanes[0].ID
+	} else if laneId, err = createKaitenLane(boardId, board.Title); err != nil {
+		return PlankaBoard{}, fmt.Errorf("failed to create lane: %w", err)
+	}
+
+	id := formatKaitenID(boardId)
+	s.mu.Lock()
+	s.spaces[id] = spaceId
+	s.lanes[id] = laneId
+	s.mu.Unlock()
+	return PlankaBoard{Name: board.Title, ID: id}, nil
+}
+
+// AddBoardMember adds the user to the board's space: editors as writers,
+// viewers as readers. Kaiten has no space role that only allows comments.
+func (s *kaitenSink) AddBoardMember(boardId string, userId string, role string, canComment bool) error {
+	s.mu.Lock()
+	spaceId, ok := s.spaces[boardId]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("board %s was not created by this run", boardId)
+	}
+	accessRole := kaitenAccessReader
+	if role == "editor" {
+		accessRole = kaitenAccessWriter
+	}
+	return s.addSpaceUser(spaceId, userId, accessRole)
+}
+
+func (s *kaitenSink) CreateList(boardId string, column KaitenColumn) (PlankaList, error) {
+	board, err := parseKaitenID(boardId)
+	if err != nil {
+		return PlankaList{}, err
+	}
+	columnId, err := createKaitenColumn(board, column.Name, column.Position)
+	if err != nil {
+		return PlankaList{}, fmt.Errorf("failed to create column: %w", err)
+	}
+	id := formatKaitenID(columnId)
+	s.mu.Lock()
+	s.columns[id] = board
+	s.mu.Unlock()
+	return PlankaList{ID: id, Name: column.Name}, nil
+}
+
+// CreateCard ignores the card type, which is PLANKA-only.
+func (s *kaitenSink) CreateCard(listId string, card KaitenCard, cardType string) (string, error) {
+	columnId, err := parseKaitenID(listId)
+	if err != nil {
+		return "", err
+	}
+	boardId, err := s.parent(s.columns, listId)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	laneId := s.lanes[formatKaitenID(boardId)]
+	s.mu.Unlock()
+
+	fields := map[string]any{
+		"title":      card.Title,
+		"board_id":   boardId,
+		"column_id":  columnId,
+		"lane_id":    laneId,
+		"sort_order": card.SortOrder,
+	}
+	if description := card.Description; description != "" {
+		fields["description"] = description
+	}
+	if card.DueDate != "" {
+		fields["due_date"] = card.DueDate
+	}
+	cardId, err := createKaitenCard(fields)
+	if err != nil {
+		return "", fmt.Errorf("failed to create card: %w", err)
+	}
+	return formatKaitenID(cardId), nil
+}
+
+// UpdateCard applies the PLANKA card fields Kaiten has, by their PLANKA
+// names, and skips the rest, e.g. the stopwatch.
+func (s *kaitenSink) UpdateCard(cardId string, fields map[string]any) error {
+	card, err := parseKaitenID(cardId)
+	if err != nil {
+		return err
+	}
+	update := make(map[string]any)
+	for name, value := range fields {
+		switch name {
+		case "name":
+			update["title"] = value
+		case "description":
+			update["description"] = value
+		case "dueDate":
+			update["due_date"] = value
+		case "coverAttachmentId":
+			fileId, err := parseKaitenID(fmt.Sprint(value))
+			if err != nil {
+				return err
+			}
+			if err := setKaitenCardCover(card, fileId); err != nil {
+				return err
+			}
+		}
+	}
+	if len(update) == 0 {
+		return nil
+	}
+	return updateKaitenCard(card, update)
+}
+
+func (s *kaitenSink) CardURL(cardId string) string {
+	return kaitenCardURL(cardId)
+}
+
+func (s *kaitenSink) AddCardMember(cardId string, userId string) error {
+	card, err := parseKaitenID(cardId)
+	if err != nil {
+		return err
+	}
+	user, err := parseKaitenID(userId)
+	if err != nil {
+		return err
+	}
+	return addKaitenCardMember(card, user)
+}
+
+func (s *kaitenSink) SubscribeCard(cardId string, email string) error {
+	card, err := parseKaitenID(cardId)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	userId, ok := s.users[email]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no Kaiten user %s", email)
+	}
+	return addKaitenCardSubscriber(card, userId)
+}
+
+// commentText names the author in the text, since the API token writes
+// every comment as its own account.
+func (s *kaitenSink) commentText(authorEmail string, text string) string {
+	if authorEmail == "" || authorEmail == s.account.Email {
+		return text
+	}
+	return "**" + authorEmail + "**:\n\n" + text
+}
+
+func (s *kaitenSink) CreateComment(cardId string, comment KaitenComment) (string, error) {
+	card, err := parseKaitenID(cardId)
+	if err != nil {
+		return "", err
+	}
+	commentId, err := createKaitenComment(card, s.commentText(comment.AuthorEmail, comment.Text))
+	if err != nil {
+		return "", fmt.Errorf("failed to create comment: %w", err)
+	}
+	id := formatKaitenID(commentId)
+	s.mu.Lock()
+	s.comments[id] = card
+	s.mu.Unlock()
+	return id, nil
+}
+
+func (s *kaitenSink) UpdateComment(commentId string, authorEmail string, text string) error {
+	comment, err := parseKaitenID(commentId)
+	if err != nil {
+		return err
+	}
+	card, err := s.parent(s.comments, commentId)
+	if err != nil {
+		return err
+	}
+	return updateKaitenComment(card, comment, s.commentText(authorEmail, text))
+}
+
+// UploadAttachment uploads as the API token's account, Kaiten cannot upload
+// on behalf of other users.
+func (s *kaitenSink) UploadAttachment(cardId string, content io.Reader, name string, mimeType string, authorEmail string) (PlankaAttachment, error) {
+	card, err := parseKaitenID(cardId)
+	if err != nil {
+		return PlankaAttachment{}, err
+	}
+	uploaded, err := uploadKaitenFile(card, content, name, mimeType)
+	if err != nil {
+		return PlankaAttachment{}, err
+	}
+	return PlankaAttachment{
+		ID:       formatKaitenID(uploaded.ID),
+		Name:     uploaded.Name,
+		URL:      uploaded.URL,
+		Size:     int64(uploaded.Size),
+		MimeType: uploaded.MimeType,
+	}, nil
+}
+
+func (s *kaitenSink) OpenAttachment(attachmentURL string) (SourceFile, error) {
+	resp, err := kaitenDownload(context.Background(), attachmentURL)
+	if err != nil {
+		return SourceFile{}, err
+	}
+	return SourceFile{Body: resp.Body, Size: resp.ContentLength, ContentType: resp.Header.Get("Content-Type")}, nil
+}
+
+func (s *kaitenSink) CreateTaskList(cardId string, name string) (string, error) {
+	card, err := parseKaitenID(cardId)
+	if err != nil {
+		return "", err
+	}
+	checklistId, err := createKaitenChecklist(card, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to create checklist: %w", err)
+	}
+	id := formatKaitenID(checklistId)
+	s.mu.Lock()
+	s.checklists[id] = card
+	s.mu.Unlock()
+	return id, nil
+}
+
+func (s *kaitenSink) CreateTask(listId string, task PlankaTask) (string, error) {
+	checklistId, err := parseKaitenID(listId)
+	if err != nil {
+		return "", err
+	}
+	card, err := s.parent(s.checklists, listId)
+	if err != nil {
+		return "", err
+	}
+	itemId, err := createKaitenChecklistItem(card, checklistId, task.Name, task.IsCompleted)
+	if err != nil {
+		return "", fmt.Errorf("failed to create checklist item: %w", err)
+	}
+	return formatKaitenID(itemId), nil
+}
+
+// BoardLabels returns all company tags, which every board shares.
+func (s *kaitenSink) BoardLabels(boardId string) ([]PlankaLabel, error) {
+	tags, err := getKaitenTags()
+	if err != nil {
+		return nil, err
+	}
+	labels := make([]PlankaLabel, 0, len(tags))
+	for _, tag := range tags {
+		labels = append(labels, PlankaLabel{Id: tag.Name, Name: tag.Name})
+	}
+	return labels, nil
+}
+
+// CreateLabel creates nothing yet: Kaiten creates a tag when it is first
+// put on a card.
+func (s *kaitenSink) CreateLabel(boardId string, label PlankaLabel) (PlankaLabel, error) {
+	label.Id = label.Name
+	return label, nil
+}
+
+func (s *kaitenSink) AddCardLabel(cardId string, labelId string) error {
+	card, err := parseKaitenID(cardId)
+	if err != nil {
+		return err
+	}
+	return addKaitenCardTag(card, labelId)
+}
+
+func (s *kaitenSink) CreateCustomFieldGroup(boardId string, name string) (string, error) {
+	return "", fmt.Errorf("custom fields are not supported when migrating to Kaiten")
+}
+
+func (s *kaitenSink) CreateCustomField(groupId string, field PlankaCustomField) (string, error) {
+	return "", fmt.Errorf("custom fields are not supported when migrating to Kaiten")
+}
+
+func (s *kaitenSink) SetCustomFieldValue(cardId string, groupId string, fieldId string, content string) error {
+	return fmt.Errorf("custom fields are not supported when migrating to Kaiten")
+}
+
+// kaitenVerifyTarget reads boards a reverse migration wrote to Kaiten.
+type kaitenVerifyTarget struct {
+	tags map[float64]KaitenTag
+}
+
+func (t *kaitenVerifyTarget) Users() ([]PlankaUserInfo, error) {
+	kaitenUsers, err := getKaitenUserList()
+	if err != nil {
+		return nil, err
+	}
+	if t.tags, err = getKaitenTags(); err != nil {
+		return nil, err
+	}
+	users := make([]PlankaUserInfo, 0, len(kaitenUsers))
+	for _, user := range kaitenUsers {
+		users = append(users, PlankaUserInfo{ID: formatKaitenID(user.ID), Email: user.Email, Username: user.Username, Name: user.FullName})
+	}
+	return users, nil
+}
+
+func (t *kaitenVerifyTarget) CardURL(cardId string) string {
+	return kaitenCardURL(cardId)
+}
+
+func (t *kaitenVerifyTarget) Board(boardId string) (verifyBoard, error) {
+	id, err := parseKaitenID(boardId)
+	if err != nil {
+		return verifyBoard{}, err
+	}
+	columns, err := getKaitenColumnsForBoard(id)
+	if err != nil {
+		return verifyBoard{}, err
+	}
+
+	var board verifyBoard
+	for _, column := range columns {
+		columnId := formatKaitenID(column.Id)
+		board.Lists = append(board.Lists, verifyList{ID: columnId, Name: column.Name})
+
+		cards, err := getKaitenCardsForColumn(column.Id)
+		if err != nil {
+			return verifyBoard{}, err
+		}
+		for _, kaitenCard := range cards {
+			if kaitenCard.Archived {
+				continue
+			}
+			card, err := t.card(kaitenCard)
+			if err != nil {
+				return verifyBoard{}, err
+			}
+			card.ListID = columnId
+			board.Cards = append(board.Cards, card)
+		}
+	}
+	return board, nil
+}
+
+func (t *kaitenVerifyTarget) card(kaitenCard KaitenCard) (verifyCard, error) {
+	card := verifyCard{
+		ID:          formatKaitenID(kaitenCard.ID),
+		Name:        kaitenCard.Title,
+		Description: kaitenCard.Description,
+		DueDate:     kaitenCard.DueDate,
+	}
+	for _, tagId := range kaitenCard.TagIds {
+		card.Labels = append(card.Labels, t.tags[tagId].Name)
+	}
+	for _, member := range kaitenCard.Members {
+		card.Members = append(card.Members, member.Email)
+	}
+	for _, checklistId := range kaitenCard.Checklists {
+		checklist, err := getKaitenChecklistsForCard(kaitenCard.ID, checklistId)
+		if err != nil {
+			return verifyCard{}, err
+		}
+		card.TaskLists = append(card.TaskLists, checklist)
+	}
+
+	comments, err := getKaitenCommentsForCard(kaitenCard.ID)
+	if err != nil {
+		return verifyCard{}, err
+	}
+	card.Comments = len(comments)
+
+	attachments, err := getKaitenAttachmentsForCard(kaitenCard.ID)
+	if err != nil {
+		return verifyCard{}, err
+	}
+	for _, attachment := range attachments {
+		card.Attachments = append(card.Attachments, verifyAttachment{Name: attachment.Name, Size: int64(attachment.Size)})
+	}
+	return card, nil
+}
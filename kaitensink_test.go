@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// kaitenServer is a fake Kaiten API that numbers created objects from 100
+// and records every write as "METHOD path payload".
+type kaitenServer struct {
+	mu     sync.Mutex
+	nextId int
+	writes []string
+}
+
+func useKaitenSinkServer(t *testing.T) *kaitenServer {
+	t.Helper()
+	server := &kaitenServer{nextId: 100}
+	useKaitenServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/latest/users/current":
+			io.WriteString(w, `{"id": 1, "email": "bot@example.com", "role": 1}`)
+			return
+		case r.Method == http.MethodGet && r.URL.Path == "/api/latest/users":
+			io.WriteString(w, `[{"id": 1, "email": "bot@example.com", "role": 1}, {"id": 2, "email": "ann@example.com", "role": 3}]`)
+			return
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/lanes"):
+			io.WriteString(w, `[]`)
+			return
+		}
+		payload, _ := io.ReadAll(r.Body)
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		server.writes = append(server.writes, r.Method+" "+r.URL.Path+" "+strings.TrimSpace(string(payload)))
+		server.nextId++
+		fmt.Fprintf(w, `{"id": %d}`, server.nextId)
+	}))
+	return server
+}
+
+func TestKaitenSinkWritesBoards(t *testing.T) {
+	server := useKaitenSinkServer(t)
+	sink, err := newKaitenSink()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sink.AccountEmail() != "bot@example.com" {
+		t.Errorf("account email = %q", sink.AccountEmail())
+	}
+	if _, err := sink.Users(); err != nil {
+		t.Fatal(err)
+	}
+
+	project, err := sink.CreateProject(KaitenSpace{Name: "Team", UID: "uid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	board, err := sink.CreateBoard(project.ID, KaitenBoard{Title: "Alpha"}, "Team / ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.AddProjectManager(project.ID, "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.AddBoardMember(board.ID, "2", "viewer", true); err != nil {
+		t.Fatal(err)
+	}
+	list, err := sink.CreateList(board.ID, KaitenColumn{Name: "Todo", Position: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cardId, err := sink.CreateCard(list.ID, KaitenCard{Title: "First", Description: "**bold**", SortOrder: 2}, "project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.UpdateCard(cardId, map[string]any{"name": "Renamed", "stopwatch": nil}); err != nil {
+		t.Fatal(err)
+	}
+	commentId, err := sink.CreateComment(cardId, KaitenComment{AuthorEmail: "ann@example.com", Text: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.UpdateComment(commentId, "bot@example.com", "edited"); err != nil {
+		t.Fatal(err)
+	}
+	checklistId, err := sink.CreateTaskList(cardId, "Steps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sink.CreateTask(checklistId, PlankaTask{Name: "plan", IsCompleted: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.SubscribeCard(cardId, "ann@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	label, err := sink.CreateLabel(board.ID, PlankaLabel{Name: "bug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.AddCardLabel(cardId, label.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`POST /api/latest/spaces {"title":"Team"}`,
+		`POST /api/latest/spaces/101/boards {"title":"Alpha"}`,
+		`POST /api/latest/boards/102/lanes {"title":"Alpha"}`,
+		`POST /api/latest/spaces/101/users {"role_id":3,"user_id":2}`,
+		`POST /api/latest/boards/102/columns {"sort_order":1,"title":"Todo"}`,
+		`POST /api/latest/cards {"board_id":102,"column_id":105,"description":"**bold**","lane_id":103,"sort_order":2,"title":"First"}`,
+		`PATCH /api/latest/cards/106 {"title":"Renamed"}`,
+		`POST /api/latest/cards/106/comments {"text":"**ann@example.com**:\n\nhello"}`,
+		`PATCH /api/latest/cards/106/comments/108 {"text":"edited"}`,
+		`POST /api/latest/cards/106/checklists {"name":"Steps"}`,
+		`POST /api/latest/cards/106/checklists/110/items {"checked":true,"text":"plan"}`,
+		`POST /api/latest/cards/106/subscribers {"user_id":2}`,
+		`POST /api/latest/cards/106/tags {"name":"bug"}`,
+	}
+	if !slices.Equal(server.writes, want) {
+		t.Errorf("writes:\n%s\nwant:\n%s", strings.Join(server.writes, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestKaitenSinkRejectsUnknownParents(t *testing.T) {
+	useKaitenSinkServer(t)
+	sink, err := newKaitenSink()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, call := range map[string]func() error{
+		"card in a column of another run": func() error {
+			_, err := sink.CreateCard("5", KaitenCard{Title: "x"}, "")
+			return err
+		},
+		"task in a checklist of another run": func() error {
+			_, err := sink.CreateTask("6", PlankaTask{Name: "x"})
+			return err
+		},
+		"member of a board of another run": func() error { return sink.AddBoardMember("7", "2", "editor", true) },
+		"subscriber outside the company":   func() error { return sink.SubscribeCard("8", "nobody@example.com") },
+		"user that needs an invitation": func() error {
+			_, err := sink.CreateUser(PlankaUser{Email: "new@example.com"})
+			return err
+		},
+	} {
+		if call() == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestKaitenSinkDoesNotRetryFailedCreates(t *testing.T) {
+	var attempts []string
+	useKaitenServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts = append(attempts, r.Method)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"message": "try later"})
+	}))
+
+	if _, err := createKaitenComment(7, "hello"); err == nil {
+		t.Error("failed create returned no error")
+	}
+	if !slices.Equal(attempts, []string{"POST"}) {
+		t.Errorf("attempts = %v, want a single POST", attempts)
+	}
+}
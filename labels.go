@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+const mappingKindLabel = "label"
+
+// Kinds of labels the migrator creates. A tag and a card type, or a tag and
+// the "Blocked" marker, may share a name without sharing a label.
+const (
+	labelKindTag         = "tag"
+	labelKindCardType    = "card type"
+	labelKindBlocked     = "blocked"
+	labelKindResponsible = "responsible"
+	labelKindSize        = "size"
+)
+
+// labelRegistry keeps the labels of every PLANKA board the migrator touches,
+// so a Kaiten tag or a label the migrator adds on its own (card types,
+// "Blocked", ...) is created once per board and shared by all its cards.
+// Labels are keyed by kind and name. Labels already on the board are reused
+// by name, each by the first kind that asks for it, and tag labels are
+// recorded in the mapping store so re-runs find them again. Concurrent
+// callers of the same board or label wait for the one loading or creating
+// it, while other boards and labels go ahead.
+type labelRegistry struct {
+	mu      sync.Mutex
+	sink    Sink
+	mapping *mappingStore
+	colors  map[string]string
+	boards  map[string]*boardLabels
+}
+
+type labelKey struct {
+	kind string
+	name string
+}
+
+// boardLabels are the labels of one board: the ones in use by key, and the
+// ones found on the board that no key has claimed yet.
+type boardLabels struct {
+	byKey     map[labelKey]*labelEntry
+	unclaimed []PlankaLabel
+	all       []PlankaLabel
+	err       error
+	ready     chan struct{}
+}
+
+type labelEntry struct {
+	label PlankaLabel
+	err   error
+	ready chan struct{}
+}
+
+func newLabelRegistry(sink Sink, mapping *mappingStore, colors map[string]string) *labelRegistry {
+	return &labelRegistry{sink: sink, mapping: mapping, colors: colors, boards: make(map[string]*boardLabels)}
+}
+
+// tagLabel is the label a Kaiten tag or card type becomes.
+func (r *labelRegistry) tagLabel(tag KaitenTag) PlankaLabel {
+	return PlankaLabel{Name: tag.Name, Color: plankaLabelColor(tag.Color, tag.ColorHex, r.colors)}
+}
+
+// ensure returns the board label of the given kind with the name of the
+// given label, creating it on first use. Failures are not kept, so a later
+// call tries again.
+func (r *labelRegistry) ensure(boardId string, kind string, wanted PlankaLabel) (PlankaLabel, error) {
+	labels, err := r.board(boardId)
+	if err != nil {
+		return PlankaLabel{}, err
+	}
+	key := labelKey{kind: kind, name: wanted.Name}
+
+	r.mu.Lock()
+	entry, exists := labels.byKey[key]
+	if !exists {
+		entry = &labelEntry{ready: make(chan struct{})}
+		labels.byKey[key] = entry
+		for i, label := range labels.unclaimed {
+			if label.Name == wanted.Name {
+				labels.unclaimed = append(labels.unclaimed[:i], labels.unclaimed[i+1:]...)
+				entry.label = label
+				close(entry.ready)
+				r.mu.Unlock()
+				return label, nil
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	if exists {
+		<-entry.ready
+		return entry.label, entry.err
+	}
+
+	entry.label, entry.err = r.sink.CreateLabel(boardId, wanted)
+	r.mu.Lock()
+	if entry.err != nil {
+		delete(labels.byKey, key)
+	} else {
+		labels.all = append(labels.all, entry.label)
+	}
+	r.mu.Unlock()
+	close(entry.ready)
+	return entry.label, entry.err
+}
+
+// tag returns the board label for a Kaiten tag. A label recorded in the
+// mapping wins over a label with the same name, so renamed labels keep
+// their tag.
+func (r *labelRegistry) tag(boardId string, tag KaitenTag) (PlankaLabel, error) {
+	mappingKey := boardId + "/" + formatKaitenID(tag.Id)
+	if labelId, ok := r.mapping.Get(mappingKindLabel, mappingKey); ok {
+		if label, found := r.claim(boardId, labelKey{kind: labelKindTag, name: tag.Name}, labelId); found {
+			return label, nil
+		}
+	}
+
+	label, err := r.ensure(boardId, labelKindTag, r.tagLabel(tag))
+	if err != nil {
+		return PlankaLabel{}, err
+	}
+	r.mapping.Set(mappingKindLabel, mappingKey, label.Id)
+	return label, nil
+}
+
+// claim finds the board label with the given ID and makes it the label of
+// key unless key already has one.
+func (r *labelRegistry) claim(boardId string, key labelKey, labelId string) (PlankaLabel, bool) {
+	labels, err := r.board(boardId)
+	if err != nil {
+		return PlankaLabel{}, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, label := range labels.unclaimed {
+		if label.Id == labelId {
+			labels.unclaimed = append(labels.unclaimed[:i], labels.unclaimed[i+1:]...)
+			if _, exists := labels.byKey[key]; !exists {
+				entry := &labelEntry{label: label, ready: make(chan struct{})}
+				close(entry.ready)
+				labels.byKey[key] = entry
+			}
+			return label, true
+		}
+	}
+	for _, label := range labels.all {
+		if label.Id == labelId {
+			return label, true
+		}
+	}
+	return PlankaLabel{}, false
+}
+
+// board returns the labels of the board, loading the ones already in PLANKA
+// on first use. Failures are not kept, so a later call tries again.
+func (r *labelRegistry) board(boardId string) (*boardLabels, error) {
+	r.mu.Lock()
+	labels, exists := r.boards[boardId]
+	if !exists {
+		labels = &boardLabels{byKey: make(map[labelKey]*labelEntry), ready: make(chan struct{})}
+		r.boards[boardId] = labels
+	}
+	r.mu.Unlock()
+
+	if exists {
+		<-labels.ready
+		return labels, labels.err
+	}
+
+	existing, err := r.sink.BoardLabels(boardId)
+	r.mu.Lock()
+	if err != nil {
+		labels.err = fmt.Errorf("error loading labels of board %s: %w", boardId, err)
+		delete(r.boards, boardId)
+	} else {
+		labels.unclaimed = append([]PlankaLabel(nil), existing...)
+		labels.all = append([]PlankaLabel(nil), existing...)
+	}
+	r.mu.Unlock()
+	close(labels.ready)
+	return labels, labels.err
+}
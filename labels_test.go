@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// labelSink numbers the labels it creates, so labels with the same name
+// get different IDs.
+type labelSink struct {
+	*recordingSink
+	existing []PlankaLabel
+	created  int
+}
+
+func (s *labelSink) BoardLabels(boardId string) ([]PlankaLabel, error) { return s.existing, nil }
+
+func (s *labelSink) CreateLabel(boardId string, label PlankaLabel) (PlankaLabel, error) {
+	s.created++
+	label.Id = fmt.Sprintf("label:%d", s.created)
+	return label, nil
+}
+
+func TestLabelRegistryKeepsKindsApart(t *testing.T) {
+	sink := &labelSink{recordingSink: newRecordingSink(), existing: []PlankaLabel{{Id: "old", Name: "Blocked"}}}
+	mapping := &mappingStore{Entries: make(map[string]map[string]string)}
+	labels := newLabelRegistry(sink, mapping, nil)
+
+	tag, err := labels.tag("board", KaitenTag{Id: 1, Name: "Blocked"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocked, err := labels.ensure("board", labelKindBlocked, PlankaLabel{Name: "Blocked"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cardType, err := labels.ensure("board", labelKindCardType, PlankaLabel{Name: "Blocked"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Id != "old" {
+		t.Errorf("tag label = %s, want the existing label", tag.Id)
+	}
+	if blocked.Id == tag.Id || cardType.Id == tag.Id || cardType.Id == blocked.Id {
+		t.Errorf("labels of different kinds are shared: tag %s, blocked %s, card type %s", tag.Id, blocked.Id, cardType.Id)
+	}
+
+	again, err := labels.ensure("board", labelKindBlocked, PlankaLabel{Name: "Blocked"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Id != blocked.Id {
+		t.Errorf("blocked label = %s on second use, want %s", again.Id, blocked.Id)
+	}
+	if sink.created != 2 {
+		t.Errorf("created %d labels, want 2", sink.created)
+	}
+
+	rerun := newLabelRegistry(&labelSink{recordingSink: newRecordingSink(), existing: []PlankaLabel{{Id: "label:1", Name: "Blocked"}, {Id: "old", Name: "Blocked"}}}, mapping, nil)
+	tag, err = rerun.tag("board", KaitenTag{Id: 1, Name: "Blocked"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Id != "old" {
+		t.Errorf("tag label = %s on re-run, want the mapped label", tag.Id)
+	}
+}
+
+// slowLabelSink holds the creation of the "slow" label until another label
+// has been created.
+type slowLabelSink struct {
+	*recordingSink
+	other   chan struct{}
+	created sync.Map
+}
+
+func (s *slowLabelSink) BoardLabels(boardId string) ([]PlankaLabel, error) { return nil, nil }
+
+func (s *slowLabelSink) CreateLabel(boardId string, label PlankaLabel) (PlankaLabel, error) {
+	if n, _ := s.created.LoadOrStore(label.Name, new(atomic.Int32)); n.(*atomic.Int32).Add(1) > 1 {
+		return PlankaLabel{}, fmt.Errorf("label %s created twice", label.Name)
+	}
+	if label.Name != "slow" {
+		close(s.other)
+	} else {
+		select {
+		case <-s.other:
+		case <-time.After(5 * time.Second):
+			return PlankaLabel{}, fmt.Errorf("other labels waited for %s", label.Name)
+		}
+	}
+	label.Id = "label:" + label.Name
+	return label, nil
+}
+
+func TestLabelRegistryCreatesLabelsConcurrently(t *testing.T) {
+	sink := &slowLabelSink{recordingSink: newRecordingSink(), other: make(chan struct{})}
+	labels := newLabelRegistry(sink, &mappingStore{Entries: make(map[string]map[string]string)}, nil)
+
+	names := []string{"slow", "slow", "slow", "fast"}
+	errs := make([]error, len(names))
+	wg := &sync.WaitGroup{}
+	wg.Add(len(names))
+	for i, name := range names {
+		go func(i int, name string) {
+			defer wg.Done()
+			if name == "fast" {
+				time.Sleep(10 * time.Millisecond)
+			}
+			var label PlankaLabel
+			label, errs[i] = labels.ensure("board", labelKindTag, PlankaLabel{Name: name})
+			if errs[i] == nil && label.Id != "label:"+name {
+				errs[i] = fmt.Errorf("got %s for %s", label.Id, name)
+			}
+		}(i, name)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
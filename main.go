@@ -1,9 +1,10 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"sync"
@@ -12,7 +13,28 @@ import (
 	"github.com/joho/godotenv"
 )
 
+// File transfers get a generous overall deadline, and a connection is dropped
+// when no data moves in either direction for streamIdleTimeout.
+const streamTimeout = 30 * time.Minute
+
+var streamIdleTimeout = 5 * time.Minute
+
 var (
+	// streamClient is used for file transfers, which may take longer than the
+	// overall timeout of pooled API clients.
+	streamClient = &http.Client{
+		Timeout: streamTimeout,
+		Transport: &http.Transport{
+			DialContext:           dialIdleTimeout,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 5 * time.Minute,
+			ForceAttemptHTTP2:     true,
+		},
+	}
+
 	clientPool = &sync.Pool{
 		New: func() interface{} {
 			return &http.Client{
@@ -30,13 +52,37 @@ var (
 	}
 )
 
+// idleTimeoutConn extends its deadline on every read and write, so a stalled
+// transfer fails instead of hanging. Writes also extend the read deadline: the
+// transport waits for the response while the request body is still sent.
+type idleTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleTimeoutConn) Read(p []byte) (int, error) {
+	c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(p)
+}
+
+func (c *idleTimeoutConn) Write(p []byte) (int, error) {
+	c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Write(p)
+}
+
+func dialIdleTimeout(ctx context.Context, network string, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &idleTimeoutConn{Conn: conn, timeout: streamIdleTimeout}, nil
+}
+
 func init() {
 	if err := godotenv.Load(); err != nil {
 		log.Print("No .env file found")
 	}
-	if err := initPlankaEnv(); err != nil {
-		log.Fatalf("Cannot get variable values for PLANKA API: %v", err)
-	}
 }
 
 func getEnv(name string) (string, error) {
@@ -47,394 +93,364 @@ func getEnv(name string) (string, error) {
 	return val, nil
 }
 
-func main() {
-	wg := &sync.WaitGroup{}
-	errChan := make(chan error, 10)
-
-	wg.Add(2)
-	go func() {
-		defer wg.Done()
-		if err := plankaDeleteUser(); err != nil {
-			errChan <- fmt.Errorf("error deleting Planka users: %v", err)
-		}
-	}()
-
-	go func() {
-		defer wg.Done()
-		if err := deletePlankaProjects(); err != nil {
-			errChan <- fmt.Errorf("error deleting Planka projects: %v", err)
-		}
-	}()
-	wg.Wait()
+func getEnvDefault(name string, defaultValue string) string {
+	if val, exists := os.LookupEnv(name); exists && val != "" {
+		return val
+	}
+	return defaultValue
+}
 
-	select {
-	case err := <-errChan:
-		log.Fatal(err)
-	default:
+const usage = `Usage:
+  kaiten-planka-migrator [migrate]                     migrate Kaiten to PLANKA
+  kaiten-planka-migrator export [dir]                  dump Kaiten into a snapshot directory (default ` + defaultSnapshotDir + `)
+  kaiten-planka-migrator archive [dir]                 write Kaiten boards as offline Markdown or HTML pages (default ` + defaultArchiveDir + `)
+  kaiten-planka-migrator import [dir]                  migrate a snapshot directory to PLANKA
+  kaiten-planka-migrator verify [dir]                  compare Kaiten, or a snapshot directory, with PLANKA
+  kaiten-planka-migrator rollback <run-id>             delete what a migration run created in PLANKA
+  kaiten-planka-migrator trello [--wipe] <path>...     migrate Trello board JSON exports, files or directories, to PLANKA
+  kaiten-planka-migrator jira [--wipe] <path>...       migrate Jira issue CSV or JSON exports, files or directories, to PLANKA
+  kaiten-planka-migrator planka-export [dir]           back up all PLANKA projects with their files (default ` + defaultPlankaBackupDir + `)
+  kaiten-planka-migrator planka-import [--wipe] [dir]  restore a planka-export backup into PLANKA
+  kaiten-planka-migrator reverse                       migrate PLANKA back to Kaiten
+  kaiten-planka-migrator reverse-verify                compare PLANKA with what reverse wrote to Kaiten`
 
+func main() {
+	command := "migrate"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
 	}
 
-	var rawUsers interface{}
-	var emails []string
-	var tags map[float64]KaitenTag
-
-	wg.Add(3)
-	go func() {
-		defer wg.Done()
-		var err error
-		rawUsers, err = getKaitenUsers()
-		if err != nil {
-			errChan <- fmt.Errorf("error getting users from Kaiten: %v", err)
+	var err error
+	switch command {
+	case "migrate":
+		err = runMigrate()
+	case "export":
+		err = runExport(commandArg(defaultSnapshotDir))
+	case "archive":
+		err = runArchive(commandArg(defaultArchiveDir))
+	case "import":
+		err = runImport(commandArg(defaultSnapshotDir))
+	case "verify":
+		err = runVerify(commandArg(""))
+	case "rollback":
+		if len(os.Args) < 3 {
+			log.Fatalf("Missing run ID\n%s", usage)
 		}
-	}()
-
-	go func() {
-		defer wg.Done()
-		var err error
-		tags, err = getKaitenTags()
-		if err != nil {
-			errChan <- fmt.Errorf("error getting tags from Kaiten: %v", err)
+		err = runRollbackCommand(os.Args[2])
+	case "trello":
+		paths, wipe := wipeFlag(os.Args[2:])
+		if len(paths) == 0 {
+			log.Fatalf("Missing Trello export\n%s", usage)
 		}
-	}()
-
-	go func() {
-		defer wg.Done()
-		var err error
-		emails, err = getPlankaUsersMails()
-		if err != nil {
-			errChan <- fmt.Errorf("error fetching Planka user emails: %v", err)
+		err = runTrello(paths, wipe)
+	case "jira":
+		paths, wipe := wipeFlag(os.Args[2:])
+		if len(paths) == 0 {
+			log.Fatalf("Missing Jira export\n%s", usage)
 		}
-	}()
-	wg.Wait()
-
-	select {
-	case err := <-errChan:
-		log.Fatal(err)
+		err = runJira(paths, wipe)
+	case "planka-export":
+		err = exportPlankaBackup(commandArg(defaultPlankaBackupDir))
+	case "planka-import":
+		args, wipe := wipeFlag(os.Args[2:])
+		dir := defaultPlankaBackupDir
+		if len(args) > 0 {
+			dir = args[0]
+		}
+		err = runPlankaImport(dir, wipe)
+	case "reverse":
+		err = runReverse()
+	case "reverse-verify":
+		err = runReverseVerify()
+	case "help", "-h", "--help":
+		fmt.Println(usage)
 	default:
+		log.Fatalf("Unknown command %q\n%s", command, usage)
 	}
-
-	var users interface{}
-	if err := json.Unmarshal(rawUsers.([]byte), &users); err != nil {
-		log.Fatalf("failed to parse JSON: %s", err)
-	}
-
-	emailSet := make(map[string]struct{}, len(emails))
-	for _, email := range emails {
-		emailSet[email] = struct{}{}
+	if err != nil {
+		log.Fatal(err)
 	}
+}
 
-	var kaitenUsers []KaitenUser
-	for _, user := range users.([]interface{}) {
-		userMap, ok := user.(map[string]interface{})
-		if !ok {
-			log.Println("Skipping invalid user data")
+// wipeFlag removes the --wipe flag from the command's arguments and reports
+// whether it was given.
+func wipeFlag(args []string) ([]string, bool) {
+	var rest []string
+	wipe := false
+	for _, arg := range args {
+		if arg == "--wipe" {
+			wipe = true
 			continue
 		}
+		rest = append(rest, arg)
+	}
+	return rest, wipe
+}
 
-		kaitenUsers = append(kaitenUsers, KaitenUser{
-			Email:    userMap["email"].(string),
-			FullName: userMap["full_name"].(string),
-			Username: userMap["username"].(string),
-		})
-	}
-
-	wg.Add(len(kaitenUsers))
-
-	for _, user := range kaitenUsers {
-		go func(user KaitenUser) {
-			defer wg.Done()
-
-			if _, exists := emailSet[user.Email]; !exists {
-				name := user.FullName
-				if name == "" {
-					name = user.Username
-				}
-				userData := PlankaUser{
-					Username: user.Username,
-					Name:     name,
-					Email:    user.Email,
-					Password: "1234tempPass",
-					Role:     "projectOwner",
-				}
-				if err := createPlankaUser(userData); err != nil {
-					log.Printf("Error creating Planka user %s: %v", userData.Username, err)
-					return
-				}
-				log.Printf("Created Planka user: %s\n", userData.Username)
-			}
-		}(user)
+// envWipe reports whether PLANKA_WIPE asks migrate and import to empty PLANKA
+// first.
+func envWipe() bool {
+	return getEnvDefault("PLANKA_WIPE", "false") == "true"
+}
+
+// commandArg returns the command's argument, or defaultValue without one.
+func commandArg(defaultValue string) string {
+	if len(os.Args) > 2 {
+		return os.Args[2]
 	}
-	wg.Wait()
+	return defaultValue
+}
 
-	spaces, err := getKaitenSpaces()
+func runExport(dir string) error {
+	source, err := newKaitenSource()
 	if err != nil {
-		log.Fatalf("Error fetching Kaiten spaces: %v", err)
-	}
-
-	plankaProjects := make(map[string]PlankaProject)
-	var projectsMutex sync.Mutex
-
-	wg.Add(len(spaces))
-	for _, space := range spaces {
-		go func(space KaitenSpace) {
-			defer wg.Done()
-			if space.ParentID == "" {
-				plankaProject, err := createPlankaProject(space)
-				if err != nil {
-					log.Printf("Error creating Planka project for space %s: %v", space.Name, err)
-					return
-				}
-
-				projectsMutex.Lock()
-				plankaProjects[plankaProject.KaitenSpaceUID] = plankaProject
-				projectsMutex.Unlock()
-				log.Printf("Planka project: %s with ID: %s\n", plankaProject.Name, plankaProject.ID)
-			}
-		}(space)
+		return err
 	}
-	wg.Wait()
-
-	for _, space := range spaces {
-		boardTitlePrefix := ""
-		boards, err := getKaitenBoardsForSpace(space)
-		if err != nil {
-			log.Fatalf("Error getting boards for space")
-		}
-		if len(boards) > 1 {
-			boardTitlePrefix = space.Name + ": "
-			log.Printf("%s\n", boardTitlePrefix)
-		}
-
-		spaceIdforBoard := space.UID
-		if space.ParentID != "" {
-			spaceIdforBoard = space.ParentID
-		}
-		spaceUIDforBoardCreation := spaces[spaceIdforBoard].UID
-
-		for _, kaitenBoard := range boards {
-			if len(boards) < 2 {
-				kaitenBoard.Title = space.Name
-			}
-			log.Printf("Board named %s created in project %s\n", boardTitlePrefix+kaitenBoard.Title, plankaProjects[spaceUIDforBoardCreation].Name)
-			board, err := createPlankaBoard(plankaProjects[spaceUIDforBoardCreation].ID, kaitenBoard, boardTitlePrefix)
+	return exportSnapshot(source, dir)
+}
 
-			if err != nil {
-				log.Printf("Error creating Planka board for project %s: %v", plankaProjects[spaceUIDforBoardCreation].ID, err)
-				continue
-			}
-			columns, err := getKaitenColumnsForBoard(kaitenBoard.ID)
-			if err != nil {
-				log.Printf("Error getting columns for board %s: %v", board.ID, err)
-				continue
-			}
-			emails, err := getPlankaUsersMails()
-			if err != nil {
-				log.Fatalf("Error fetching Planka user emails: %v", err)
-			}
-			for _, email := range emails {
-				userId, err := getPlankaUserIDByEmail(email)
-				if err != nil {
-					log.Printf("Error getting Planka user ID for email %s: %v", email, err)
-					continue
-				}
-				err = setPlankaBoardMember(board.ID, userId)
-				if err != nil {
-					log.Printf("Error setting Planka board member for board %s and user %s: %v", board.ID, userId, err)
-					continue
-				}
-			}
-			for _, column := range columns {
-				column.Type = "active"
-				plankaColumn, err := createPlankaList(board.ID, column)
-				if err != nil {
-					log.Printf("Error creating Planka column for board %s: %v", board.ID, err)
-					continue
-				}
-				log.Printf("Created Planka column: %s in board: %s\n", plankaColumn.Name, board.Name)
-				cards, err := getKaitenCardsForColumn(column.Id)
-				if err != nil {
-					log.Printf("Error getting cards for column %s: %v", column.Id, err)
-					continue
-				}
-
-				for _, card := range cards {
-					if card.Archived {
-						continue
-					}
-					cardId, err := createPlankaCard(plankaColumn.ID, card)
-					if err != nil {
-						log.Printf("Error creating Planka card in column %s: %v", plankaColumn.ID, err)
-						continue
-					}
-					if card.Members != nil {
-
-						for _, member := range card.Members {
-							userId, err := getPlankaUserIDByEmail(member)
-							if err != nil {
-								log.Printf("Error getting Planka user ID for email %s: %v", member, err)
-								continue
-							}
-
-							err = setPlankaCardNumber(cardId, userId)
-							if err != nil {
-								log.Printf("Error setting Planka card member for card %s and user %s: %v", cardId, userId, err)
-								continue
-							}
-
-						}
-
-					}
-
-					processCardTags(card, cardId, board.ID, tags)
-
-					processCardChecklists(card, cardId)
-
-					comments, err := getKaitenCommentsForCard(card.ID)
-					if err == nil && comments != nil {
-						wg.Add(len(comments))
-						for _, comment := range comments {
-							go func(comment KaitenComment) {
-								defer wg.Done()
-								err := createPlankaCommentForCard(cardId, comment)
-								if err != nil {
-									log.Printf("Error creating Planka comment for card %s: %v", cardId, err)
-									return
-								}
-							}(comment)
-						}
-						wg.Wait()
-					}
-					attachments, err := getKaitenAttachmentsForCard(card.ID)
-					if err != nil {
-						log.Printf("Error getting attachments for card %f: %v", card.ID, err)
-					}
-					if attachments != nil {
-						log.Printf("Got attachments for card %s: %v\n", cardId, attachments)
-						wg.Add(len(attachments))
-						for _, attachment := range attachments {
-							go func(attachment KaitenAttachment) {
-								defer wg.Done()
-								if _, err := createPlankaAttachmentForCard(cardId, attachment); err != nil {
-									log.Printf("Error creating Planka attachment for card %s: %v", cardId, err)
-									return
-								}
-							}(attachment)
-						}
-						wg.Wait()
-
-					}
-
-					log.Printf("Created Planka card: %s in list: %s\n", cardId, plankaColumn.Name)
-				}
+func runArchive(dir string) error {
+	source, err := newKaitenSource()
+	if err != nil {
+		return err
+	}
+	return exportArchive(source, dir)
+}
 
-			}
+func runMigrate() error {
+	source, err := newKaitenSource()
+	if err != nil {
+		return err
+	}
+	return migrateToPlanka(source, envWipe())
+}
 
-		}
+func runImport(dir string) error {
+	source, err := newSnapshotSource(dir)
+	if err != nil {
+		return err
+	}
+	return migrateToPlanka(source, envWipe())
+}
 
+// runTrello migrates Trello exports. PLANKA is only wiped with --wipe, since
+// the boards usually join a PLANKA that is already in use.
+func runTrello(paths []string, wipe bool) error {
+	source, err := newTrelloSource(paths)
+	if err != nil {
+		return err
 	}
+	return migrateToPlanka(source, wipe)
+}
 
+// runJira migrates Jira exports. Like runTrello it only wipes with --wipe.
+func runJira(paths []string, wipe bool) error {
+	source, err := newJiraSource(paths)
+	if err != nil {
+		return err
+	}
+	return migrateToPlanka(source, wipe)
 }
 
-func processCardChecklists(card KaitenCard, cardId string) {
-	if len(card.Checklists) > 0 {
-		checkListsWG := &sync.WaitGroup{}
-		checkListsWG.Add(len(card.Checklists))
+// runVerify compares PLANKA with the snapshot in dir, or with Kaiten when dir
+// is empty.
+func runVerify(dir string) error {
+	var source Source
+	var err error
+	if dir != "" {
+		source, err = newSnapshotSource(dir)
+	} else {
+		source, err = newKaitenSource()
+	}
+	if err != nil {
+		return err
+	}
+	config, err := loadMigrationConfig()
+	if err != nil {
+		return err
+	}
+	mapping, err := loadMappingStore(getEnvDefault("MAPPING_FILE", "mapping.json"))
+	if err != nil {
+		return fmt.Errorf("error loading ID mapping: %w", err)
+	}
+	if err := initPlankaEnv(); err != nil {
+		return fmt.Errorf("cannot get variable values for PLANKA API: %w", err)
+	}
+	verifier, err := newVerifier(source, &plankaVerifyTarget{}, mapping, config)
+	if err != nil {
+		return err
+	}
+	return verifier.run(getEnvDefault("VERIFY_REPORT", "verify.csv"))
+}
 
-		checklistSemaphore := make(chan struct{}, 3)
+// runReverse migrates PLANKA to Kaiten. Kaiten is never wiped and the run is
+// not journaled; the mapping is kept apart from the forward one.
+func runReverse() error {
+	source, err := newPlankaSource()
+	if err != nil {
+		return err
+	}
+	sink, err := newKaitenSink()
+	if err != nil {
+		return err
+	}
+	config, err := loadMigrationConfig()
+	if err != nil {
+		return err
+	}
+	mapping, err := loadMappingStore(getEnvDefault("REVERSE_MAPPING_FILE", "reverse-mapping.json"))
+	if err != nil {
+		return fmt.Errorf("error loading ID mapping: %w", err)
+	}
+	return newMigration(source, sink, mapping, config).run()
+}
 
-		for _, checklistId := range card.Checklists {
-			go func(checklistId float64) {
-				defer checkListsWG.Done()
+func runReverseVerify() error {
+	source, err := newPlankaSource()
+	if err != nil {
+		return err
+	}
+	if err := initKaitenEnv(); err != nil {
+		return fmt.Errorf("cannot get variable values for Kaiten API: %w", err)
+	}
+	config, err := loadMigrationConfig()
+	if err != nil {
+		return err
+	}
+	mapping, err := loadMappingStore(getEnvDefault("REVERSE_MAPPING_FILE", "reverse-mapping.json"))
+	if err != nil {
+		return fmt.Errorf("error loading ID mapping: %w", err)
+	}
+	verifier, err := newVerifier(source, &kaitenVerifyTarget{}, mapping, config)
+	if err != nil {
+		return err
+	}
+	return verifier.run(getEnvDefault("VERIFY_REPORT", "verify.csv"))
+}
 
-				checklistSemaphore <- struct{}{}
-				defer func() { <-checklistSemaphore }()
+// migrateToPlanka runs a journaled migration into PLANKA. With wipe set all
+// PLANKA users and projects are deleted first.
+func migrateToPlanka(source Source, wipe bool) error {
+	config, err := loadMigrationConfig()
+	if err != nil {
+		return err
+	}
+	mapping, err := loadMappingStore(getEnvDefault("MAPPING_FILE", "mapping.json"))
+	if err != nil {
+		return fmt.Errorf("error loading ID mapping: %w", err)
+	}
+	sink, err := newPlankaSink()
+	if err != nil {
+		return err
+	}
 
-				kaitenList, err := getKaitenChecklistsForCard(card.ID, checklistId)
-				if err != nil {
-					log.Printf("Error getting checklist for card %s: %v", cardId, err)
-					return
-				}
+	if wipe {
+		if err := wipePlanka(); err != nil {
+			return err
+		}
+		// The IDs of the previous runs point at deleted objects now.
+		mapping.Clear()
+	}
 
-				listId, err := createPlankaTasklistForCard(cardId, kaitenList)
-				if err != nil {
-					log.Printf("Error creating tasklist for card %s: %v", cardId, err)
-					return
-				}
+	journal, err := newRunJournal(config.journalDir)
+	if err != nil {
+		return err
+	}
+	defer journal.Close()
+	log.Printf("Starting run %s", journal.id)
 
-				if len(kaitenList.Items) > 0 {
-					itemWg := &sync.WaitGroup{}
-					itemWg.Add(len(kaitenList.Items))
+	err = newMigration(source, newJournalSink(sink, journal), mapping, config).run()
+	journal.seal()
+	if err != nil {
+		return fmt.Errorf("run %s failed: %w", journal.id, err)
+	}
+	log.Printf("Run %s finished, it can be undone with: rollback %s", journal.id, journal.id)
+	return nil
+}
 
-					itemSemaphore := make(chan struct{}, 5)
+// runPlankaImport restores a PLANKA backup as a journaled run, so that it can
+// be rolled back like a migration. PLANKA is only wiped with --wipe.
+func runPlankaImport(dir string, wipe bool) error {
+	config, err := loadMigrationConfig()
+	if err != nil {
+		return err
+	}
+	sink, err := newPlankaSink()
+	if err != nil {
+		return err
+	}
+	if wipe {
+		if err := wipePlanka(); err != nil {
+			return err
+		}
+	}
 
-					for _, item := range kaitenList.Items {
-						go func(item KaitenChecklistItem) {
-							defer itemWg.Done()
+	journal, err := newRunJournal(config.journalDir)
+	if err != nil {
+		return err
+	}
+	defer journal.Close()
+	log.Printf("Starting run %s", journal.id)
 
-							itemSemaphore <- struct{}{}
-							defer func() { <-itemSemaphore }()
+	err = importPlankaBackup(dir, newJournalSink(sink, journal))
+	journal.seal()
+	if err != nil {
+		return fmt.Errorf("run %s failed: %w", journal.id, err)
+	}
+	log.Printf("Run %s finished, it can be undone with: rollback %s", journal.id, journal.id)
+	return nil
+}
 
-							taskId, err := createPlankaTaskInTasklist(listId, item)
-							if err != nil {
-								log.Printf("Error creating task in checklist for card %s: %v", cardId, err)
-								return
-							}
-							log.Printf("Created task %s in checklist for card %s", taskId, cardId)
-						}(item)
-					}
+// wipePlanka deletes all users and projects before a run.
+func wipePlanka() error {
+	wg := &sync.WaitGroup{}
+	errChan := make(chan error, 10)
 
-					itemWg.Wait()
-				}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if err := plankaDeleteUser(); err != nil {
+			errChan <- fmt.Errorf("error deleting Planka users: %v", err)
+		}
+	}()
 
-				log.Printf("Completed processing checklist %f for card %s", checklistId, cardId)
-			}(checklistId)
+	go func() {
+		defer wg.Done()
+		if err := deletePlankaProjects(); err != nil {
+			errChan <- fmt.Errorf("error deleting Planka projects: %v", err)
 		}
+	}()
+	wg.Wait()
 
-		checkListsWG.Wait()
-	}
+	select {
+	case err := <-errChan:
+		return err
+	default:
 
+	}
+	return nil
 }
 
-func processCardTags(card KaitenCard, cardId string, boardId string, tags map[float64]KaitenTag) {
-	if card.TagIds != nil {
-		tagsWG := &sync.WaitGroup{}
-		tagsWG.Add(len(card.TagIds))
-		boardLabels := make(map[float64]PlankaLabel)
-		boardLabelsMutex := &sync.Mutex{}
-
-		semaphore := make(chan struct{}, 5)
-
-		for _, tagID := range card.TagIds {
-			go func(tagID float64) {
-				defer tagsWG.Done()
-
-				semaphore <- struct{}{}
-				defer func() { <-semaphore }()
-
-				boardLabelsMutex.Lock()
-				label, exists := boardLabels[tagID]
-				boardLabelsMutex.Unlock()
-
-				if !exists {
-					newLabel, err := createPlankaLabelForBoard(boardId, tags[tagID])
-					if err != nil {
-						log.Printf("Error creating label for tag %f: %v", tagID, err)
-						return
-					}
-
-					boardLabelsMutex.Lock()
-					boardLabels[tagID] = newLabel
-					label = newLabel
-					boardLabelsMutex.Unlock()
-				}
-
-				if err := createPlankaLabelForCard(cardId, label.Id); err != nil {
-					log.Printf("Error setting Planka label for card %s: %v", cardId, err)
-					return
-				}
-			}(tagID)
-		}
+func runRollbackCommand(runId string) error {
+	if err := initPlankaEnv(); err != nil {
+		return fmt.Errorf("cannot get variable values for PLANKA API: %w", err)
+	}
+	rollback, err := loadRunRollback(getEnvDefault("RUN_JOURNAL_DIR", "runs"), runId)
+	if err != nil {
+		return err
+	}
+	mapping, err := loadMappingStore(getEnvDefault("MAPPING_FILE", "mapping.json"))
+	if err != nil {
+		return fmt.Errorf("error loading ID mapping: %w", err)
+	}
 
-		tagsWG.Wait()
+	err = rollback.run()
+	if removed := rollback.forget(mapping); removed > 0 {
+		if saveErr := mapping.Save(); saveErr != nil {
+			log.Printf("Error saving ID mapping: %v", saveErr)
+		} else {
+			log.Printf("Removed %d rolled back objects from the ID mapping", removed)
+		}
 	}
+	return err
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+const (
+	mappingKindProject = "project"
+	mappingKindBoard   = "board"
+	mappingKindList    = "list"
+	mappingKindCard    = "card"
+)
+
+// mappingStore persists which PLANKA object was created for which Kaiten
+// object, grouped by object kind.
+type mappingStore struct {
+	mu      sync.Mutex
+	path    string
+	Entries map[string]map[string]string `json:"entries"`
+}
+
+func loadMappingStore(path string) (*mappingStore, error) {
+	store := &mappingStore{path: path, Entries: make(map[string]map[string]string)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mapping file %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("failed to parse mapping file %s: %w", path, err)
+	}
+	if store.Entries == nil {
+		store.Entries = make(map[string]map[string]string)
+	}
+	return store, nil
+}
+
+func (m *mappingStore) Set(kind string, sourceId string, targetId string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Entries[kind] == nil {
+		m.Entries[kind] = make(map[string]string)
+	}
+	m.Entries[kind][sourceId] = targetId
+}
+
+func (m *mappingStore) Get(kind string, sourceId string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	targetId, ok := m.Entries[kind][sourceId]
+	return targetId, ok
+}
+
+// RemoveTargets forgets every entry that points at one of the given target
+// IDs and returns how many it forgot.
+func (m *mappingStore) RemoveTargets(targetIds map[string]bool) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := 0
+	for _, entries := range m.Entries {
+		for sourceId, targetId := range entries {
+			if targetIds[targetId] {
+				delete(entries, sourceId)
+				removed++
+			}
+		}
+	}
+	return removed
+}
+
+// Clear forgets every entry, for runs that start from a wiped PLANKA.
+func (m *mappingStore) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Entries = make(map[string]map[string]string)
+}
+
+func (m *mappingStore) Save() error {
+	m.mu.Lock()
+	data, err := json.MarshalIndent(m, "", "  ")
+	m.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal mapping: %w", err)
+	}
+
+	tmpPath := m.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write mapping file %s: %w", tmpPath, err)
+	}
+	return os.Rename(tmpPath, m.path)
+}
+
+func formatKaitenID(id float64) string {
+	return strconv.FormatFloat(id, 'f', -1, 64)
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	htmlMarkupPattern   = regexp.MustCompile(`(?i)</?(p|div|br|span|strong|b|em|i|u|s|strike|del|a|img|ul|ol|li|h[1-6]|pre|code|blockquote|table|tr|td|th)\b[^>]*>`)
+	htmlTagPattern      = regexp.MustCompile(`(?i)^<(?:!--[\s\S]*?-->|![a-z][^<>]*>|/?(?:p|div|br|hr|span|strong|b|em|i|u|s|strike|del|a|img|ul|ol|li|h[1-6]|pre|code|blockquote|table|thead|tbody|tfoot|tr|td|th|script|style)(?:\s[^<>]*)?/?>)`)
+	htmlAttrPattern     = regexp.MustCompile(`([a-zA-Z_:][-a-zA-Z0-9_:.]*)\s*=\s*("([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	mentionPattern      = regexp.MustCompile(`(^|[^\w@.])@([\w.\-]+)`)
+	extraNewlines       = regexp.MustCompile(`\n{3,}`)
+	trailingWhitespace  = regexp.MustCompile(`[ \t]+\n`)
+	spacesPattern       = regexp.MustCompile(`[ \t\r\n]+`)
+	markdownCodePattern = regexp.MustCompile("(?s)```.*?(?:```|$)|`[^`\n]+`")
+)
+
+// textConverter adapts Markdown from a source to PLANKA: it rewrites
+// mentions and links to other source cards.
+type textConverter struct {
+	usernames map[string]string
+	mapping   *mappingStore
+	cardURL   func(cardId string) string
+	cardLinks *regexp.Regexp
+}
+
+// newTextConverter sets up mention and card link rewriting. usernames maps
+// Kaiten usernames to PLANKA usernames. Links to cards under sourceURL are
+// pointed at cardURL of the migrated card.
+func newTextConverter(usernames map[string]string, mapping *mappingStore, sourceURL string, cardURL func(cardId string) string) *textConverter {
+	return &textConverter{
+		usernames: usernames,
+		mapping:   mapping,
+		cardURL:   cardURL,
+		cardLinks: kaitenCardLinks(sourceURL),
+	}
+}
+
+// kaitenCardLinks matches links to cards under sourceURL and captures the
+// card ID. It is nil when sourceURL is empty.
+func kaitenCardLinks(sourceURL string) *regexp.Regexp {
+	if sourceURL == "" {
+		return nil
+	}
+	return regexp.MustCompile(regexp.QuoteMeta(sourceURL) + `/(?:space/\d+/(?:boards/)?card/|card/)?(\d+)\b`)
+}
+
+// mentionTargets maps Kaiten usernames to the usernames of the users' PLANKA
+// accounts, for newTextConverter.
+func mentionTargets(users []KaitenUser, plankaUsers []PlankaUserInfo) map[string]string {
+	plankaUsernames := make(map[string]string, len(plankaUsers))
+	for _, plankaUser := range plankaUsers {
+		plankaUsernames[plankaUser.Email] = plankaUser.Username
+	}
+	usernames := make(map[string]string)
+	for _, user := range users {
+		if username, ok := plankaUsernames[user.Email]; ok && username != "" {
+			usernames[user.Username] = username
+		}
+	}
+	return usernames
+}
+
+// kaitenUsernames maps Kaiten user IDs to Kaiten usernames, for the mention
+// spans of kaitenMarkdown.
+func kaitenUsernames(users []KaitenUser) map[string]string {
+	usernames := make(map[string]string, len(users))
+	for _, user := range users {
+		if user.Username != "" {
+			usernames[formatKaitenID(user.ID)] = user.Username
+		}
+	}
+	return usernames
+}
+
+// kaitenMarkdown converts Kaiten description or comment text to Markdown.
+// Mention spans become @username through usernames, which maps Kaiten user
+// IDs to Kaiten usernames. Empty text stays empty.
+func kaitenMarkdown(text string, usernames map[string]string) string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ""
+	}
+
+	if htmlMarkupPattern.MatchString(text) {
+		text = htmlToMarkdown(text, usernames)
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = trailingWhitespace.ReplaceAllString(text, "\n")
+	text = extraNewlines.ReplaceAllString(text, "\n\n")
+	return strings.TrimSpace(text)
+}
+
+// convert rewrites mentions and card links in Markdown from the source.
+func (c *textConverter) convert(text string) string {
+	text = c.rewriteMentions(text)
+	return c.rewriteCardLinks(text)
+}
+
+// hasUnresolvedCardLinks reports whether the text links to Kaiten cards that
+// have no PLANKA counterpart yet.
+func (c *textConverter) hasUnresolvedCardLinks(text string) bool {
+	if c.cardLinks == nil || c.mapping == nil {
+		return false
+	}
+	for _, match := range c.cardLinks.FindAllStringSubmatch(text, -1) {
+		if _, ok := c.mapping.Get(mappingKindCard, match[1]); !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// relinkCards rewrites links to Kaiten cards in already converted text, for
+// cards that were migrated after the text referring to them.
+func (c *textConverter) relinkCards(text string) string {
+	return c.rewriteCardLinks(text)
+}
+
+// outsideCode applies rewrite to the parts of Markdown text that are not code
+// spans or code blocks.
+func outsideCode(text string, rewrite func(string) string) string {
+	var out strings.Builder
+	last := 0
+	for _, span := range markdownCodePattern.FindAllStringIndex(text, -1) {
+		out.WriteString(rewrite(text[last:span[0]]))
+		out.WriteString(text[span[0]:span[1]])
+		last = span[1]
+	}
+	out.WriteString(rewrite(text[last:]))
+	return out.String()
+}
+
+func (c *textConverter) rewriteMentions(text string) string {
+	if len(c.usernames) == 0 {
+		return text
+	}
+	return outsideCode(text, c.replaceMentions)
+}
+
+func (c *textConverter) replaceMentions(text string) string {
+	return mentionPattern.ReplaceAllStringFunc(text, func(match string) string {
+		parts := mentionPattern.FindStringSubmatch(match)
+		if username, ok := c.usernames[parts[2]]; ok {
+			return parts[1] + "@" + username
+		}
+		return match
+	})
+}
+
+func (c *textConverter) rewriteCardLinks(text string) string {
+	if c.cardLinks == nil || c.mapping == nil {
+		return text
+	}
+	return outsideCode(text, c.replaceCardLinks)
+}
+
+func (c *textConverter) replaceCardLinks(text string) string {
+	return c.cardLinks.ReplaceAllStringFunc(text, func(match string) string {
+		kaitenCardId := c.cardLinks.FindStringSubmatch(match)[1]
+		if cardId, ok := c.mapping.Get(mappingKindCard, kaitenCardId); ok {
+			return c.cardURL(cardId)
+		}
+		return match
+	})
+}
+
+type htmlElement struct {
+	name  string
+	attrs map[string]string
+	out   *strings.Builder
+}
+
+type htmlList struct {
+	ordered bool
+	counter int
+}
+
+// htmlToMarkdown is a small HTML to Markdown converter that covers the markup
+// Kaiten's editor produces. Tags it does not know are kept as text, so a
+// stray "<" never swallows the rest of the content.
+func htmlToMarkdown(text string, usernames map[string]string) string {
+	root := &strings.Builder{}
+	out := root
+	var stack []htmlElement
+	var lists []htmlList
+	var tableRows [][]string
+	var row []string
+	headerDone := false
+	preDepth := 0
+	skipDepth := 0
+
+	push := func(name string, attrs map[string]string) {
+		stack = append(stack, htmlElement{name: name, attrs: attrs, out: out})
+		out = &strings.Builder{}
+	}
+	pop := func(name string) (htmlElement, string, bool) {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i].name == name {
+				inner := out.String()
+				element := stack[i]
+				out = element.out
+				stack = stack[:i]
+				return element, inner, true
+			}
+		}
+		return htmlElement{}, "", false
+	}
+	block := func() {
+		if s := out.String(); s != "" && !strings.HasSuffix(s, "\n\n") {
+			if strings.HasSuffix(s, "\n") {
+				out.WriteString("\n")
+			} else {
+				out.WriteString("\n\n")
+			}
+		}
+	}
+
+	for len(text) > 0 {
+		start := nextHTMLTag(text)
+		if start != 0 {
+			if start < 0 {
+				start = len(text)
+			}
+			if skipDepth == 0 {
+				chunk := html.UnescapeString(text[:start])
+				if preDepth == 0 {
+					chunk = spacesPattern.ReplaceAllString(chunk, " ")
+					if current := out.String(); current == "" || strings.HasSuffix(current, "\n") {
+						chunk = strings.TrimLeft(chunk, " ")
+					}
+				}
+				out.WriteString(chunk)
+			}
+			text = text[start:]
+			continue
+		}
+
+		end := len(htmlTagPattern.FindString(text))
+		tag := text[1 : end-1]
+		text = text[end:]
+
+		if strings.HasPrefix(tag, "!") {
+			continue
+		}
+		closing := strings.HasPrefix(tag, "/")
+		tag = strings.TrimSuffix(strings.TrimPrefix(tag, "/"), "/")
+		name, rawAttrs, _ := strings.Cut(strings.TrimSpace(spacesPattern.ReplaceAllString(tag, " ")), " ")
+		name = strings.ToLower(name)
+		attrs := parseHTMLAttrs(rawAttrs)
+
+		if name == "script" || name == "style" {
+			if closing {
+				skipDepth--
+			} else {
+				skipDepth++
+			}
+			continue
+		}
+		if skipDepth > 0 {
+			continue
+		}
+
+		switch name {
+		case "p", "div":
+			block()
+		case "br":
+			if len(lists) > 0 || len(row) > 0 {
+				out.WriteString(" ")
+			} else {
+				out.WriteString("\n")
+			}
+		case "hr":
+			block()
+			out.WriteString("---\n\n")
+		case "h1", "h2", "h3", "h4", "h5", "h6":
+			block()
+			if !closing {
+				level, _ := strconv.Atoi(name[1:])
+				out.WriteString(strings.Repeat("#", level) + " ")
+			}
+		case "strong", "b":
+			out.WriteString("**")
+		case "em", "i":
+			out.WriteString("_")
+		case "s", "strike", "del":
+			out.WriteString("~~")
+		case "code":
+			if preDepth == 0 {
+				out.WriteString("`")
+			}
+		case "pre":
+			if closing {
+				preDepth--
+				out.WriteString("\n```\n\n")
+			} else {
+				block()
+				preDepth++
+				out.WriteString("```\n")
+			}
+		case "img":
+			out.WriteString("![" + attrs["alt"] + "](" + attrs["src"] + ")")
+		case "ul", "ol":
+			if closing {
+				if len(lists) > 0 {
+					lists = lists[:len(lists)-1]
+				}
+				if len(lists) == 0 {
+					out.WriteString("\n\n")
+				}
+			} else {
+				if len(lists) == 0 {
+					block()
+				}
+				lists = append(lists, htmlList{ordered: name == "ol"})
+			}
+		case "li":
+			if !closing && len(lists) > 0 {
+				list := &lists[len(lists)-1]
+				list.counter++
+				if s := out.String(); s != "" && !strings.HasSuffix(s, "\n") {
+					out.WriteString("\n")
+				}
+				out.WriteString(strings.Repeat("  ", len(lists)-1))
+				if list.ordered {
+					out.WriteString(strconv.Itoa(list.counter) + ". ")
+				} else {
+					out.WriteString("- ")
+				}
+			}
+		case "a", "blockquote", "span", "td", "th":
+			if !closing {
+				push(name, attrs)
+				continue
+			}
+			element, inner, ok := pop(name)
+			if !ok {
+				continue
+			}
+			switch name {
+			case "a":
+				href := element.attrs["href"]
+				inner = strings.TrimSpace(inner)
+				switch {
+				case href == "":
+					out.WriteString(inner)
+				case inner == "" || inner == href:
+					out.WriteString(href)
+				default:
+					out.WriteString("[" + inner + "](" + href + ")")
+				}
+			case "blockquote":
+				block()
+				for _, line := range strings.Split(strings.TrimSpace(inner), "\n") {
+					out.WriteString("> " + line + "\n")
+				}
+				out.WriteString("\n")
+			case "span":
+				out.WriteString(htmlMention(element.attrs, inner, usernames))
+			case "td", "th":
+				cell := strings.TrimSpace(strings.ReplaceAll(inner, "\n", " "))
+				row = append(row, strings.ReplaceAll(cell, "|", `\|`))
+			}
+		case "tr":
+			if closing && len(row) > 0 {
+				tableRows = append(tableRows, row)
+				row = nil
+			}
+		case "table":
+			if !closing {
+				block()
+				tableRows = nil
+				headerDone = false
+				continue
+			}
+			for i, tableRow := range tableRows {
+				out.WriteString("| " + strings.Join(tableRow, " | ") + " |\n")
+				if i == 0 && !headerDone {
+					out.WriteString(strings.Repeat("|---", len(tableRow)) + "|\n")
+					headerDone = true
+				}
+			}
+			out.WriteString("\n")
+			tableRows = nil
+		}
+	}
+
+	for len(stack) > 0 {
+		_, inner, _ := pop(stack[len(stack)-1].name)
+		out.WriteString(inner)
+	}
+	return root.String()
+}
+
+// nextHTMLTag returns the position of the first known tag in text, or -1.
+func nextHTMLTag(text string) int {
+	for offset := 0; ; {
+		start := strings.IndexByte(text[offset:], '<')
+		if start < 0 {
+			return -1
+		}
+		if htmlTagPattern.MatchString(text[offset+start:]) {
+			return offset + start
+		}
+		offset += start + 1
+	}
+}
+
+// htmlMention renders a mention span as @username; other spans keep just
+// their text.
+func htmlMention(attrs map[string]string, inner string, usernames map[string]string) string {
+	if !strings.Contains(attrs["class"], "mention") && attrs["data-mention"] == "" && attrs["data-user-id"] == "" {
+		return inner
+	}
+	for _, key := range []string{"data-username", "data-mention"} {
+		if username := strings.TrimPrefix(attrs[key], "@"); username != "" {
+			return "@" + username
+		}
+	}
+	for _, key := range []string{"data-user-id", "data-id"} {
+		if username, ok := usernames[attrs[key]]; ok {
+			return "@" + username
+		}
+	}
+	return inner
+}
+
+func parseHTMLAttrs(raw string) map[string]string {
+	attrs := make(map[string]string)
+	for _, match := range htmlAttrPattern.FindAllStringSubmatch(raw, -1) {
+		value := match[3]
+		if value == "" {
+			value = match[4]
+		}
+		if value == "" {
+			value = match[5]
+		}
+		attrs[strings.ToLower(match[1])] = html.UnescapeString(value)
+	}
+	return attrs
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files")
+
+func testConverter() *textConverter {
+	mapping := &mappingStore{Entries: map[string]map[string]string{
+		mappingKindCard: {"42": "p42"},
+	}}
+	return newTextConverter(
+		map[string]string{"ivan": "ivan.p"},
+		mapping,
+		"https://kaiten.example",
+		func(cardId string) string { return "https://planka.example/cards/" + cardId },
+	)
+}
+
+// checkGolden compares got with testdata/<dir>/<name>.golden.
+func checkGolden(t *testing.T, path string, got string) {
+	t.Helper()
+	if *updateGolden {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s mismatch\n got:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func TestKaitenMarkdownGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "markdown", "*.in"))
+	if err != nil || len(inputs) == 0 {
+		t.Fatalf("no golden inputs: %v", err)
+	}
+	converter := testConverter()
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".in")
+		t.Run(name, func(t *testing.T) {
+			text, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			markdown := kaitenMarkdown(string(text), map[string]string{"7": "ivan"})
+			checkGolden(t, strings.TrimSuffix(input, ".in")+".golden", converter.convert(markdown)+"\n")
+		})
+	}
+}
+
+func TestDescribeKaitenPropertiesKeepsDescriptionLayout(t *testing.T) {
+	card := KaitenCard{
+		Description: kaitenMarkdown("<p>First</p><ul><li>a</li><li>b</li></ul>", nil),
+		Properties:  map[string]any{"id_1": "High"},
+	}
+	properties := map[string]KaitenCustomProperty{"id_1": {Name: "Prio"}}
+	got := describeKaitenProperties(card, properties, nil)
+	want := "## Детализация\n\n**Prio**: High\n\n## Описание\n\nFirst\n\n- a\n- b"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestConvertLeavesMarkdownLayout(t *testing.T) {
+	converter := testConverter()
+	text := "Use <b>bold</b> for https://kaiten.example/card/42\n\n- a\n- b\n\n```\nx  =  1\n```"
+	want := "Use <b>bold</b> for https://planka.example/cards/p42\n\n- a\n- b\n\n```\nx  =  1\n```"
+	if got := converter.convert(text); got != want {
+		t.Errorf("convert: got %q, want %q", got, want)
+	}
+	if got := converter.relinkCards(text); got != want {
+		t.Errorf("relinkCards: got %q, want %q", got, want)
+	}
+}
+
+func TestMarkdownHTMLGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "archive", "*.md"))
+	if err != nil || len(inputs) == 0 {
+		t.Fatalf("no golden inputs: %v", err)
+	}
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".md")
+		t.Run(name, func(t *testing.T) {
+			text, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, strings.TrimSuffix(input, ".md")+".golden", markdownHTML(string(text)))
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"log"
+	"sort"
+)
+
+const responsibleFieldKey = "responsible"
+
+// orderedMembers returns card members with the responsible user first, so
+// that they become the first assignee in PLANKA.
+func (card KaitenCard) orderedMembers() []KaitenCardMember {
+	members := append([]KaitenCardMember(nil), card.Members...)
+	sort.SliceStable(members, func(i, j int) bool {
+		return members[i].Type == kaitenMemberTypeResponsible && members[j].Type != kaitenMemberTypeResponsible
+	})
+	return members
+}
+
+func (card KaitenCard) responsible() (KaitenCardMember, bool) {
+	for _, member := range card.Members {
+		if member.Type == kaitenMemberTypeResponsible {
+			return member, true
+		}
+	}
+	return KaitenCardMember{}, false
+}
+
+func (m *migration) processCardMembers(card KaitenCard, cardId string, boardId string) {
+	for _, member := range card.orderedMembers() {
+		email := m.inactive.member(member.Email)
+		if email == "" {
+			continue
+		}
+		userId, ok := m.plankaUserIds[email]
+		if !ok {
+			log.Printf("No Planka user for card member %s", member.Email)
+			continue
+		}
+
+		if err := m.sink.AddCardMember(cardId, userId); err != nil {
+			log.Printf("Error setting Planka card member for card %s and user %s: %v", cardId, userId, err)
+			continue
+		}
+	}
+
+	responsible, ok := card.responsible()
+	if !ok {
+		return
+	}
+	name := responsible.FullName
+	if name == "" {
+		name = responsible.Email
+	}
+
+	if m.cardFields != nil {
+		groupId, fieldId, err := m.cardFields.field(boardId, responsibleFieldKey, "Ответственный")
+		if err == nil {
+			err = m.sink.SetCustomFieldValue(cardId, groupId, fieldId, name)
+		}
+		if err != nil {
+			log.Printf("Error setting responsible for card %s: %v", cardId, err)
+		}
+		return
+	}
+
+	labelName := "Responsible: " + name
+	label, err := m.labels.ensure(boardId, labelKindResponsible, PlankaLabel{Name: labelName, Color: "lagoon-blue"})
+	if err != nil {
+		log.Printf("Error creating responsible label for board %s: %v", boardId, err)
+		return
+	}
+	if err := m.sink.AddCardLabel(cardId, label.Id); err != nil {
+		log.Printf("Error setting responsible label for card %s: %v", cardId, err)
+	}
+}
+
+// processCardSubscribers subscribes the card's watchers to it.
+func (m *migration) processCardSubscribers(cardId string, emails []string) {
+	for _, email := range emails {
+		if m.inactive.member(email) != email {
+			continue
+		}
+		if err := m.sink.SubscribeCard(cardId, email); err != nil {
+			log.Printf("Error subscribing %s to card %s: %v", email, cardId, err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProcessCardMembers(t *testing.T) {
+	users := []KaitenUser{
+		{Email: "ann@x"},
+		{Email: "bob@x"},
+		{Email: "old@x", FullName: "Old Timer", Inactive: true},
+	}
+	card := KaitenCard{Members: []KaitenCardMember{
+		{Email: "ann@x", Type: kaitenMemberTypeMember},
+		{Email: "old@x", Type: kaitenMemberTypeMember},
+		{Email: "bob@x", FullName: "Bob", Type: kaitenMemberTypeResponsible},
+		{Email: "nobody@x", Type: kaitenMemberTypeMember},
+	}}
+
+	for _, test := range []struct {
+		policy string
+		fields bool
+		want   []string
+	}{
+		{inactiveUsersSkip, false, []string{
+			"AddCardMember card u:bob@x",
+			"AddCardMember card u:ann@x",
+			"CreateLabel board Responsible: Bob lagoon-blue",
+			"AddCardLabel card label:Responsible: Bob",
+		}},
+		{inactiveUsersDisable, false, []string{
+			"AddCardMember card u:bob@x",
+			"AddCardMember card u:ann@x",
+			"AddCardMember card u:old@x",
+			"CreateLabel board Responsible: Bob lagoon-blue",
+			"AddCardLabel card label:Responsible: Bob",
+		}},
+		{inactiveUsersFormer, true, []string{
+			"AddCardMember card u:bob@x",
+			"AddCardMember card u:ann@x",
+			"AddCardMember card u:former@x",
+			"CreateCustomFieldGroup board Kaiten",
+			"CreateCustomField group:Kaiten Ответственный",
+			"SetCustomFieldValue card field:Ответственный Bob",
+		}},
+	} {
+		inactive, err := newInactiveUsers(test.policy, "former@x", users)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sink := newRecordingSink()
+		m := &migration{
+			sink:     sink,
+			inactive: inactive,
+			labels:   newLabelRegistry(sink, &mappingStore{Entries: make(map[string]map[string]string)}, nil),
+			plankaUserIds: map[string]string{
+				"ann@x": "u:ann@x", "bob@x": "u:bob@x", "old@x": "u:old@x", "former@x": "u:former@x",
+			},
+		}
+		if test.fields {
+			m.cardFields = newCustomFieldRegistry(sink)
+		}
+
+		m.processCardMembers(card, "card", "board")
+
+		if got := strings.Join(sink.calls, "\n"); got != strings.Join(test.want, "\n") {
+			t.Errorf("%s: calls\n%s\nwant\n%s", test.policy, got, strings.Join(test.want, "\n"))
+		}
+	}
+}
@@ -0,0 +1,553 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+type migrationConfig struct {
+	propertiesMode    string
+	timeLogs          bool
+	cardTypes         cardTypeRules
+	userRoles         userRoleRules
+	inactiveUsers     string
+	formerUserEmail   string
+	permissionsReport string
+	journalDir        string
+	verifyChecksums   bool
+	colors            map[string]string
+}
+
+// loadMigrationConfig reads the migration settings from the environment.
+func loadMigrationConfig() (migrationConfig, error) {
+	config := migrationConfig{
+		propertiesMode:    getEnvDefault("KAITEN_PROPERTIES_MODE", propertiesModeCustomFields),
+		timeLogs:          getEnvDefault("KAITEN_TIME_LOGS", "true") == "true",
+		inactiveUsers:     getEnvDefault("KAITEN_INACTIVE_USERS", inactiveUsersDisable),
+		formerUserEmail:   getEnvDefault("FORMER_USER_EMAIL", defaultFormerUserEmail),
+		permissionsReport: getEnvDefault("PERMISSIONS_REPORT", "permissions.csv"),
+		journalDir:        getEnvDefault("RUN_JOURNAL_DIR", "runs"),
+		verifyChecksums:   getEnvDefault("ATTACHMENT_VERIFY_CHECKSUM", "false") == "true",
+	}
+	if config.propertiesMode != propertiesModeCustomFields && config.propertiesMode != propertiesModeDescription {
+		return config, fmt.Errorf("unknown KAITEN_PROPERTIES_MODE %q", config.propertiesMode)
+	}
+
+	var err error
+	if config.cardTypes, err = parseCardTypeRules(getEnvDefault("KAITEN_CARD_TYPES", defaultCardTypeRules)); err != nil {
+		return config, fmt.Errorf("invalid KAITEN_CARD_TYPES: %w", err)
+	}
+	if config.userRoles, err = parseUserRoleRules(getEnvDefault("KAITEN_USER_ROLES", defaultUserRoleRules)); err != nil {
+		return config, fmt.Errorf("invalid KAITEN_USER_ROLES: %w", err)
+	}
+	if config.colors, err = parseColorOverrides(getEnvDefault("KAITEN_COLOR_MAP", "")); err != nil {
+		return config, fmt.Errorf("invalid KAITEN_COLOR_MAP: %w", err)
+	}
+	return config, nil
+}
+
+// migration moves everything a Source yields into a Sink.
+type migration struct {
+	source  Source
+	sink    Sink
+	mapping *mappingStore
+	config  migrationConfig
+
+	users         []KaitenUser
+	usersByID     map[float64]KaitenUser
+	plankaUserIds map[string]string
+	plankaRoles   map[string]string
+	tags          map[float64]KaitenTag
+	properties    map[string]KaitenCustomProperty
+	inactive      *inactiveUsers
+	text          *textConverter
+
+	customFields *customFieldRegistry
+	cardFields   *customFieldRegistry
+	labels       *labelRegistry
+	relations    *pendingRelations
+	files        *attachmentCache
+	images       *inlineImages
+	access       *accessResolver
+	permissions  *permissionReport
+}
+
+func newMigration(source Source, sink Sink, mapping *mappingStore, config migrationConfig) *migration {
+	m := &migration{
+		source:        source,
+		sink:          sink,
+		mapping:       mapping,
+		config:        config,
+		usersByID:     make(map[float64]KaitenUser),
+		plankaUserIds: make(map[string]string),
+		plankaRoles:   make(map[string]string),
+		customFields:  newCustomFieldRegistry(sink),
+		labels:        newLabelRegistry(sink, mapping, config.colors),
+		permissions:   newPermissionReport(),
+	}
+	if config.propertiesMode == propertiesModeCustomFields {
+		m.cardFields = m.customFields
+	}
+	return m
+}
+
+func (m *migration) run() error {
+	files, err := newAttachmentCache(m.source, m.sink)
+	if err != nil {
+		return fmt.Errorf("error preparing attachment cache: %w", err)
+	}
+	defer files.Close()
+	m.files = files
+	m.images = newInlineImages(m.source, m.sink, files, m.config.verifyChecksums)
+
+	existing, err := m.loadReferenceData()
+	if err != nil {
+		return err
+	}
+	m.inactive, err = newInactiveUsers(m.config.inactiveUsers, m.config.formerUserEmail, m.users)
+	if err != nil {
+		return fmt.Errorf("invalid KAITEN_INACTIVE_USERS: %w", err)
+	}
+	m.access = newAccessResolver(m.source, m.usersByID, m.inactive)
+
+	if err := m.migrateUsers(existing); err != nil {
+		return err
+	}
+
+	spaces, err := m.source.Spaces()
+	if err != nil {
+		return fmt.Errorf("error fetching Kaiten spaces: %w", err)
+	}
+
+	// Space owners become project managers, which PLANKA only allows for
+	// project owners, so they are promoted before the projects are created.
+	for _, space := range spaces {
+		if space.ParentID == "" {
+			m.access.space(space, spaces)
+		}
+	}
+	promoted := promoteProjectOwners(m.sink, m.access.owners())
+
+	projects := m.migrateProjects(spaces)
+	for _, user := range m.users {
+		role, ok := m.plankaRoles[user.Email]
+		via := "company role"
+		if _, owner := promoted[user.Email]; owner {
+			role, ok, via = plankaRoleProjectOwner, true, "space owner"
+		}
+		if !ok {
+			continue
+		}
+		m.permissions.add("instance", "", "", user.Email, user.CompanyRole, role, via)
+	}
+
+	for _, space := range spaces {
+		if err := m.migrateSpaceBoards(space, spaces, projects); err != nil {
+			return err
+		}
+	}
+
+	if err := m.mapping.Save(); err != nil {
+		log.Printf("Error saving ID mapping: %v", err)
+	}
+
+	m.relations.resolve(m.mapping, m.labels, m.images)
+
+	m.inactive.deactivate(m.sink, m.plankaRoles, m.plankaUserIds)
+
+	if err := m.permissions.Save(m.config.permissionsReport); err != nil {
+		log.Printf("Error saving permission report: %v", err)
+	}
+	return nil
+}
+
+// loadReferenceData fetches users, tags and custom properties from the
+// source and returns the e-mails of users already in the sink.
+func (m *migration) loadReferenceData() (map[string]struct{}, error) {
+	var plankaUsers []PlankaUserInfo
+	wg := &sync.WaitGroup{}
+	errChan := make(chan error, 4)
+
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		var err error
+		m.users, err = m.source.Users()
+		if err != nil {
+			errChan <- fmt.Errorf("error getting users from Kaiten: %w", err)
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		var err error
+		m.tags, err = m.source.Tags()
+		if err != nil {
+			errChan <- fmt.Errorf("error getting tags from Kaiten: %w", err)
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		var err error
+		m.properties, err = m.source.CustomProperties()
+		if err != nil {
+			// Properties still migrate under their keys without the names.
+			log.Printf("Warning: error getting custom properties from Kaiten, properties keep their keys as names: %v", err)
+			m.properties = map[string]KaitenCustomProperty{}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		var err error
+		plankaUsers, err = m.sink.Users()
+		if err != nil {
+			errChan <- fmt.Errorf("error fetching Planka users: %w", err)
+		}
+	}()
+	wg.Wait()
+
+	select {
+	case err := <-errChan:
+		return nil, err
+	default:
+	}
+
+	for _, user := range m.users {
+		if user.ID != 0 {
+			m.usersByID[user.ID] = user
+		}
+	}
+	existing := make(map[string]struct{}, len(plankaUsers))
+	for _, user := range plankaUsers {
+		existing[user.Email] = struct{}{}
+	}
+	return existing, nil
+}
+
+// migrateUsers creates the missing users and sets up mention rewriting.
+func (m *migration) migrateUsers(existing map[string]struct{}) error {
+	if err := m.inactive.ensureFormerUser(m.sink, existing); err != nil {
+		return fmt.Errorf("error creating former employee account: %w", err)
+	}
+
+	var rolesMutex sync.Mutex
+	wg := &sync.WaitGroup{}
+	wg.Add(len(m.users))
+
+	for _, user := range m.users {
+		go func(user KaitenUser) {
+			defer wg.Done()
+
+			if !m.inactive.create(user) {
+				log.Printf("Skipping inactive Kaiten user %s", user.Email)
+				return
+			}
+			if _, exists := existing[user.Email]; !exists {
+				name := user.FullName
+				if name == "" {
+					name = plankaUsername(user)
+				}
+				userData := PlankaUser{
+					Username: plankaUsername(user),
+					Name:     name,
+					Email:    user.Email,
+					Password: "1234tempPass",
+					Role:     m.config.userRoles.role(user.CompanyRole),
+				}
+				if _, err := m.sink.CreateUser(userData); err != nil {
+					log.Printf("Error creating Planka user %s: %v", userData.Username, err)
+					return
+				}
+				rolesMutex.Lock()
+				m.plankaRoles[user.Email] = userData.Role
+				rolesMutex.Unlock()
+				log.Printf("Created Planka user: %s\n", userData.Username)
+			}
+		}(user)
+	}
+	wg.Wait()
+
+	plankaUsers, err := m.sink.Users()
+	if err != nil {
+		return fmt.Errorf("error fetching Planka users: %w", err)
+	}
+	for _, plankaUser := range plankaUsers {
+		m.plankaUserIds[plankaUser.Email] = plankaUser.ID
+	}
+	m.text = newTextConverter(mentionTargets(m.users, plankaUsers), m.mapping, m.source.URL(), m.sink.CardURL)
+	m.relations = newPendingRelations(m.sink, m.text)
+	return nil
+}
+
+// migrateProjects creates a project for every top-level space and returns
+// them by space UID.
+func (m *migration) migrateProjects(spaces map[string]KaitenSpace) map[string]PlankaProject {
+	plankaProjects := make(map[string]PlankaProject)
+	var projectsMutex sync.Mutex
+
+	wg := &sync.WaitGroup{}
+	wg.Add(len(spaces))
+	for _, space := range spaces {
+		go func(space KaitenSpace) {
+			defer wg.Done()
+			if space.ParentID == "" {
+				plankaProject, err := m.sink.CreateProject(space)
+				if err != nil {
+					log.Printf("Error creating Planka project for space %s: %v", space.Name, err)
+					return
+				}
+
+				projectsMutex.Lock()
+				plankaProjects[plankaProject.KaitenSpaceUID] = plankaProject
+				projectsMutex.Unlock()
+				m.mapping.Set(mappingKindProject, space.UID, plankaProject.ID)
+				m.applyProjectAccess(plankaProject, m.access.space(space, spaces))
+				log.Printf("Planka project: %s with ID: %s\n", plankaProject.Name, plankaProject.ID)
+			}
+		}(space)
+	}
+	wg.Wait()
+	return plankaProjects
+}
+
+func (m *migration) migrateSpaceBoards(space KaitenSpace, spaces map[string]KaitenSpace, plankaProjects map[string]PlankaProject) error {
+	boardTitlePrefix := ""
+	boards, err := m.source.Boards(space)
+	if err != nil {
+		return fmt.Errorf("error getting boards for space %s: %w", space.Name, err)
+	}
+	if len(boards) > 1 {
+		boardTitlePrefix = space.Name + ": "
+		log.Printf("%s\n", boardTitlePrefix)
+	}
+
+	spaceIdforBoard := space.UID
+	if space.ParentID != "" {
+		spaceIdforBoard = space.ParentID
+	}
+	project := plankaProjects[spaces[spaceIdforBoard].UID]
+
+	for _, kaitenBoard := range boards {
+		if len(boards) < 2 {
+			kaitenBoard.Title = space.Name
+		}
+		log.Printf("Board named %s created in project %s\n", boardTitlePrefix+kaitenBoard.Title, project.Name)
+		board, err := m.sink.CreateBoard(project.ID, kaitenBoard, boardTitlePrefix)
+		if err != nil {
+			log.Printf("Error creating Planka board for project %s: %v", project.ID, err)
+			continue
+		}
+		m.mapping.Set(mappingKindBoard, formatKaitenID(kaitenBoard.ID), board.ID)
+		columns, err := m.source.Columns(kaitenBoard)
+		if err != nil {
+			log.Printf("Error getting columns for board %s: %v", board.ID, err)
+			continue
+		}
+		m.applyBoardAccess(project.Name, board, m.access.board(kaitenBoard, space, spaces))
+		for _, column := range columns {
+			m.migrateColumn(board, column)
+		}
+	}
+	return nil
+}
+
+func (m *migration) migrateColumn(board PlankaBoard, column KaitenColumn) {
+	column.Type = "active"
+	plankaColumn, err := m.sink.CreateList(board.ID, column)
+	if err != nil {
+		log.Printf("Error creating Planka column for board %s: %v", board.ID, err)
+		return
+	}
+	m.mapping.Set(mappingKindList, formatKaitenID(column.Id), plankaColumn.ID)
+	log.Printf("Created Planka column: %s in board: %s\n", plankaColumn.Name, board.Name)
+	cards, err := m.source.Cards(column)
+	if err != nil {
+		log.Printf("Error getting cards for column %f: %v", column.Id, err)
+		return
+	}
+
+	for _, card := range cards {
+		if card.Archived {
+			continue
+		}
+		m.migrateCard(board, plankaColumn, card)
+	}
+}
+
+func (m *migration) migrateCard(board PlankaBoard, plankaColumn PlankaList, card KaitenCard) {
+	card.Description = m.text.convert(card.Description)
+	if m.config.propertiesMode == propertiesModeDescription {
+		card.Description = describeKaitenProperties(card, m.properties, m.usersByID)
+	}
+	cardId, err := m.sink.CreateCard(plankaColumn.ID, card, m.config.cardTypes.rule(card.Type).PlankaType)
+	if err != nil {
+		log.Printf("Error creating Planka card in column %s: %v", plankaColumn.ID, err)
+		return
+	}
+	m.mapping.Set(mappingKindCard, formatKaitenID(card.ID), cardId)
+	if description := card.Description; description != "" {
+		if rehosted := m.images.rewrite(cardId, description); rehosted != description {
+			if err := m.sink.UpdateCard(cardId, map[string]any{"description": rehosted}); err != nil {
+				log.Printf("Error updating images in card %s: %v", cardId, err)
+			}
+		}
+	}
+	m.relations.add(card, cardId, board.ID, card.Description)
+	if m.config.propertiesMode == propertiesModeCustomFields {
+		m.processCardProperties(card, cardId, board.ID)
+	}
+	m.processCardMembers(card, cardId, board.ID)
+
+	subscribers, err := m.source.Subscribers(card.ID)
+	if err != nil {
+		log.Printf("Error getting subscribers for card %f: %v", card.ID, err)
+	} else {
+		card.Subscribers = subscribers
+		m.processCardSubscribers(cardId, card.Subscribers)
+	}
+
+	m.processCardTags(card, cardId, board.ID)
+
+	m.processCardType(card, cardId, board.ID)
+
+	m.processCardSize(card, cardId, board.ID)
+
+	if m.config.timeLogs {
+		timeLogs, err := m.source.TimeLogs(card.ID)
+		if err != nil {
+			log.Printf("Error getting time logs for card %f: %v", card.ID, err)
+		} else {
+			m.processCardTimeLogs(cardId, board.ID, timeLogs)
+		}
+	}
+
+	m.processCardChecklists(card, cardId)
+
+	comments, err := m.source.Comments(card.ID)
+	if err == nil && comments != nil {
+		wg := &sync.WaitGroup{}
+		wg.Add(len(comments))
+		for _, comment := range comments {
+			go func(comment KaitenComment) {
+				defer wg.Done()
+				comment.Text = m.images.rewrite(cardId, m.text.convert(comment.Text))
+				comment = m.inactive.comment(comment)
+				commentId, err := m.sink.CreateComment(cardId, comment)
+				if err != nil {
+					log.Printf("Error creating Planka comment for card %s: %v", cardId, err)
+					return
+				}
+				m.relations.addComment(commentId, comment)
+			}(comment)
+		}
+		wg.Wait()
+	}
+	attachments, err := m.source.Attachments(card.ID)
+	if err != nil {
+		log.Printf("Error getting attachments for card %f: %v", card.ID, err)
+	}
+	if attachments != nil {
+		log.Printf("Got attachments for card %s: %v\n", cardId, attachments)
+		m.processCardAttachments(cardId, attachments)
+	}
+
+	log.Printf("Created Planka card: %s in list: %s\n", cardId, plankaColumn.Name)
+}
+
+func (m *migration) processCardChecklists(card KaitenCard, cardId string) {
+	if len(card.Checklists) > 0 {
+		checkListsWG := &sync.WaitGroup{}
+		checkListsWG.Add(len(card.Checklists))
+
+		checklistSemaphore := make(chan struct{}, 3)
+
+		for _, checklistId := range card.Checklists {
+			go func(checklistId float64) {
+				defer checkListsWG.Done()
+
+				checklistSemaphore <- struct{}{}
+				defer func() { <-checklistSemaphore }()
+
+				kaitenList, err := m.source.Checklist(card.ID, checklistId)
+				if err != nil {
+					log.Printf("Error getting checklist for card %s: %v", cardId, err)
+					return
+				}
+
+				listId, err := m.sink.CreateTaskList(cardId, kaitenList.Name)
+				if err != nil {
+					log.Printf("Error creating tasklist for card %s: %v", cardId, err)
+					return
+				}
+
+				if len(kaitenList.Items) > 0 {
+					itemWg := &sync.WaitGroup{}
+					itemWg.Add(len(kaitenList.Items))
+
+					itemSemaphore := make(chan struct{}, 5)
+
+					for _, item := range kaitenList.Items {
+						go func(item KaitenChecklistItem) {
+							defer itemWg.Done()
+
+							itemSemaphore <- struct{}{}
+							defer func() { <-itemSemaphore }()
+
+							taskId, err := m.sink.CreateTask(listId, PlankaTask{Name: item.Text, IsCompleted: item.Checked})
+							if err != nil {
+								log.Printf("Error creating task in checklist for card %s: %v", cardId, err)
+								return
+							}
+							log.Printf("Created task %s in checklist for card %s", taskId, cardId)
+						}(item)
+					}
+
+					itemWg.Wait()
+				}
+
+				log.Printf("Completed processing checklist %f for card %s", checklistId, cardId)
+			}(checklistId)
+		}
+
+		checkListsWG.Wait()
+	}
+
+}
+
+func (m *migration) processCardTags(card KaitenCard, cardId string, boardId string) {
+	if card.TagIds != nil {
+		tagsWG := &sync.WaitGroup{}
+		tagsWG.Add(len(card.TagIds))
+
+		semaphore := make(chan struct{}, 5)
+
+		for _, tagID := range card.TagIds {
+			go func(tagID float64) {
+				defer tagsWG.Done()
+
+				semaphore <- struct{}{}
+				defer func() { <-semaphore }()
+
+				tag, ok := m.tags[tagID]
+				if !ok {
+					tag = KaitenTag{Id: tagID, Name: formatKaitenID(tagID)}
+				}
+				label, err := m.labels.tag(boardId, tag)
+				if err != nil {
+					log.Printf("Error creating label for tag %f: %v", tagID, err)
+					return
+				}
+
+				if err := m.sink.AddCardLabel(cardId, label.Id); err != nil {
+					log.Printf("Error setting Planka label for card %s: %v", cardId, err)
+					return
+				}
+			}(tagID)
+		}
+
+		tagsWG.Wait()
+	}
+}
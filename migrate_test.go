@@ -0,0 +1,599 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memSource is an in-memory Source.
+type memSource struct {
+	users       []KaitenUser
+	tags        map[float64]KaitenTag
+	spaces      map[string]KaitenSpace
+	boards      map[string][]KaitenBoard
+	columns     map[float64][]KaitenColumn
+	cards       map[float64][]KaitenCard
+	comments    map[float64][]KaitenComment
+	attachments map[float64][]KaitenAttachment
+	checklists  map[float64]KaitenChecklist
+	files       map[string]string
+	spaceAccess map[string][]KaitenAccess
+	timeLogs    map[float64][]KaitenTimeLog
+}
+
+func (s *memSource) URL() string { return "https://kaiten.example" }
+
+func (s *memSource) Users() ([]KaitenUser, error)         { return s.users, nil }
+func (s *memSource) Tags() (map[float64]KaitenTag, error) { return s.tags, nil }
+func (s *memSource) CustomProperties() (map[string]KaitenCustomProperty, error) {
+	return map[string]KaitenCustomProperty{}, nil
+}
+
+func (s *memSource) Spaces() (map[string]KaitenSpace, error) { return s.spaces, nil }
+func (s *memSource) Boards(space KaitenSpace) ([]KaitenBoard, error) {
+	return s.boards[space.UID], nil
+}
+func (s *memSource) Columns(board KaitenBoard) ([]KaitenColumn, error) {
+	return s.columns[board.ID], nil
+}
+func (s *memSource) Cards(column KaitenColumn) ([]KaitenCard, error) {
+	return s.cards[column.Id], nil
+}
+
+func (s *memSource) Comments(cardId float64) ([]KaitenComment, error) {
+	return s.comments[cardId], nil
+}
+func (s *memSource) Attachments(cardId float64) ([]KaitenAttachment, error) {
+	return s.attachments[cardId], nil
+}
+func (s *memSource) Checklist(cardId float64, checklistId float64) (KaitenChecklist, error) {
+	checklist, ok := s.checklists[checklistId]
+	if !ok {
+		return KaitenChecklist{}, fmt.Errorf("no checklist %v", checklistId)
+	}
+	return checklist, nil
+}
+func (s *memSource) Subscribers(cardId float64) ([]string, error) { return nil, nil }
+func (s *memSource) TimeLogs(cardId float64) ([]KaitenTimeLog, error) {
+	return s.timeLogs[cardId], nil
+}
+
+func (s *memSource) SpaceAccess(space KaitenSpace) ([]KaitenAccess, error) {
+	return s.spaceAccess[space.UID], nil
+}
+func (s *memSource) BoardAccess(board KaitenBoard) ([]KaitenAccess, error) { return nil, nil }
+func (s *memSource) GroupUsers(groupUID string) ([]float64, error)         { return nil, nil }
+
+func (s *memSource) IsFileURL(fileURL string) bool {
+	return strings.HasPrefix(fileURL, s.URL()+"/files/")
+}
+
+func (s *memSource) OpenFile(fileURL string) (SourceFile, error) {
+	content, ok := s.files[fileURL]
+	if !ok {
+		return SourceFile{}, fmt.Errorf("no file %s", fileURL)
+	}
+	return SourceFile{Body: io.NopCloser(strings.NewReader(content)), Size: int64(len(content))}, nil
+}
+
+// recordingSink is a Sink that records what the migration creates. IDs are
+// derived from names, so they do not depend on the order of the concurrent
+// calls.
+type recordingSink struct {
+	mu           sync.Mutex
+	users        []PlankaUserInfo
+	calls        []string
+	descriptions map[string]string
+	comments     map[string][]KaitenComment
+	tasks        map[string][]PlankaTask
+	attachments  map[string]string
+	commentCount int
+
+	// attachmentErr makes reading attachments back fail.
+	attachmentErr error
+}
+
+func newRecordingSink(users ...PlankaUserInfo) *recordingSink {
+	return &recordingSink{
+		users:        users,
+		descriptions: make(map[string]string),
+		comments:     make(map[string][]KaitenComment),
+		tasks:        make(map[string][]PlankaTask),
+		attachments:  make(map[string]string),
+	}
+}
+
+func (s *recordingSink) record(format string, args ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, fmt.Sprintf(format, args...))
+}
+
+// has reports whether a call was recorded.
+func (s *recordingSink) has(call string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, recorded := range s.calls {
+		if recorded == call {
+			return true
+		}
+	}
+	return false
+}
+
+// index returns the position of a recorded call, or -1.
+func (s *recordingSink) index(call string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, recorded := range s.calls {
+		if recorded == call {
+			return i
+		}
+	}
+	return -1
+}
+
+// count returns how many recorded calls start with prefix.
+func (s *recordingSink) count(prefix string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, recorded := range s.calls {
+		if strings.HasPrefix(recorded, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *recordingSink) AccountEmail() string { return "admin@example.com" }
+
+func (s *recordingSink) Users() ([]PlankaUserInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]PlankaUserInfo(nil), s.users...), nil
+}
+
+func (s *recordingSink) CreateUser(user PlankaUser) (string, error) {
+	s.record("CreateUser %s", user.Email)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := "user:" + user.Email
+	s.users = append(s.users, PlankaUserInfo{ID: id, Email: user.Email, Username: user.Username, Role: user.Role})
+	return id, nil
+}
+
+func (s *recordingSink) SetUserRole(userId string, role string) error {
+	s.record("SetUserRole %s %s", userId, role)
+	return nil
+}
+
+func (s *recordingSink) DeactivateUser(userId string) error {
+	s.record("DeactivateUser %s", userId)
+	return nil
+}
+
+func (s *recordingSink) CreateProject(space KaitenSpace) (PlankaProject, error) {
+	s.record("CreateProject %s", space.Name)
+	return PlankaProject{ID: "project:" + space.Name, Name: space.Name, KaitenSpaceUID: space.UID}, nil
+}
+
+func (s *recordingSink) AddProjectManager(projectId string, userId string) error {
+	s.record("AddProjectManager %s %s", projectId, userId)
+	return nil
+}
+
+func (s *recordingSink) CreateBoard(projectId string, board KaitenBoard, prefix string) (PlankaBoard, error) {
+	s.record("CreateBoard %s %s", projectId, prefix+board.Title)
+	return PlankaBoard{ID: "board:" + prefix + board.Title, Name: prefix + board.Title}, nil
+}
+
+func (s *recordingSink) AddBoardMember(boardId string, userId string, role string, canComment bool) error {
+	s.record("AddBoardMember %s %s %s", boardId, userId, role)
+	return nil
+}
+
+func (s *recordingSink) CreateList(boardId string, column KaitenColumn) (PlankaList, error) {
+	s.record("CreateList %s %s", boardId, column.Name)
+	return PlankaList{ID: "list:" + column.Name, Name: column.Name}, nil
+}
+
+func (s *recordingSink) CreateCard(listId string, card KaitenCard, cardType string) (string, error) {
+	s.record("CreateCard %s %s", listId, card.Title)
+	id := "card:" + card.Title
+	s.mu.Lock()
+	s.descriptions[id] = card.Description
+	s.mu.Unlock()
+	return id, nil
+}
+
+func (s *recordingSink) UpdateCard(cardId string, fields map[string]any) error {
+	if description, ok := fields["description"].(string); ok {
+		s.mu.Lock()
+		s.descriptions[cardId] = description
+		s.mu.Unlock()
+	}
+	if cover, ok := fields["coverAttachmentId"].(string); ok {
+		s.record("SetCover %s %s", cardId, cover)
+	}
+	return nil
+}
+
+func (s *recordingSink) CardURL(cardId string) string {
+	return "https://planka.example/cards/" + cardId
+}
+
+func (s *recordingSink) AddCardMember(cardId string, userId string) error {
+	s.record("AddCardMember %s %s", cardId, userId)
+	return nil
+}
+
+func (s *recordingSink) SubscribeCard(cardId string, email string) error {
+	s.record("SubscribeCard %s %s", cardId, email)
+	return nil
+}
+
+func (s *recordingSink) CreateComment(cardId string, comment KaitenComment) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.comments[cardId] = append(s.comments[cardId], comment)
+	s.commentCount++
+	return fmt.Sprintf("comment:%d", s.commentCount), nil
+}
+
+func (s *recordingSink) UpdateComment(commentId string, authorEmail string, text string) error {
+	s.record("UpdateComment %s", commentId)
+	return nil
+}
+
+func (s *recordingSink) UploadAttachment(cardId string, content io.Reader, name string, mimeType string, authorEmail string) (PlankaAttachment, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return PlankaAttachment{}, err
+	}
+	s.record("UploadAttachment %s %s %s %s", cardId, name, mimeType, data)
+	attachmentURL := "https://planka.example/attachments/" + name
+	s.mu.Lock()
+	s.attachments[attachmentURL] = string(data)
+	s.mu.Unlock()
+	return PlankaAttachment{ID: "attachment:" + name, URL: attachmentURL, Size: int64(len(data))}, nil
+}
+
+func (s *recordingSink) OpenAttachment(attachmentURL string) (SourceFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attachmentErr != nil {
+		return SourceFile{}, s.attachmentErr
+	}
+	content, ok := s.attachments[attachmentURL]
+	if !ok {
+		return SourceFile{}, fmt.Errorf("no attachment %s", attachmentURL)
+	}
+	return SourceFile{Body: io.NopCloser(strings.NewReader(content)), Size: int64(len(content))}, nil
+}
+
+func (s *recordingSink) CreateTaskList(cardId string, name string) (string, error) {
+	s.record("CreateTaskList %s %s", cardId, name)
+	return cardId + "/" + name, nil
+}
+
+func (s *recordingSink) CreateTask(listId string, task PlankaTask) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[listId] = append(s.tasks[listId], task)
+	return listId + "/" + task.Name, nil
+}
+
+func (s *recordingSink) BoardLabels(boardId string) ([]PlankaLabel, error) { return nil, nil }
+
+func (s *recordingSink) CreateLabel(boardId string, label PlankaLabel) (PlankaLabel, error) {
+	s.record("CreateLabel %s %s %s", boardId, label.Name, label.Color)
+	label.Id = "label:" + label.Name
+	return label, nil
+}
+
+func (s *recordingSink) AddCardLabel(cardId string, labelId string) error {
+	s.record("AddCardLabel %s %s", cardId, labelId)
+	return nil
+}
+
+func (s *recordingSink) CreateCustomFieldGroup(boardId string, name string) (string, error) {
+	s.record("CreateCustomFieldGroup %s %s", boardId, name)
+	return "group:" + name, nil
+}
+
+func (s *recordingSink) CreateCustomField(groupId string, field PlankaCustomField) (string, error) {
+	s.record("CreateCustomField %s %s", groupId, field.Name)
+	return "field:" + field.Name, nil
+}
+
+func (s *recordingSink) SetCustomFieldValue(cardId string, groupId string, fieldId string, content string) error {
+	s.record("SetCustomFieldValue %s %s %s", cardId, fieldId, content)
+	return nil
+}
+
+// testSource is one space with one board, two cards linked to each other, a
+// tag, a checklist, a comment by an inactive user and an attachment.
+func testSource() *memSource {
+	return &memSource{
+		users: []KaitenUser{
+			{ID: 1, Email: "ann@example.com", FullName: "Ann", Username: "ann"},
+			{ID: 2, Email: "bob@example.com", FullName: "Bob", Username: "bob", Inactive: true},
+		},
+		tags:   map[float64]KaitenTag{5: {Id: 5, Name: "bug", Color: 1}},
+		spaces: map[string]KaitenSpace{"s1": {ID: 1, Name: "Alpha", UID: "s1"}},
+		boards: map[string][]KaitenBoard{"s1": {{ID: 10, Title: "Main"}}},
+		columns: map[float64][]KaitenColumn{
+			10: {{Id: 100, Name: "Todo", BoardID: 10}},
+		},
+		cards: map[float64][]KaitenCard{
+			100: {
+				{
+					ID:          1000,
+					Title:       "First",
+					Description: "Ask @ann about https://kaiten.example/card/1001\n\n- one\n- two",
+					TagIds:      []float64{5},
+					Checklists:  []float64{7},
+					Members:     []KaitenCardMember{{Email: "ann@example.com", FullName: "Ann", Type: kaitenMemberTypeResponsible}},
+					ChildIds:    []float64{1001},
+				},
+				{ID: 1001, Title: "Second", TagIds: []float64{5}},
+				{ID: 1002, Title: "Old", Archived: true},
+			},
+		},
+		comments: map[float64][]KaitenComment{
+			1000: {{ID: 1, AuthorEmail: "bob@example.com", Text: "Done by `@ann`"}},
+		},
+		attachments: map[float64][]KaitenAttachment{
+			1000: {{ID: 1, Name: "notes.txt", URL: "https://kaiten.example/files/notes.txt", Size: 5, AuthorEmail: "ann@example.com"}},
+		},
+		checklists: map[float64]KaitenChecklist{
+			7: {Name: "Steps", Items: []KaitenChecklistItem{{Text: "plan", Checked: true}, {Text: "build"}}},
+		},
+		files: map[string]string{"https://kaiten.example/files/notes.txt": "hello"},
+	}
+}
+
+func testMigrationConfig(t *testing.T) migrationConfig {
+	t.Helper()
+	config, err := loadMigrationConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.propertiesMode = propertiesModeCustomFields
+	config.inactiveUsers = inactiveUsersDisable
+	config.permissionsReport = filepath.Join(t.TempDir(), "permissions.csv")
+	config.verifyChecksums = false
+	config.colors = nil
+	return config
+}
+
+func runTestMigration(t *testing.T, source Source, sink *recordingSink, config migrationConfig) *mappingStore {
+	t.Helper()
+	mapping, err := loadMappingStore(filepath.Join(t.TempDir(), "mapping.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := newMigration(source, sink, mapping, config).run(); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	return mapping
+}
+
+func TestMigrationRun(t *testing.T) {
+	sink := newRecordingSink(
+		PlankaUserInfo{ID: "admin", Email: "admin@example.com", Username: "admin"},
+		PlankaUserInfo{ID: "user:ann", Email: "ann@example.com", Username: "ann.p"},
+	)
+	mapping := runTestMigration(t, testSource(), sink, testMigrationConfig(t))
+
+	for _, call := range []string{
+		"CreateUser bob@example.com",
+		"CreateProject Alpha",
+		"CreateBoard project:Alpha Alpha",
+		"CreateList board:Alpha Todo",
+		"CreateCard list:Todo First",
+		"CreateCard list:Todo Second",
+		"CreateLabel board:Alpha bug berry-red",
+		"AddCardLabel card:First label:bug",
+		"AddCardLabel card:Second label:bug",
+		"AddCardMember card:First user:ann",
+		"CreateTaskList card:First Steps",
+		"UploadAttachment card:First notes.txt text/plain hello",
+		"DeactivateUser user:bob@example.com",
+	} {
+		if !sink.has(call) {
+			t.Errorf("missing call %q", call)
+		}
+	}
+	if sink.has("CreateCard list:Todo Old") {
+		t.Error("archived card was migrated")
+	}
+	if sink.has("CreateUser ann@example.com") {
+		t.Error("existing user was created again")
+	}
+	if n := sink.count("CreateLabel board:Alpha bug "); n != 1 {
+		t.Errorf("tag label created %d times, want once", n)
+	}
+
+	description := sink.descriptions["card:First"]
+	for _, want := range []string{"Ask @ann.p about https://planka.example/cards/card:Second", "- one\n- two", "## Связи"} {
+		if !strings.Contains(description, want) {
+			t.Errorf("description %q does not contain %q", description, want)
+		}
+	}
+
+	comments := sink.comments["card:First"]
+	if len(comments) != 1 || comments[0].AuthorEmail != "bob@example.com" || comments[0].Text != "Done by `@ann`" {
+		t.Errorf("comments = %+v", comments)
+	}
+
+	var tasks []string
+	for _, task := range sink.tasks["card:First/Steps"] {
+		tasks = append(tasks, fmt.Sprintf("%s:%v", task.Name, task.IsCompleted))
+	}
+	sort.Strings(tasks)
+	if strings.Join(tasks, ",") != "build:false,plan:true" {
+		t.Errorf("tasks = %v", tasks)
+	}
+	if len(sink.tasks["card:First/"+childrenTasklistName]) != 1 {
+		t.Errorf("children tasks = %+v", sink.tasks["card:First/"+childrenTasklistName])
+	}
+
+	for kind, ids := range map[string][2]string{
+		mappingKindProject: {"s1", "project:Alpha"},
+		mappingKindBoard:   {"10", "board:Alpha"},
+		mappingKindList:    {"100", "list:Todo"},
+		mappingKindCard:    {"1001", "card:Second"},
+	} {
+		if got, _ := mapping.Get(kind, ids[0]); got != ids[1] {
+			t.Errorf("mapping %s %s = %q, want %q", kind, ids[0], got, ids[1])
+		}
+	}
+}
+
+func TestMigrationSkipsInactiveUsers(t *testing.T) {
+	sink := newRecordingSink(PlankaUserInfo{ID: "admin", Email: "admin@example.com", Username: "admin"})
+	config := testMigrationConfig(t)
+	config.inactiveUsers = inactiveUsersSkip
+	runTestMigration(t, testSource(), sink, config)
+
+	if sink.has("CreateUser bob@example.com") {
+		t.Error("inactive user was created")
+	}
+	if sink.count("DeactivateUser ") != 0 {
+		t.Error("users were deactivated under the skip policy")
+	}
+	comments := sink.comments["card:First"]
+	if len(comments) != 1 || comments[0].AuthorEmail != "" || !strings.HasPrefix(comments[0].Text, "**Bob**:") {
+		t.Errorf("comments = %+v", comments)
+	}
+}
+
+func TestMigrationDescriptionProperties(t *testing.T) {
+	source := testSource()
+	source.cards[100][1].Properties = map[string]any{"id_1": "High"}
+	sink := newRecordingSink(PlankaUserInfo{ID: "admin", Email: "admin@example.com", Username: "admin"})
+	config := testMigrationConfig(t)
+	config.propertiesMode = propertiesModeDescription
+	runTestMigration(t, source, sink, config)
+
+	want := "## Детализация\n\n**id_1**: High\n\n## Описание\n\n"
+	if got := sink.descriptions["card:Second"]; got != want {
+		t.Errorf("description = %q, want %q", got, want)
+	}
+	if sink.count("CreateCustomField ") != 0 {
+		t.Error("custom fields were created in description mode")
+	}
+}
+
+func TestMigrationPromotesOwnersBeforeManagers(t *testing.T) {
+	source := testSource()
+	source.users = append(source.users, KaitenUser{ID: 3, Email: "carol@example.com", FullName: "Carol", Username: "carol", CompanyRole: kaitenCompanyRoleUser})
+	source.spaceAccess = map[string][]KaitenAccess{"s1": {{UserID: 3, Email: "carol@example.com", Role: kaitenAccessOwner}}}
+	sink := newRecordingSink(PlankaUserInfo{ID: "admin", Email: "admin@example.com", Username: "admin"})
+	runTestMigration(t, source, sink, testMigrationConfig(t))
+
+	promoted := sink.index("SetUserRole user:carol@example.com " + plankaRoleProjectOwner)
+	manager := sink.index("AddProjectManager project:Alpha user:carol@example.com")
+	if promoted < 0 || manager < 0 || promoted > manager {
+		t.Errorf("promotion at %d, project manager at %d: want the promotion first", promoted, manager)
+	}
+}
+
+func TestMigrationPromotesExistingOwners(t *testing.T) {
+	source := testSource()
+	source.users = append(source.users,
+		KaitenUser{ID: 3, Email: "dave@example.com", FullName: "Dave", Username: "dave", CompanyRole: kaitenCompanyRoleUser},
+		KaitenUser{ID: 4, Email: "erin@example.com", FullName: "Erin", Username: "erin", CompanyRole: kaitenCompanyRoleUser},
+	)
+	source.spaceAccess = map[string][]KaitenAccess{"s1": {
+		{UserID: 3, Email: "dave@example.com", Role: kaitenAccessOwner},
+		{UserID: 4, Email: "erin@example.com", Role: kaitenAccessOwner},
+	}}
+	sink := newRecordingSink(
+		PlankaUserInfo{ID: "admin", Email: "admin@example.com", Username: "admin"},
+		PlankaUserInfo{ID: "user:dave", Email: "dave@example.com", Username: "dave", Role: plankaRoleBoardUser},
+		PlankaUserInfo{ID: "user:erin", Email: "erin@example.com", Username: "erin", Role: plankaRoleAdmin},
+	)
+	config := testMigrationConfig(t)
+	runTestMigration(t, source, sink, config)
+
+	if sink.has("CreateUser dave@example.com") {
+		t.Error("existing user was created again")
+	}
+	promoted := sink.index("SetUserRole user:dave " + plankaRoleProjectOwner)
+	manager := sink.index("AddProjectManager project:Alpha user:dave")
+	if promoted < 0 || manager < 0 || promoted > manager {
+		t.Errorf("promotion at %d, project manager at %d: want the promotion first", promoted, manager)
+	}
+	if sink.count("SetUserRole user:erin ") != 0 {
+		t.Error("administrator was demoted to project owner")
+	}
+	report, err := os.ReadFile(config.permissionsReport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(report), "instance,,,dave@example.com,user,projectOwner,space owner") {
+		t.Errorf("permission report has no promotion of the existing owner:\n%s", report)
+	}
+}
+
+func TestMigrationAttachmentMetadata(t *testing.T) {
+	source := testSource()
+	source.attachments[1000][0].MimeType = "text/markdown"
+	source.attachments[1000][0].Cover = true
+	source.attachments[1000][0].AuthorName = "Ann"
+	source.attachments[1000][0].CreatedAt = "2024-03-01T10:20:00Z"
+	sink := newRecordingSink(PlankaUserInfo{ID: "admin", Email: "admin@example.com", Username: "admin"})
+	sink.attachmentErr = fmt.Errorf("not stored")
+	config := testMigrationConfig(t)
+	config.verifyChecksums = true
+	runTestMigration(t, source, sink, config)
+
+	if !sink.has("UploadAttachment card:First notes.txt text/markdown hello") {
+		t.Error("attachment was not uploaded with its Kaiten MIME type")
+	}
+	if !sink.has("SetCover card:First attachment:notes.txt") {
+		t.Error("cover was not set after the checksum check failed")
+	}
+	comments := sink.comments["card:First"]
+	if len(comments) != 2 || !strings.Contains(comments[1].Text, "| notes.txt | Ann | 2024-03-01 10:20 |") {
+		t.Errorf("comments = %+v", comments)
+	}
+}
+
+func TestMigrationTimeLogs(t *testing.T) {
+	source := testSource()
+	source.timeLogs = map[float64][]KaitenTimeLog{1000: {
+		{UserID: 1, UserName: "Ann", Minutes: 30, ForDate: "2024-03-01"},
+		{UserID: 2, UserName: "Bob", Minutes: 45, ForDate: "2024-03-02"},
+		{UserID: 1, UserName: "Ann", Minutes: 60, ForDate: "2024-03-03"},
+	}}
+	sink := newRecordingSink(PlankaUserInfo{ID: "admin", Email: "admin@example.com", Username: "admin"})
+	runTestMigration(t, source, sink, testMigrationConfig(t))
+
+	for _, call := range sink.calls {
+		if strings.HasPrefix(call, "CreateCustomField ") && strings.Contains(call, "Время:") {
+			t.Errorf("per-user time field created: %q", call)
+		}
+	}
+	if !sink.has("SetCustomFieldValue card:First field:Время 2ч 15м") {
+		t.Error("total time field was not set")
+	}
+	var timeComment string
+	for _, comment := range sink.comments["card:First"] {
+		if strings.HasPrefix(comment.Text, "## Учёт времени") {
+			timeComment = comment.Text
+		}
+	}
+	if !strings.Contains(timeComment, "- Ann: 1ч 30м\n- Bob: 45м") {
+		t.Errorf("time log comment %q has no per-user totals", timeComment)
+	}
+}
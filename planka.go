@@ -6,35 +6,17 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"mime/multipart"
 	"net/http"
+	"net/textproto"
+	"net/url"
 	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 )
 
-var PlankaColors = []string{
-	"light-mud",
-	"piggy-red",
-	"pink-tulip",
-	"lavender-fields",
-	"sugar-plum",
-	"antique-blue",
-	"morning-sky",
-	"summer-sky",
-	"french-coast",
-	"turquoise-sea",
-	"tank-green",
-	"bright-moss",
-	"fresh-salad",
-	"desert-sand",
-	"apricot-red",
-	"dark-granite",
-	"light-concrete",
-	"light-mud",
-}
-
 type PlankaUser struct {
 	Username string `json:"username"`
 	Name     string `json:"name"`
@@ -43,6 +25,16 @@ type PlankaUser struct {
 	Role     string `json:"role"`
 }
 
+type PlankaUserInfo struct {
+	ID            string `json:"id"`
+	Email         string `json:"email"`
+	Username      string `json:"username"`
+	Name          string `json:"name"`
+	Role          string `json:"role,omitempty"`
+	IsDeactivated bool   `json:"isDeactivated,omitempty"`
+	UpdatedAt     string `json:"updatedAt"`
+}
+
 type PlankaProject struct {
 	Name           string   `json:"name"`
 	Description    string   `json:"desc"`
@@ -51,6 +43,8 @@ type PlankaProject struct {
 	KaitenSpaceID  float64  `json:"kaiten_space_id"`
 	KaitenSpaceUID string   `json:"kaiten_space_uid"`
 	Boards         []string `json:"boards,omitempty"`
+	// Existing is set when a project of the same name was reused.
+	Existing bool `json:"-"`
 }
 
 type PlankaCardMember struct {
@@ -77,7 +71,7 @@ type PlankaBoardMember struct {
 type PlankaCard struct {
 	Position    float64 `json:"position"`
 	Name        string  `json:"name"`
-	Description string  `json:"description"`
+	Description string  `json:"description,omitempty"`
 	Type        string  `json:"type"`
 	Start       string  `json:"start,omitempty"`
 	DueDate     string  `json:"dueDate,omitempty"`
@@ -94,9 +88,10 @@ type PlankaTaskList struct {
 }
 
 type PlankaTask struct {
-	Position    float64 `json:"position"`
-	Name        string  `json:"name"`
-	IsCompleted bool    `json:"isCompleted"`
+	Position     float64 `json:"position"`
+	Name         string  `json:"name"`
+	IsCompleted  bool    `json:"isCompleted"`
+	LinkedCardID string  `json:"linkedCardId,omitempty"`
 }
 
 type PlankaLabel struct {
@@ -110,6 +105,171 @@ type PlankaLabelForCard struct {
 	ID string `json:"labelId"`
 }
 
+type PlankaAttachment struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+}
+
+// PlankaBoardContents is everything on a board, as PLANKA includes it in the
+// board response.
+type PlankaBoardContents struct {
+	Board            PlankaBoardInfo         `json:"-"`
+	BoardMemberships []PlankaBoardMemberInfo `json:"boardMemberships"`
+	Lists            []PlankaListInfo        `json:"lists"`
+	Cards            []PlankaCardInfo        `json:"cards"`
+	Labels           []PlankaLabel           `json:"labels"`
+	CardLabels       []PlankaCardLabelInfo   `json:"cardLabels"`
+	CardMemberships  []PlankaCardMemberInfo  `json:"cardMemberships"`
+	TaskLists        []PlankaTaskListInfo    `json:"taskLists"`
+	Tasks            []PlankaTaskInfo        `json:"tasks"`
+	Attachments      []PlankaAttachmentInfo  `json:"attachments"`
+	// CustomFieldGroups holds board and card groups; CardID is empty for
+	// board groups.
+	CustomFieldGroups []PlankaCustomFieldGroupInfo `json:"customFieldGroups"`
+	CustomFields      []PlankaCustomFieldInfo      `json:"customFields"`
+	CustomFieldValues []PlankaCustomFieldValueInfo `json:"customFieldValues"`
+}
+
+type PlankaBoardInfo struct {
+	ID        string  `json:"id"`
+	ProjectID string  `json:"projectId"`
+	Position  float64 `json:"position"`
+	Name      string  `json:"name"`
+	UpdatedAt string  `json:"updatedAt"`
+}
+
+type PlankaListInfo struct {
+	ID        string  `json:"id"`
+	Type      string  `json:"type"`
+	Position  float64 `json:"position"`
+	Name      string  `json:"name"`
+	UpdatedAt string  `json:"updatedAt"`
+}
+
+// PlankaProjectInfo is a project with its boards and the user IDs of its
+// managers.
+type PlankaProjectInfo struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	UpdatedAt string            `json:"updatedAt"`
+	Boards    []PlankaBoardInfo `json:"-"`
+	Managers  []string          `json:"-"`
+}
+
+type PlankaCardInfo struct {
+	ID          string  `json:"id"`
+	ListID      string  `json:"listId"`
+	Position    float64 `json:"position"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Type        string  `json:"type"`
+	DueDate     string  `json:"dueDate"`
+	// CoverAttachmentID is empty when the card has no cover.
+	CoverAttachmentID string `json:"coverAttachmentId"`
+	// CommentsTotal is missing in PLANKA versions that do not count comments.
+	CommentsTotal *int   `json:"commentsTotal"`
+	CreatedAt     string `json:"createdAt"`
+	UpdatedAt     string `json:"updatedAt"`
+}
+
+type PlankaBoardMemberInfo struct {
+	UserID     string `json:"userId"`
+	Role       string `json:"role"`
+	CanComment *bool  `json:"canComment"`
+}
+
+type PlankaCardLabelInfo struct {
+	CardID  string `json:"cardId"`
+	LabelID string `json:"labelId"`
+}
+
+type PlankaCardMemberInfo struct {
+	CardID string `json:"cardId"`
+	UserID string `json:"userId"`
+}
+
+type PlankaTaskListInfo struct {
+	ID       string  `json:"id"`
+	CardID   string  `json:"cardId"`
+	Position float64 `json:"position"`
+	Name     string  `json:"name"`
+}
+
+type PlankaTaskInfo struct {
+	ID          string  `json:"id"`
+	TaskListID  string  `json:"taskListId"`
+	Position    float64 `json:"position"`
+	Name        string  `json:"name"`
+	IsCompleted bool    `json:"isCompleted"`
+}
+
+type PlankaAttachmentInfo struct {
+	ID            string `json:"id"`
+	CardID        string `json:"cardId"`
+	CreatorUserID string `json:"creatorUserId"`
+	// Type is "file" or "link", empty in PLANKA versions without links.
+	Type string `json:"type"`
+	Name string `json:"name"`
+	Data struct {
+		URL         string `json:"url"`
+		Size        any    `json:"size"`
+		SizeInBytes any    `json:"sizeInBytes"`
+		MimeType    string `json:"mimeType"`
+	} `json:"data"`
+}
+
+// Size is the stored size in bytes, 0 when PLANKA does not report it.
+func (a PlankaAttachmentInfo) Size() int64 {
+	if size := plankaSize(a.Data.SizeInBytes); size != 0 {
+		return size
+	}
+	return plankaSize(a.Data.Size)
+}
+
+type PlankaCustomFieldGroupInfo struct {
+	ID       string  `json:"id"`
+	BoardID  string  `json:"boardId"`
+	CardID   string  `json:"cardId"`
+	Position float64 `json:"position"`
+	Name     string  `json:"name"`
+}
+
+type PlankaCustomFieldInfo struct {
+	ID                 string  `json:"id"`
+	CustomFieldGroupID string  `json:"customFieldGroupId"`
+	Position           float64 `json:"position"`
+	Name               string  `json:"name"`
+	ShowOnFrontOfCard  bool    `json:"showOnFrontOfCard"`
+}
+
+type PlankaCustomFieldValueInfo struct {
+	CardID             string `json:"cardId"`
+	CustomFieldGroupID string `json:"customFieldGroupId"`
+	CustomFieldID      string `json:"customFieldId"`
+	Content            string `json:"content"`
+}
+
+type PlankaCommentInfo struct {
+	ID        string `json:"id"`
+	UserID    string `json:"userId"`
+	Text      string `json:"text"`
+	CreatedAt string `json:"createdAt"`
+}
+
+type PlankaCustomFieldGroup struct {
+	Position float64 `json:"position"`
+	Name     string  `json:"name"`
+}
+
+type PlankaCustomField struct {
+	Position          float64 `json:"position"`
+	Name              string  `json:"name"`
+	ShowOnFrontOfCard bool    `json:"showOnFrontOfCard"`
+}
+
 var (
 	// Planka environment variables cache
 	plankaURL       string
@@ -209,47 +369,37 @@ func plankaUploadFile(filepath string, url string, filename string) ([]byte, err
 	}
 	defer file.Close()
 
-	requestBody := &bytes.Buffer{}
-	writer := multipart.NewWriter(requestBody)
-
-	if err := writer.WriteField("name", filename); err != nil {
-		return nil, fmt.Errorf("failed to write field 'name': %w", err)
-	}
-	if err := writer.WriteField("type", "file"); err != nil {
-		return nil, fmt.Errorf("failed to write field 'type': %w", err)
-	}
-
-	part, err := writer.CreateFormFile("file", filepath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create form file part: %w", err)
-	}
+	return plankaUploadStream(file, url, filename, "", plankaToken)
+}
 
-	if _, err := io.Copy(part, file); err != nil {
-		return nil, fmt.Errorf("failed to copy file content to part: %w", err)
-	}
+// plankaUploadStream uploads file content as a multipart form without
+// buffering it: the form is written into a pipe while the request is sent.
+func plankaUploadStream(content io.Reader, url string, filename string, mimeType string, token string) ([]byte, error) {
+	pipeReader, pipeWriter := io.Pipe()
+	writer := multipart.NewWriter(pipeWriter)
 
-	if err := writer.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close multipart writer: %w", err)
-	}
+	go func() {
+		pipeWriter.CloseWithError(writeUploadForm(writer, content, filename, mimeType))
+	}()
 
-	req, err := http.NewRequest("POST", plankaURL+url, requestBody)
+	req, err := http.NewRequest("POST", plankaURL+url, pipeReader)
 	if err != nil {
+		pipeReader.CloseWithError(err)
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Set("Authorization", "Bearer "+plankaToken)
-
-	client := clientPool.Get().(*http.Client)
-	defer clientPool.Put(client)
+	req.Header.Set("Authorization", "Bearer "+token)
 
-	resp, err := client.Do(req)
+	resp, err := streamClient.Do(req)
 	if err != nil {
+		pipeReader.CloseWithError(err)
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		pipeReader.CloseWithError(fmt.Errorf("upload rejected with status %d", resp.StatusCode))
 		body, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, body)
 	}
@@ -261,6 +411,35 @@ func plankaUploadFile(filepath string, url string, filename string) ([]byte, err
 	return body, nil
 }
 
+func writeUploadForm(writer *multipart.Writer, content io.Reader, filename string, mimeType string) error {
+	if err := writer.WriteField("name", filename); err != nil {
+		return fmt.Errorf("failed to write field 'name': %w", err)
+	}
+	if err := writer.WriteField("type", "file"); err != nil {
+		return fmt.Errorf("failed to write field 'type': %w", err)
+	}
+
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": "file", "filename": filename}))
+	header.Set("Content-Type", mimeType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return fmt.Errorf("failed to create form file part: %w", err)
+	}
+
+	if _, err := io.Copy(part, content); err != nil {
+		return fmt.Errorf("failed to copy file content to part: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to close multipart writer: %w", err)
+	}
+	return nil
+}
+
 func plankaAPICallByUser(jsonPayload []byte, url string, method string, token string) ([]byte, error) {
 
 	req, err := http.NewRequest(method, plankaURL+url, bytes.NewBuffer(jsonPayload))
@@ -476,6 +655,21 @@ func getPlankaUsersMails() ([]string, error) {
 	return emails, nil
 }
 
+func getPlankaUsers() ([]PlankaUserInfo, error) {
+	body, err := plankaAPICall(nil, "/api/users", "GET")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch users: %w", err)
+	}
+
+	var response struct {
+		Items []PlankaUserInfo `json:"items"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON response: %w", err)
+	}
+	return response.Items, nil
+}
+
 func getPlankaUserIDByEmail(email string) (string, error) {
 	body, err := plankaAPICall(nil, "/api/users", "GET")
 	if err != nil {
@@ -504,16 +698,51 @@ func getPlankaUserIDByEmail(email string) (string, error) {
 	return "", fmt.Errorf("user with email %s not found", email)
 }
 
-func createPlankaUser(user PlankaUser) error {
+// createPlankaUser returns the ID of the created user, or "" when PLANKA
+// refused to create it, e.g. because the user already exists.
+func createPlankaUser(user PlankaUser) (string, error) {
 	userJson, err := json.Marshal(user)
 	if err != nil {
-		return fmt.Errorf("error marshalling user data: %w", err)
+		return "", fmt.Errorf("error marshalling user data: %w", err)
 	}
 	body, err := plankaAPICall(userJson, "/api/users", "POST")
 	if body == nil && err != nil {
-		return fmt.Errorf("failed to create user")
+		return "", fmt.Errorf("failed to create user")
+	}
+	if err != nil {
+		return "", nil
+	}
+
+	var response struct {
+		Item struct {
+			ID string `json:"id"`
+		} `json:"item"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("failed to parse JSON: %w", err)
 	}
+	return response.Item.ID, nil
+}
+
+func updatePlankaUserRole(userId string, role string) error {
+	roleJson, err := json.Marshal(map[string]string{"role": role})
+	if err != nil {
+		return fmt.Errorf("error marshalling user role: %w", err)
+	}
+	if _, err := plankaAPICall(roleJson, "/api/users/"+userId, "PATCH"); err != nil {
+		return fmt.Errorf("failed to update user role: %w", err)
+	}
+	return nil
+}
 
+func deactivatePlankaUser(userId string) error {
+	userJson, err := json.Marshal(map[string]bool{"isDeactivated": true})
+	if err != nil {
+		return fmt.Errorf("error marshalling user data: %w", err)
+	}
+	if _, err := plankaAPICall(userJson, "/api/users/"+userId, "PATCH"); err != nil {
+		return fmt.Errorf("failed to deactivate user: %w", err)
+	}
 	return nil
 }
 
@@ -594,6 +823,7 @@ func createPlankaProject(space KaitenSpace) (PlankaProject, error) {
 			Name:           existingProject.Name,
 			KaitenSpaceID:  space.ID,
 			KaitenSpaceUID: space.UID,
+			Existing:       true,
 		}, nil
 	} else {
 		body, err := plankaAPICall(projectJson, "/api/projects", "POST")
@@ -609,7 +839,7 @@ func createPlankaProject(space KaitenSpace) (PlankaProject, error) {
 		}
 
 		if err := json.Unmarshal(body, &unmBody); err != nil {
-			log.Fatalf("failed to parse JSON: %w", err)
+			return PlankaProject{}, fmt.Errorf("failed to parse JSON: %w", err)
 		}
 		createdProject.ID = unmBody.(map[string]interface{})["item"].(map[string]interface{})["id"].(string)
 		createdProject.Description = ""
@@ -650,11 +880,10 @@ func createPlankaBoard(projectId string, board KaitenBoard, prefix string) (Plan
 
 }
 
-func setPlankaBoardMember(boardId string, member string) error {
+func setPlankaBoardMember(boardId string, member string, role string, canComment bool) error {
 	var boardMember PlankaBoardMember
 	boardMember.UserId = member
-	boardMember.Role = "editor"
-	canComment := true
+	boardMember.Role = role
 	boardMember.CanComment = &canComment
 	memberJson, err := json.Marshal(boardMember)
 	if err != nil {
@@ -662,7 +891,18 @@ func setPlankaBoardMember(boardId string, member string) error {
 	}
 	body, err := plankaAPICall(memberJson, "/api/boards/"+boardId+"/board-memberships", "POST")
 	if body == nil && err != nil {
-		return fmt.Errorf("failed to create list")
+		return fmt.Errorf("failed to create board membership: %w", err)
+	}
+	return nil
+}
+
+func addPlankaProjectManager(projectId string, userId string) error {
+	managerJson, err := json.Marshal(map[string]string{"userId": userId})
+	if err != nil {
+		return fmt.Errorf("error marshalling project manager: %w", err)
+	}
+	if _, err := plankaAPICall(managerJson, "/api/projects/"+projectId+"/project-managers", "POST"); err != nil {
+		return fmt.Errorf("failed to add project manager: %w", err)
 	}
 	return nil
 }
@@ -705,12 +945,12 @@ func setPlankaCardNumber(cardId string, member string) error {
 	return nil
 }
 
-func createPlankaCard(listId string, card KaitenCard) (string, error) {
+func createPlankaCard(listId string, card KaitenCard, cardType string) (string, error) {
 	var plankaCard PlankaCard
 	plankaCard.Name = card.Title
 	plankaCard.Description = card.Description
 	plankaCard.Position = card.SortOrder
-	plankaCard.Type = "project"
+	plankaCard.Type = cardType
 
 	if card.DueDate != "" {
 		plankaCard.DueDate = card.DueDate
@@ -738,6 +978,32 @@ func createPlankaCard(listId string, card KaitenCard) (string, error) {
 	return bodyInterface.(map[string]interface{})["item"].(map[string]interface{})["id"].(string), nil
 }
 
+func updatePlankaCard(cardId string, fields map[string]any) error {
+	jsonPayload, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("error marshalling card data: %w", err)
+	}
+	if _, err := plankaAPICall(jsonPayload, "/api/cards/"+cardId, "PATCH"); err != nil {
+		return fmt.Errorf("error sending request to update card: %w", err)
+	}
+	return nil
+}
+
+func subscribePlankaCard(cardId string, token string) error {
+	jsonPayload, err := json.Marshal(map[string]bool{"isSubscribed": true})
+	if err != nil {
+		return fmt.Errorf("error marshalling subscription: %w", err)
+	}
+	if _, err := plankaAPICallByUser(jsonPayload, "/api/cards/"+cardId, "PATCH", token); err != nil {
+		return fmt.Errorf("error sending request to subscribe to card: %w", err)
+	}
+	return nil
+}
+
+func plankaCardURL(cardId string) string {
+	return plankaURL + "/cards/" + cardId
+}
+
 func getPlankaAccessToken(email string) (string, error) {
 	var user PlankaUserCreds
 	user.Email = email
@@ -757,7 +1023,7 @@ func getPlankaAccessToken(email string) (string, error) {
 	}
 	var tokenResponse map[string]interface{}
 	if err := json.Unmarshal(body, &tokenResponse); err != nil {
-		log.Fatalf("failed to parse JSON: %w", err)
+		return "", fmt.Errorf("failed to parse JSON: %w", err)
 	}
 	if token, ok := tokenResponse["item"].(string); ok && token != "" {
 		return token, nil
@@ -766,68 +1032,148 @@ func getPlankaAccessToken(email string) (string, error) {
 	}
 }
 
-func createPlankaCommentForCard(cardId string, comment KaitenComment) error {
-	token, err := getPlankaAccessToken(comment.AuthorEmail)
+func createPlankaCommentForCard(cardId string, comment KaitenComment) (string, error) {
+	token, err := plankaUserToken(comment.AuthorEmail)
 	if err != nil {
-		log.Printf("error getting Planka access token for email %s: %w", comment.AuthorEmail, err)
-		token, err = getPlankaAccessToken(plankaAdminMail)
-		if err != nil {
-			return fmt.Errorf("error getting Planka access token for email %s: %w", comment.AuthorEmail, err)
-		}
+		return "", err
 	}
 	log.Printf("Using token %s for email %s\n", token, comment.AuthorEmail)
 	id, err := getPlankaUserIDByEmail(comment.AuthorEmail)
 	if err != nil {
-		return fmt.Errorf("error getting Planka user ID for email %s: %w", comment.AuthorEmail, err)
+		return "", fmt.Errorf("error getting Planka user ID for email %s: %w", comment.AuthorEmail, err)
 	}
 	commentJson, err := json.Marshal(map[string]string{
 		"text":   comment.Text,
 		"userId": id,
 	})
 	if err != nil {
-		return fmt.Errorf("error marshalling comment data: %w", err)
+		return "", fmt.Errorf("error marshalling comment data: %w", err)
 	}
 	body, err := plankaAPICallByUser(commentJson, "/api/cards/"+cardId+"/comments", "POST", token)
+	if body == nil && err != nil && comment.AuthorEmail != plankaAdminMail {
+		// Authors without access to the board comment through the administrator.
+		log.Printf("Commenting as %s failed, commenting as administrator: %v", comment.AuthorEmail, err)
+		commentJson, err = json.Marshal(map[string]string{
+			"text": "**" + comment.AuthorEmail + "**:\n\n" + comment.Text,
+		})
+		if err != nil {
+			return "", fmt.Errorf("error marshalling comment data: %w", err)
+		}
+		body, err = plankaAPICall(commentJson, "/api/cards/"+cardId+"/comments", "POST")
+	}
 	if body == nil && err != nil {
-		fmt.Println("Response body:", body)
-		return fmt.Errorf("failed to create comment")
+		return "", fmt.Errorf("failed to create comment: %w", err)
+	}
+	var jsonResponse map[string]interface{}
+	if err := json.Unmarshal(body, &jsonResponse); err != nil {
+		return "", fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return jsonResponse["item"].(map[string]interface{})["id"].(string), nil
+}
+
+func updatePlankaCommentText(commentId string, authorEmail string, text string) error {
+	token, err := plankaUserToken(authorEmail)
+	if err != nil {
+		return err
+	}
+	commentJson, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return fmt.Errorf("error marshalling comment data: %w", err)
+	}
+	if _, err := plankaAPICallByUser(commentJson, "/api/comments/"+commentId, "PATCH", token); err != nil {
+		return fmt.Errorf("error sending request to update comment: %w", err)
 	}
 	return nil
 }
 
-func createPlankaAttachmentForCard(cardId string, attachment KaitenAttachment) (string, error) {
-	outputFileName := filepath.Base(attachment.URL)
-	outputFile, err := os.Create(outputFileName)
+// plankaUserToken returns the token to act as the given user with, falling
+// back to the administrator.
+func plankaUserToken(email string) (string, error) {
+	token, err := getPlankaAccessToken(email)
 	if err != nil {
-		return "", fmt.Errorf("error creating file: %w", err)
+		log.Printf("error getting Planka access token for email %s: %v", email, err)
+		token, err = getPlankaAccessToken(plankaAdminMail)
+		if err != nil {
+			return "", fmt.Errorf("error getting Planka access token for email %s: %w", email, err)
+		}
 	}
+	return token, nil
+}
 
-	response, err := http.Get(attachment.URL)
+// uploadPlankaAttachment streams content to the card as a new attachment and
+// returns the created attachment.
+func uploadPlankaAttachment(cardId string, content io.Reader, name string, mimeType string, token string) (PlankaAttachment, error) {
+	body, err := plankaUploadStream(content, "/api/cards/"+cardId+"/attachments", name, mimeType, token)
 	if err != nil {
-		return "", fmt.Errorf("error making HTTP request: %w", err)
+		return PlankaAttachment{}, fmt.Errorf("failed to upload attachment: %w", err)
 	}
-	defer response.Body.Close()
+	return parsePlankaAttachment(body)
+}
 
-	if response.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("bad status code: %d", response.StatusCode)
+func parsePlankaAttachment(body []byte) (PlankaAttachment, error) {
+	var response struct {
+		Item struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+			Data struct {
+				URL         string `json:"url"`
+				Size        any    `json:"size"`
+				SizeInBytes any    `json:"sizeInBytes"`
+				MimeType    string `json:"mimeType"`
+			} `json:"data"`
+		} `json:"item"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return PlankaAttachment{}, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	attachment := PlankaAttachment{
+		ID:       response.Item.ID,
+		Name:     response.Item.Name,
+		URL:      response.Item.Data.URL,
+		Size:     plankaSize(response.Item.Data.SizeInBytes),
+		MimeType: response.Item.Data.MimeType,
 	}
+	if attachment.Size == 0 {
+		attachment.Size = plankaSize(response.Item.Data.Size)
+	}
+	if attachment.URL == "" {
+		attachment.URL = plankaURL + "/attachments/" + attachment.ID + "/download/" + url.PathEscape(attachment.Name)
+	}
+	return attachment, nil
+}
 
-	_, err = io.Copy(outputFile, response.Body)
-	if err != nil {
-		return "", fmt.Errorf("error copying data to file: %w", err)
+// plankaSize reads a size PLANKA may report either as a number or a string.
+func plankaSize(value any) int64 {
+	switch v := value.(type) {
+	case float64:
+		return int64(v)
+	case string:
+		size, _ := strconv.ParseInt(v, 10, 64)
+		return size
 	}
-	body, err := plankaUploadFile(outputFileName, "/api/cards/"+cardId+"/attachments", attachment.Name)
-	if body == nil && err != nil {
-		return "", fmt.Errorf("failed to upload attachment")
+	return 0
+}
+
+// plankaDownload opens an attachment stored in PLANKA for reading.
+func plankaDownload(attachmentURL string) (*http.Response, error) {
+	if strings.HasPrefix(attachmentURL, "/") {
+		attachmentURL = plankaURL + attachmentURL
 	}
-	log.Printf("File downloaded successfully to %s\n", outputFileName)
-	defer outputFile.Close()
-	err = os.Remove(outputFileName)
+	req, err := http.NewRequest("GET", attachmentURL, nil)
 	if err != nil {
-		return "", fmt.Errorf("error deleting file: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	req.Header.Set("Authorization", "Bearer "+plankaToken)
 
-	return "", nil
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return resp, nil
 }
 
 func createPlankaTasklistForCard(cardId string, checklist KaitenChecklist) (string, error) {
@@ -849,14 +1195,10 @@ func createPlankaTasklistForCard(cardId string, checklist KaitenChecklist) (stri
 	return jsonResponse["item"].(map[string]interface{})["id"].(string), nil
 }
 
-func createPlankaTaskInTasklist(listId string, item KaitenChecklistItem) (string, error) {
-	var task PlankaTask
-	task.Name = item.Text
-	task.Position = 0
-	task.IsCompleted = item.Checked
+func createPlankaTask(listId string, task PlankaTask) (string, error) {
 	jsonPayload, err := json.Marshal(task)
 	if err != nil {
-		return "", fmt.Errorf("error marshalling task list to json: %w", err)
+		return "", fmt.Errorf("error marshalling task to json: %w", err)
 	}
 	body, err := plankaAPICall(jsonPayload, "/api/task-lists/"+listId+"/tasks", "POST")
 	if err != nil {
@@ -869,10 +1211,107 @@ func createPlankaTaskInTasklist(listId string, item KaitenChecklistItem) (string
 	return jsonResponse["item"].(map[string]interface{})["id"].(string), nil
 }
 
-func createPlankaLabelForBoard(boardId string, tag KaitenTag) (PlankaLabel, error) {
-	var labelToCreate PlankaLabel
-	labelToCreate.Name = tag.Name
-	labelToCreate.Color = PlankaColors[int(tag.Color)]
+func getPlankaLabelsForBoard(boardId string) ([]PlankaLabel, error) {
+	body, err := plankaAPICall(nil, "/api/boards/"+boardId, "GET")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch board: %w", err)
+	}
+
+	var response struct {
+		Included struct {
+			Labels []PlankaLabel `json:"labels"`
+		} `json:"included"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON response: %w", err)
+	}
+	return response.Included.Labels, nil
+}
+
+func getPlankaBoardContents(boardId string) (PlankaBoardContents, error) {
+	body, err := plankaAPICall(nil, "/api/boards/"+boardId, "GET")
+	if err != nil {
+		return PlankaBoardContents{}, fmt.Errorf("failed to fetch board: %w", err)
+	}
+
+	var response struct {
+		Item     PlankaBoardInfo     `json:"item"`
+		Included PlankaBoardContents `json:"included"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return PlankaBoardContents{}, fmt.Errorf("failed to parse JSON response: %w", err)
+	}
+	response.Included.Board = response.Item
+	return response.Included, nil
+}
+
+func getPlankaProjectInfo(projectId string) (PlankaProjectInfo, error) {
+	body, err := plankaAPICall(nil, "/api/projects/"+projectId, "GET")
+	if err != nil {
+		return PlankaProjectInfo{}, fmt.Errorf("failed to fetch project: %w", err)
+	}
+
+	var response struct {
+		Item     PlankaProjectInfo `json:"item"`
+		Included struct {
+			Boards          []PlankaBoardInfo `json:"boards"`
+			ProjectManagers []struct {
+				UserID string `json:"userId"`
+			} `json:"projectManagers"`
+		} `json:"included"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return PlankaProjectInfo{}, fmt.Errorf("failed to parse JSON response: %w", err)
+	}
+	response.Item.Boards = response.Included.Boards
+	for _, manager := range response.Included.ProjectManagers {
+		response.Item.Managers = append(response.Item.Managers, manager.UserID)
+	}
+	return response.Item, nil
+}
+
+// deletePlankaObject deletes a user, project, board, list, card, label,
+// comment or custom field group, e.g. "/api/cards/"+cardId.
+func deletePlankaObject(endpoint string) error {
+	if _, err := plankaAPICall(nil, endpoint, "DELETE"); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", endpoint, err)
+	}
+	return nil
+}
+
+// isPlankaNotFound reports whether a PLANKA API call failed because the
+// object does not exist.
+func isPlankaNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "status 404")
+}
+
+// getPlankaCommentsForCard returns all comments of the card, newest first,
+// following PLANKA's pagination.
+func getPlankaCommentsForCard(cardId string) ([]PlankaCommentInfo, error) {
+	var comments []PlankaCommentInfo
+	var beforeId string
+	endpoint := "/api/cards/" + cardId + "/comments"
+	for {
+		body, err := plankaAPICall(nil, endpoint, "GET")
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch comments: %w", err)
+		}
+		var response struct {
+			Items []PlankaCommentInfo `json:"items"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON response: %w", err)
+		}
+		if len(response.Items) == 0 || response.Items[len(response.Items)-1].ID == beforeId {
+			return comments, nil
+		}
+		comments = append(comments, response.Items...)
+		beforeId = response.Items[len(response.Items)-1].ID
+		endpoint = "/api/cards/" + cardId + "/comments?beforeId=" + url.QueryEscape(beforeId)
+	}
+}
+
+func createPlankaLabel(boardId string, labelToCreate PlankaLabel) (PlankaLabel, error) {
 	labelToCreate.Position = 0
 	jsonPayload, err := json.Marshal(labelToCreate)
 	if err != nil {
@@ -904,3 +1343,47 @@ func createPlankaLabelForCard(cardId string, labelId string) error {
 	}
 	return nil
 }
+
+func createPlankaCustomFieldGroupForBoard(boardId string, name string) (string, error) {
+	jsonPayload, err := json.Marshal(PlankaCustomFieldGroup{Position: 65536, Name: name})
+	if err != nil {
+		return "", fmt.Errorf("error marshalling custom field group to json: %w", err)
+	}
+	body, err := plankaAPICall(jsonPayload, "/api/boards/"+boardId+"/custom-field-groups", "POST")
+	if err != nil {
+		return "", fmt.Errorf("error sending request to create custom field group: %w", err)
+	}
+	var jsonResponse map[string]interface{}
+	if err := json.Unmarshal(body, &jsonResponse); err != nil {
+		return "", fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return jsonResponse["item"].(map[string]interface{})["id"].(string), nil
+}
+
+func createPlankaCustomField(groupId string, field PlankaCustomField) (string, error) {
+	jsonPayload, err := json.Marshal(field)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling custom field to json: %w", err)
+	}
+	body, err := plankaAPICall(jsonPayload, "/api/custom-field-groups/"+groupId+"/custom-fields", "POST")
+	if err != nil {
+		return "", fmt.Errorf("error sending request to create custom field: %w", err)
+	}
+	var jsonResponse map[string]interface{}
+	if err := json.Unmarshal(body, &jsonResponse); err != nil {
+		return "", fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return jsonResponse["item"].(map[string]interface{})["id"].(string), nil
+}
+
+func setPlankaCustomFieldValue(cardId string, groupId string, fieldId string, content string) error {
+	jsonPayload, err := json.Marshal(map[string]string{"content": content})
+	if err != nil {
+		return fmt.Errorf("error marshalling custom field value to json: %w", err)
+	}
+	_, err = plankaAPICall(jsonPayload, "/api/cards/"+cardId+"/custom-field-values/customFieldGroupId:"+groupId+":customFieldId:"+fieldId, "PATCH")
+	if err != nil {
+		return fmt.Errorf("error sending request to set custom field value: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// useTestServers points the Kaiten and PLANKA clients at one test server.
+func useTestServers(t *testing.T, handler http.Handler) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	envInitOnce.Do(func() {})
+	plankaOnce.Do(func() {})
+	previousKaitenURL, previousKaitenToken := kaitenURL, kaitenToken
+	previousPlankaURL, previousPlankaToken := plankaURL, plankaToken
+	kaitenURL, kaitenToken = server.URL, "kaiten-token"
+	plankaURL, plankaToken = server.URL, "planka-token"
+	t.Cleanup(func() {
+		kaitenURL, kaitenToken = previousKaitenURL, previousKaitenToken
+		plankaURL, plankaToken = previousPlankaURL, previousPlankaToken
+	})
+}
+
+func TestAttachmentStreamsFromKaitenToPlanka(t *testing.T) {
+	content := strings.Repeat("attachment data ", 64*1024)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files/notes.txt", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer kaiten-token" {
+			t.Errorf("download authorization = %q", got)
+		}
+		io.WriteString(w, content)
+	})
+	mux.HandleFunc("POST /api/cards/7/attachments", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer planka-token" {
+			t.Errorf("upload authorization = %q", got)
+		}
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			t.Errorf("bad content type: %v", err)
+			return
+		}
+		form := multipart.NewReader(r.Body, params["boundary"])
+		fields := make(map[string]string)
+		for {
+			part, err := form.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Errorf("bad form: %v", err)
+				return
+			}
+			data, err := io.ReadAll(part)
+			if err != nil {
+				t.Errorf("reading upload: %v", err)
+				return
+			}
+			fields[part.FormName()] = string(data)
+		}
+		if fields["name"] != "notes.txt" {
+			t.Errorf("uploaded name = %q", fields["name"])
+		}
+		if fields["file"] != content {
+			t.Errorf("uploaded %d bytes, want %d", len(fields["file"]), len(content))
+		}
+		json.NewEncoder(w).Encode(map[string]any{"item": map[string]any{"id": "a1", "name": "notes.txt"}})
+	})
+	mux.HandleFunc("GET /attachments/a1/download/notes.txt", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, content)
+	})
+	useTestServers(t, mux)
+	files, err := newAttachmentCache(&kaitenSource{}, &plankaSink{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer files.Close()
+
+	file, err := files.fetch("/files/notes.txt")
+	if err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	attachment, err := files.upload("7", file, "notes.txt", file.mimeType, "", true)
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	if attachment.ID != "a1" {
+		t.Errorf("attachment ID = %q, want a1", attachment.ID)
+	}
+}
@@ -0,0 +1,559 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// plankaBackupFormat is the version of the archive layout written by
+// planka-export:
+//
+//	manifest.json       plankaBackupManifest
+//	users.json          users
+//	projects.json       plankaBackupProject in PLANKA's order
+//	boards/<id>.json    plankaBackupBoard
+//	files.json          snapshotFile by attachment URL
+//	files/<sha256>      attachment contents
+const plankaBackupFormat = 1
+
+const defaultPlankaBackupDir = "planka-backup"
+
+type plankaBackupManifest struct {
+	Format     int    `json:"format"`
+	SourceURL  string `json:"source_url"`
+	ExportedAt string `json:"exported_at"`
+	Errors     int    `json:"errors"`
+}
+
+type plankaBackupProject struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Managers    []string `json:"managers"`
+	// Boards are the board IDs by position.
+	Boards []string `json:"boards"`
+}
+
+// plankaBackupBoard is a board as PLANKA returns it, with the comments of
+// its cards, oldest first.
+type plankaBackupBoard struct {
+	Board PlankaBoardInfo `json:"board"`
+	PlankaBoardContents
+	Comments map[string][]PlankaCommentInfo `json:"comments"`
+}
+
+// exportPlankaBackup walks all projects of the PLANKA instance through its
+// API and writes them to dir. Like export, it logs and counts what fails to
+// load instead of stopping.
+func exportPlankaBackup(dir string) error {
+	source, err := newPlankaSource()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "boards"), 0o755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "files"), 0o755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	w := &snapshotWriter{dir: dir, source: source, index: make(map[string]snapshotFile)}
+
+	users, err := getPlankaUsers()
+	if err != nil {
+		return fmt.Errorf("error getting users: %w", err)
+	}
+	if err := w.write("users.json", users); err != nil {
+		return err
+	}
+
+	projectsByName, err := getPlankaProjects()
+	if err != nil {
+		return fmt.Errorf("error getting projects: %w", err)
+	}
+	var projects []plankaBackupProject
+	for _, item := range projectsByName {
+		info, err := getPlankaProjectInfo(item.ID)
+		if err != nil {
+			w.fail("Error getting project %s: %v", item.Name, err)
+			continue
+		}
+		log.Printf("Exporting project %s", item.Name)
+		project := plankaBackupProject{ID: item.ID, Name: item.Name, Description: item.Description, Managers: info.Managers}
+		sort.SliceStable(info.Boards, func(i, j int) bool { return info.Boards[i].Position < info.Boards[j].Position })
+		for _, board := range info.Boards {
+			if err := exportPlankaBoard(w, board.ID); err != nil {
+				return err
+			}
+			project.Boards = append(project.Boards, board.ID)
+		}
+		projects = append(projects, project)
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Name < projects[j].Name })
+	if err := w.write("projects.json", projects); err != nil {
+		return err
+	}
+	if err := w.write("files.json", w.index); err != nil {
+		return err
+	}
+
+	manifest := plankaBackupManifest{
+		Format:     plankaBackupFormat,
+		SourceURL:  plankaURL,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		Errors:     w.errors,
+	}
+	if err := w.write("manifest.json", manifest); err != nil {
+		return err
+	}
+	if w.errors > 0 {
+		return fmt.Errorf("backup written to %s with %d errors, see the log", dir, w.errors)
+	}
+	log.Printf("Backup of %d projects written to %s: %d files", len(projects), dir, len(w.index))
+	return nil
+}
+
+func exportPlankaBoard(w *snapshotWriter, boardId string) error {
+	contents, err := getPlankaBoardContents(boardId)
+	if err != nil {
+		w.fail("Error getting board %s: %v", boardId, err)
+		return nil
+	}
+	board := plankaBackupBoard{Board: contents.Board, PlankaBoardContents: contents, Comments: make(map[string][]PlankaCommentInfo)}
+	for _, card := range contents.Cards {
+		comments, err := getPlankaCommentsForCard(card.ID)
+		if err != nil {
+			w.fail("Error getting comments of card %s: %v", card.Name, err)
+			continue
+		}
+		for i, j := 0, len(comments)-1; i < j; i, j = i+1, j-1 {
+			comments[i], comments[j] = comments[j], comments[i]
+		}
+		board.Comments[card.ID] = comments
+	}
+	for _, attachment := range contents.Attachments {
+		if attachment.Type != "link" {
+			w.saveFile(attachment.Data.URL)
+		}
+	}
+	return w.write(filepath.Join("boards", boardId+".json"), board)
+}
+
+// plankaBackupImport recreates a backup in the PLANKA instance through the
+// sink, so that the import is journaled like a migration run.
+type plankaBackupImport struct {
+	dir      string
+	sink     Sink
+	manifest plankaBackupManifest
+	files    map[string]snapshotFile
+	users    map[string]string
+	emails   map[string]string
+	cards    map[string]string
+	// texts are the descriptions and comments that link to cards of the
+	// backup, rewritten once all cards exist.
+	texts  []plankaBackupText
+	errors int
+}
+
+type plankaBackupText struct {
+	cardId      string
+	commentId   string
+	authorEmail string
+	text        string
+}
+
+func importPlankaBackup(dir string, sink Sink) error {
+	imp := &plankaBackupImport{
+		dir:    dir,
+		sink:   sink,
+		users:  make(map[string]string),
+		emails: make(map[string]string),
+		cards:  make(map[string]string),
+	}
+	if err := imp.read("manifest.json", &imp.manifest); err != nil {
+		return err
+	}
+	if imp.manifest.Format != plankaBackupFormat {
+		return fmt.Errorf("unsupported backup format %d in %s", imp.manifest.Format, dir)
+	}
+	if imp.manifest.Errors > 0 {
+		log.Printf("Backup %s was exported with %d errors, some data may be missing", dir, imp.manifest.Errors)
+	}
+	var users []PlankaUserInfo
+	var projects []plankaBackupProject
+	for name, value := range map[string]any{
+		"users.json":    &users,
+		"projects.json": &projects,
+		"files.json":    &imp.files,
+	} {
+		if err := imp.read(name, value); err != nil {
+			return err
+		}
+	}
+
+	if err := imp.importUsers(users); err != nil {
+		return err
+	}
+	for _, project := range projects {
+		imp.importProject(project)
+	}
+	imp.linkCards()
+	// Users are deactivated last, since comments and uploads are made on
+	// their behalf.
+	for _, user := range users {
+		if user.IsDeactivated && imp.users[user.ID] != "" {
+			if err := imp.sink.DeactivateUser(imp.users[user.ID]); err != nil {
+				imp.fail("Error deactivating user %s: %v", user.Email, err)
+			}
+		}
+	}
+
+	if imp.errors > 0 {
+		return fmt.Errorf("backup imported with %d errors, see the log", imp.errors)
+	}
+	log.Printf("Backup %s of %s imported", dir, imp.manifest.SourceURL)
+	return nil
+}
+
+// importUsers matches users by e-mail and creates the missing ones.
+func (imp *plankaBackupImport) importUsers(users []PlankaUserInfo) error {
+	existing, err := imp.sink.Users()
+	if err != nil {
+		return fmt.Errorf("error getting PLANKA users: %w", err)
+	}
+	ids := make(map[string]string, len(existing))
+	for _, user := range existing {
+		ids[strings.ToLower(user.Email)] = user.ID
+	}
+
+	for _, user := range users {
+		imp.emails[user.ID] = user.Email
+		if id, ok := ids[strings.ToLower(user.Email)]; ok {
+			imp.users[user.ID] = id
+			continue
+		}
+		role := user.Role
+		if role == "" {
+			role = "boardUser"
+		}
+		id, err := imp.sink.CreateUser(PlankaUser{
+			Username: user.Username,
+			Name:     user.Name,
+			Email:    user.Email,
+			Password: "1234tempPass",
+			Role:     role,
+		})
+		if err != nil || id == "" {
+			imp.fail("Error creating user %s: %v", user.Email, err)
+			continue
+		}
+		log.Printf("Created Planka user: %s", user.Email)
+		imp.users[user.ID] = id
+	}
+	return nil
+}
+
+func (imp *plankaBackupImport) importProject(backup plankaBackupProject) {
+	project, err := imp.sink.CreateProject(KaitenSpace{Name: backup.Name})
+	if err != nil {
+		imp.fail("Error creating project %s: %v", backup.Name, err)
+		return
+	}
+	log.Printf("Planka project: %s with ID: %s", project.Name, project.ID)
+	for _, userId := range backup.Managers {
+		if imp.users[userId] == "" {
+			continue
+		}
+		if err := imp.sink.AddProjectManager(project.ID, imp.users[userId]); err != nil {
+			log.Printf("Error adding manager %s to project %s: %v", imp.emails[userId], backup.Name, err)
+		}
+	}
+
+	for _, boardId := range backup.Boards {
+		var board plankaBackupBoard
+		if err := imp.read(filepath.Join("boards", boardId+".json"), &board); err != nil {
+			imp.fail("%v", err)
+			continue
+		}
+		imp.importBoard(project, board)
+	}
+}
+
+func (imp *plankaBackupImport) importBoard(project PlankaProject, backup plankaBackupBoard) {
+	board, err := imp.sink.CreateBoard(project.ID, KaitenBoard{Title: backup.Board.Name}, "")
+	if err != nil {
+		imp.fail("Error creating board %s: %v", backup.Board.Name, err)
+		return
+	}
+	log.Printf("Board named %s created in project %s", backup.Board.Name, project.Name)
+	for _, membership := range backup.BoardMemberships {
+		if imp.users[membership.UserID] == "" {
+			continue
+		}
+		canComment := membership.CanComment != nil && *membership.CanComment
+		if err := imp.sink.AddBoardMember(board.ID, imp.users[membership.UserID], membership.Role, canComment); err != nil {
+			log.Printf("Error adding member %s to board %s: %v", imp.emails[membership.UserID], board.Name, err)
+		}
+	}
+
+	ids := plankaBackupIds{labels: make(map[string]string), groups: make(map[string]string), fields: make(map[string]string)}
+	sort.SliceStable(backup.Labels, func(i, j int) bool { return backup.Labels[i].Position < backup.Labels[j].Position })
+	for _, label := range backup.Labels {
+		created, err := imp.sink.CreateLabel(board.ID, PlankaLabel{Position: label.Position, Name: label.Name, Color: label.Color})
+		if err != nil {
+			imp.fail("Error creating label %s on board %s: %v", label.Name, board.Name, err)
+			continue
+		}
+		ids.labels[label.Id] = created.Id
+	}
+	imp.importCustomFields(board, backup, ids)
+
+	// The archive and trash lists of newer PLANKA versions come with every
+	// board and cannot be created, so their cards are skipped.
+	sort.SliceStable(backup.Lists, func(i, j int) bool { return backup.Lists[i].Position < backup.Lists[j].Position })
+	sort.SliceStable(backup.Cards, func(i, j int) bool { return backup.Cards[i].Position < backup.Cards[j].Position })
+	for _, list := range backup.Lists {
+		if list.Type != "" && list.Type != "active" && list.Type != "closed" {
+			continue
+		}
+		listType := list.Type
+		if listType == "" {
+			listType = "active"
+		}
+		created, err := imp.sink.CreateList(board.ID, KaitenColumn{Position: list.Position, Name: list.Name, Type: listType})
+		if err != nil {
+			imp.fail("Error creating list %s on board %s: %v", list.Name, board.Name, err)
+			continue
+		}
+		for _, card := range backup.Cards {
+			if card.ListID == list.ID {
+				imp.importCard(created.ID, backup, ids, card)
+			}
+		}
+	}
+}
+
+// plankaBackupIds maps the IDs of a board's labels and custom fields in the
+// backup to their imported copies.
+type plankaBackupIds struct {
+	labels map[string]string
+	groups map[string]string
+	fields map[string]string
+}
+
+// importCustomFields recreates the board's custom field groups and their
+// fields. The sink creates only board groups, so groups of single cards are
+// skipped.
+func (imp *plankaBackupImport) importCustomFields(board PlankaBoard, backup plankaBackupBoard, ids plankaBackupIds) {
+	sort.SliceStable(backup.CustomFieldGroups, func(i, j int) bool {
+		return backup.CustomFieldGroups[i].Position < backup.CustomFieldGroups[j].Position
+	})
+	sort.SliceStable(backup.CustomFields, func(i, j int) bool { return backup.CustomFields[i].Position < backup.CustomFields[j].Position })
+	for _, group := range backup.CustomFieldGroups {
+		if group.CardID != "" {
+			log.Printf("Custom field group %s of card %s is not imported", group.Name, group.CardID)
+			continue
+		}
+		groupId, err := imp.sink.CreateCustomFieldGroup(board.ID, group.Name)
+		if err != nil {
+			imp.fail("Error creating custom field group %s on board %s: %v", group.Name, board.Name, err)
+			continue
+		}
+		ids.groups[group.ID] = groupId
+		for _, field := range backup.CustomFields {
+			if field.CustomFieldGroupID != group.ID {
+				continue
+			}
+			fieldId, err := imp.sink.CreateCustomField(groupId, PlankaCustomField{Position: field.Position, Name: field.Name, ShowOnFrontOfCard: field.ShowOnFrontOfCard})
+			if err != nil {
+				imp.fail("Error creating custom field %s on board %s: %v", field.Name, board.Name, err)
+				continue
+			}
+			ids.fields[field.ID] = fieldId
+		}
+	}
+}
+
+var markdownLinkTargets = regexp.MustCompile(`\]\(([^)\s]+)\)`)
+
+func (imp *plankaBackupImport) importCard(listId string, backup plankaBackupBoard, ids plankaBackupIds, card PlankaCardInfo) {
+	cardType := card.Type
+	if cardType == "" {
+		cardType = "project"
+	}
+	cardId, err := imp.sink.CreateCard(listId, KaitenCard{Title: card.Name, Description: card.Description, SortOrder: card.Position, DueDate: card.DueDate}, cardType)
+	if err != nil {
+		imp.fail("Error creating card %s: %v", card.Name, err)
+		return
+	}
+	imp.cards[card.ID] = cardId
+
+	for _, cardLabel := range backup.CardLabels {
+		if cardLabel.CardID == card.ID && ids.labels[cardLabel.LabelID] != "" {
+			if err := imp.sink.AddCardLabel(cardId, ids.labels[cardLabel.LabelID]); err != nil {
+				log.Printf("Error adding label to card %s: %v", card.Name, err)
+			}
+		}
+	}
+	for _, member := range backup.CardMemberships {
+		if member.CardID == card.ID && imp.users[member.UserID] != "" {
+			if err := imp.sink.AddCardMember(cardId, imp.users[member.UserID]); err != nil {
+				log.Printf("Error adding member %s to card %s: %v", imp.emails[member.UserID], card.Name, err)
+			}
+		}
+	}
+	for _, value := range backup.CustomFieldValues {
+		groupId, fieldId := ids.groups[value.CustomFieldGroupID], ids.fields[value.CustomFieldID]
+		if value.CardID != card.ID || groupId == "" || fieldId == "" {
+			continue
+		}
+		if err := imp.sink.SetCustomFieldValue(cardId, groupId, fieldId, value.Content); err != nil {
+			imp.fail("Error setting custom field value of card %s: %v", card.Name, err)
+		}
+	}
+
+	var taskLists []PlankaTaskListInfo
+	for _, taskList := range backup.TaskLists {
+		if taskList.CardID == card.ID {
+			taskLists = append(taskLists, taskList)
+		}
+	}
+	sort.SliceStable(taskLists, func(i, j int) bool { return taskLists[i].Position < taskLists[j].Position })
+	for _, taskList := range taskLists {
+		taskListId, err := imp.sink.CreateTaskList(cardId, taskList.Name)
+		if err != nil {
+			imp.fail("Error creating task list %s of card %s: %v", taskList.Name, card.Name, err)
+			continue
+		}
+		var tasks []PlankaTaskInfo
+		for _, task := range backup.Tasks {
+			if task.TaskListID == taskList.ID {
+				tasks = append(tasks, task)
+			}
+		}
+		sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].Position < tasks[j].Position })
+		for _, task := range tasks {
+			if _, err := imp.sink.CreateTask(taskListId, PlankaTask{Position: task.Position, Name: task.Name, IsCompleted: task.IsCompleted}); err != nil {
+				imp.fail("Error creating task %s of card %s: %v", task.Name, card.Name, err)
+			}
+		}
+	}
+
+	// Attachments go first, so that images in the description and comments
+	// can be pointed at the new copies.
+	urls := make(map[string]string)
+	for _, attachment := range backup.Attachments {
+		if attachment.CardID != card.ID {
+			continue
+		}
+		if attachment.Type == "link" {
+			log.Printf("Link attachment %s of card %s is not imported", attachment.Data.URL, card.Name)
+			continue
+		}
+		created, err := imp.uploadAttachment(cardId, attachment)
+		if err != nil {
+			imp.fail("Error uploading attachment %s of card %s: %v", attachment.Name, card.Name, err)
+			continue
+		}
+		urls[attachment.Data.URL] = created.URL
+		if attachment.ID == card.CoverAttachmentID {
+			if err := imp.sink.UpdateCard(cardId, map[string]any{"coverAttachmentId": created.ID}); err != nil {
+				log.Printf("Error setting cover of card %s: %v", card.Name, err)
+			}
+		}
+	}
+	rewrite := func(text string) string {
+		return markdownLinkTargets.ReplaceAllStringFunc(text, func(match string) string {
+			if target, ok := urls[match[2:len(match)-1]]; ok {
+				return "](" + target + ")"
+			}
+			return match
+		})
+	}
+
+	if description := rewrite(card.Description); description != card.Description {
+		if err := imp.sink.UpdateCard(cardId, map[string]any{"description": description}); err != nil {
+			log.Printf("Error updating description of card %s: %v", card.Name, err)
+		}
+		card.Description = description
+	}
+	imp.keepText(plankaBackupText{cardId: cardId, text: card.Description})
+
+	for _, comment := range backup.Comments[card.ID] {
+		author := imp.emails[comment.UserID]
+		text := rewrite(comment.Text)
+		commentId, err := imp.sink.CreateComment(cardId, KaitenComment{AuthorEmail: author, CreatedAt: comment.CreatedAt, Text: text})
+		if err != nil {
+			imp.fail("Error creating comment on card %s: %v", card.Name, err)
+			continue
+		}
+		imp.keepText(plankaBackupText{cardId: cardId, commentId: commentId, authorEmail: author, text: text})
+	}
+}
+
+func (imp *plankaBackupImport) uploadAttachment(cardId string, attachment PlankaAttachmentInfo) (PlankaAttachment, error) {
+	stored, ok := imp.files[attachment.Data.URL]
+	if !ok {
+		return PlankaAttachment{}, fmt.Errorf("file is not in the backup")
+	}
+	file, err := os.Open(filepath.Join(imp.dir, filepath.FromSlash(stored.Path)))
+	if err != nil {
+		return PlankaAttachment{}, err
+	}
+	defer file.Close()
+	return imp.sink.UploadAttachment(cardId, file, attachment.Name, stored.MimeType, imp.emails[attachment.CreatorUserID])
+}
+
+// keepText remembers text that links to cards of the backup's instance.
+func (imp *plankaBackupImport) keepText(text plankaBackupText) {
+	if imp.manifest.SourceURL != "" && strings.Contains(text.text, imp.manifest.SourceURL+"/cards/") {
+		imp.texts = append(imp.texts, text)
+	}
+}
+
+// linkCards points links to cards of the backup at their imported copies.
+func (imp *plankaBackupImport) linkCards() {
+	cardLinks := regexp.MustCompile(regexp.QuoteMeta(imp.manifest.SourceURL) + `/cards/(\d+)`)
+	for _, text := range imp.texts {
+		linked := cardLinks.ReplaceAllStringFunc(text.text, func(match string) string {
+			if cardId, ok := imp.cards[cardLinks.FindStringSubmatch(match)[1]]; ok {
+				return imp.sink.CardURL(cardId)
+			}
+			return match
+		})
+		if linked == text.text {
+			continue
+		}
+		var err error
+		if text.commentId != "" {
+			err = imp.sink.UpdateComment(text.commentId, text.authorEmail, linked)
+		} else {
+			err = imp.sink.UpdateCard(text.cardId, map[string]any{"description": linked})
+		}
+		if err != nil {
+			log.Printf("Error updating card links of card %s: %v", text.cardId, err)
+		}
+	}
+}
+
+func (imp *plankaBackupImport) read(name string, value any) error {
+	data, err := os.ReadFile(filepath.Join(imp.dir, name))
+	if err != nil {
+		return fmt.Errorf("failed to read backup file: %w", err)
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("failed to parse backup file %s: %w", name, err)
+	}
+	return nil
+}
+
+func (imp *plankaBackupImport) fail(format string, args ...any) {
+	log.Printf(format, args...)
+	imp.errors++
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestPlankaBackupRoundTrip(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/users", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"items": [
+			{"id": "1", "email": "ann@example.com", "username": "ann", "name": "Ann", "role": "projectOwner"},
+			{"id": "2", "email": "bob@example.com", "username": "bob", "name": "Bob", "isDeactivated": true}]}`)
+	})
+	mux.HandleFunc("GET /api/projects", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"items": [{"id": "10", "name": "Team"}]}`)
+	})
+	mux.HandleFunc("GET /api/projects/10", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"item": {"id": "10", "name": "Team"}, "included": {
+			"boards": [{"id": "20", "name": "Alpha"}], "projectManagers": [{"userId": "1"}]}}`)
+	})
+	mux.HandleFunc("GET /api/boards/20", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"item": {"id": "20", "name": "Alpha"}, "included": {
+			"boardMemberships": [{"userId": "2", "role": "viewer", "canComment": true}],
+			"lists": [{"id": "30", "type": "active", "name": "Todo"}, {"id": "39", "type": "trash", "name": "Trash"}],
+			"cards": [
+				{"id": "41", "listId": "30", "name": "Second", "position": 2, "description": "See %[1]s/cards/40"},
+				{"id": "40", "listId": "30", "name": "First", "position": 1, "coverAttachmentId": "60",
+				 "description": "![shot](%[1]s/attachments/60/download/shot.png)"}],
+			"labels": [{"id": "50", "name": "bug", "color": "berry-red"}],
+			"cardLabels": [{"cardId": "40", "labelId": "50"}],
+			"taskLists": [{"id": "70", "cardId": "40", "name": "Steps"}],
+			"tasks": [{"id": "71", "taskListId": "70", "name": "plan", "isCompleted": true}],
+			"attachments": [{"id": "60", "cardId": "40", "creatorUserId": "2", "type": "file", "name": "shot.png",
+				"data": {"url": "%[1]s/attachments/60/download/shot.png", "sizeInBytes": 3, "mimeType": "image/png"}}],
+			"customFieldGroups": [
+				{"id": "80", "boardId": "20", "name": "Kaiten", "position": 1},
+				{"id": "81", "cardId": "40", "name": "Card only", "position": 2}],
+			"customFields": [
+				{"id": "91", "customFieldGroupId": "80", "name": "Spent", "position": 2},
+				{"id": "90", "customFieldGroupId": "80", "name": "Size", "position": 1, "showOnFrontOfCard": true},
+				{"id": "92", "customFieldGroupId": "81", "name": "Note", "position": 1}],
+			"customFieldValues": [
+				{"cardId": "40", "customFieldGroupId": "80", "customFieldId": "90", "content": "5"},
+				{"cardId": "41", "customFieldGroupId": "80", "customFieldId": "91", "content": "1h 30m"},
+				{"cardId": "40", "customFieldGroupId": "81", "customFieldId": "92", "content": "only here"}]}}`, plankaURL)
+	})
+	mux.HandleFunc("GET /api/cards/40/comments", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("beforeId") != "" {
+			io.WriteString(w, `{"items": []}`)
+			return
+		}
+		io.WriteString(w, `{"items": [
+			{"id": "101", "userId": "1", "text": "newer"},
+			{"id": "100", "userId": "2", "text": "older"}]}`)
+	})
+	mux.HandleFunc("GET /api/cards/41/comments", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"items": []}`)
+	})
+	mux.HandleFunc("GET /attachments/60/download/shot.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		io.WriteString(w, "png")
+	})
+	useTestServers(t, mux)
+
+	dir := t.TempDir()
+	if err := exportPlankaBackup(dir); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	sink := newRecordingSink(PlankaUserInfo{ID: "user:ann", Email: "ann@example.com"})
+	if err := importPlankaBackup(dir, sink); err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+
+	want := []string{
+		"CreateUser bob@example.com",
+		"CreateProject Team",
+		"AddProjectManager project:Team user:ann",
+		"CreateBoard project:Team Alpha",
+		"AddBoardMember board:Alpha user:bob@example.com viewer",
+		"CreateLabel board:Alpha bug berry-red",
+		"CreateCustomFieldGroup board:Alpha Kaiten",
+		"CreateCustomField group:Kaiten Size",
+		"CreateCustomField group:Kaiten Spent",
+		"CreateList board:Alpha Todo",
+		"CreateCard list:Todo First",
+		"AddCardLabel card:First label:bug",
+		"SetCustomFieldValue card:First field:Size 5",
+		"CreateTaskList card:First Steps",
+		"UploadAttachment card:First shot.png image/png png",
+		"SetCover card:First attachment:shot.png",
+		"CreateCard list:Todo Second",
+		"SetCustomFieldValue card:Second field:Spent 1h 30m",
+		"DeactivateUser user:bob@example.com",
+	}
+	if !slices.Equal(sink.calls, want) {
+		t.Errorf("calls:\n%v\nwant:\n%v", sink.calls, want)
+	}
+
+	if got := sink.descriptions["card:First"]; got != "![shot](https://planka.example/attachments/shot.png)" {
+		t.Errorf("description of First = %q, want the image pointed at the imported copy", got)
+	}
+	if got := sink.descriptions["card:Second"]; got != "See https://planka.example/cards/card:First" {
+		t.Errorf("description of Second = %q, want the card link pointed at the imported card", got)
+	}
+	comments := sink.comments["card:First"]
+	if len(comments) != 2 || comments[0].Text != "older" || comments[0].AuthorEmail != "bob@example.com" || comments[1].Text != "newer" {
+		t.Errorf("comments = %+v, want oldest first with their authors", comments)
+	}
+	if tasks := sink.tasks["card:First/Steps"]; len(tasks) != 1 || tasks[0].Name != "plan" || !tasks[0].IsCompleted {
+		t.Errorf("tasks = %+v, want the completed task plan", tasks)
+	}
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// plankaSource reads a PLANKA instance as a Source, for migrating back to
+// Kaiten. PLANKA IDs do not fit a float64, so every object gets a
+// syntheticID of its PLANKA ID; projects keep theirs as the space UID.
+type plankaSource struct {
+	mu       sync.Mutex
+	ids      map[float64]string
+	emails   map[string]string
+	boards   map[string]PlankaBoardContents
+	projects map[string]PlankaProjectInfo
+	// cardBoards holds the PLANKA board of every card read so far.
+	cardBoards map[string]string
+}
+
+func newPlankaSource() (*plankaSource, error) {
+	if err := initPlankaEnv(); err != nil {
+		return nil, fmt.Errorf("cannot get variable values for PLANKA API: %w", err)
+	}
+	return &plankaSource{
+		ids:        make(map[float64]string),
+		boards:     make(map[string]PlankaBoardContents),
+		projects:   make(map[string]PlankaProjectInfo),
+		cardBoards: make(map[string]string),
+	}, nil
+}
+
+// id returns the synthetic ID of a PLANKA object and remembers the way back.
+func (s *plankaSource) id(plankaId string) float64 {
+	id := syntheticID(plankaId)
+	s.mu.Lock()
+	s.ids[id] = plankaId
+	s.mu.Unlock()
+	return id
+}
+
+func (s *plankaSource) plankaID(id float64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	plankaId, ok := s.ids[id]
+	if !ok {
+		return "", fmt.Errorf("unknown object %s", formatKaitenID(id))
+	}
+	return plankaId, nil
+}
+
+func (s *plankaSource) project(projectId string) (PlankaProjectInfo, error) {
+	s.mu.Lock()
+	project, cached := s.projects[projectId]
+	s.mu.Unlock()
+	if cached {
+		return project, nil
+	}
+	project, err := getPlankaProjectInfo(projectId)
+	if err != nil {
+		return PlankaProjectInfo{}, err
+	}
+	s.mu.Lock()
+	s.projects[projectId] = project
+	s.mu.Unlock()
+	return project, nil
+}
+
+func (s *plankaSource) board(boardId string) (PlankaBoardContents, error) {
+	s.mu.Lock()
+	contents, cached := s.boards[boardId]
+	s.mu.Unlock()
+	if cached {
+		return contents, nil
+	}
+	contents, err := getPlankaBoardContents(boardId)
+	if err != nil {
+		return PlankaBoardContents{}, err
+	}
+	s.mu.Lock()
+	s.boards[boardId] = contents
+	for _, card := range contents.Cards {
+		s.cardBoards[card.ID] = boardId
+	}
+	s.mu.Unlock()
+	return contents, nil
+}
+
+// card returns the PLANKA card ID and the contents of its board.
+func (s *plankaSource) card(cardId float64) (string, PlankaBoardContents, error) {
+	plankaId, err := s.plankaID(cardId)
+	if err != nil {
+		return "", PlankaBoardContents{}, err
+	}
+	s.mu.Lock()
+	boardId, ok := s.cardBoards[plankaId]
+	s.mu.Unlock()
+	if !ok {
+		return "", PlankaBoardContents{}, fmt.Errorf("card %s was not read from a board", plankaId)
+	}
+	contents, err := s.board(boardId)
+	return plankaId, contents, err
+}
+
+func (s *plankaSource) email(userId string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.emails[userId]
+}
+
+func (s *plankaSource) URL() string {
+	return plankaURL
+}
+
+func (s *plankaSource) Users() ([]KaitenUser, error) {
+	plankaUsers, err := getPlankaUsers()
+	if err != nil {
+		return nil, err
+	}
+	emails := make(map[string]string, len(plankaUsers))
+	var users []KaitenUser
+	for _, plankaUser := range plankaUsers {
+		emails[plankaUser.ID] = plankaUser.Email
+		users = append(users, KaitenUser{
+			ID:       s.id(plankaUser.ID),
+			Email:    plankaUser.Email,
+			FullName: plankaUser.Name,
+			Username: plankaUser.Username,
+		})
+	}
+	s.mu.Lock()
+	s.emails = emails
+	s.mu.Unlock()
+	return users, nil
+}
+
+// Tags are the labels of all boards. PLANKA labels belong to a board, so
+// labels of the same name on different boards are separate tags.
+func (s *plankaSource) Tags() (map[float64]KaitenTag, error) {
+	projects, err := getPlankaProjects()
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[float64]KaitenTag)
+	for _, plankaProject := range projects {
+		project, err := s.project(plankaProject.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, boardInfo := range project.Boards {
+			contents, err := s.board(boardInfo.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, label := range contents.Labels {
+				tag := KaitenTag{Id: s.id(label.Id), Name: label.Name}
+				for _, color := range plankaPalette {
+					if color.name == label.Color {
+						tag.ColorHex = color.hex
+					}
+				}
+				tags[tag.Id] = tag
+			}
+		}
+	}
+	return tags, nil
+}
+
+func (s *plankaSource) CustomProperties() (map[string]KaitenCustomProperty, error) {
+	return map[string]KaitenCustomProperty{}, nil
+}
+
+// Spaces are the projects, keyed by project ID.
+func (s *plankaSource) Spaces() (map[string]KaitenSpace, error) {
+	projects, err := getPlankaProjects()
+	if err != nil {
+		return nil, err
+	}
+	spaces := make(map[string]KaitenSpace, len(projects))
+	for _, project := range projects {
+		spaces[project.ID] = KaitenSpace{ID: s.id(project.ID), Name: project.Name, UID: project.ID}
+	}
+	return spaces, nil
+}
+
+func (s *plankaSource) Boards(space KaitenSpace) ([]KaitenBoard, error) {
+	project, err := s.project(space.UID)
+	if err != nil {
+		return nil, err
+	}
+	boardInfos := append([]PlankaBoardInfo(nil), project.Boards...)
+	sort.SliceStable(boardInfos, func(i, j int) bool { return boardInfos[i].Position < boardInfos[j].Position })
+
+	var boards []KaitenBoard
+	for _, board := range boardInfos {
+		boards = append(boards, KaitenBoard{ID: s.id(board.ID), Title: board.Name})
+	}
+	return boards, nil
+}
+
+// Columns are the active and closed lists. Archive and trash hold cards
+// nobody works with any more.
+func (s *plankaSource) Columns(board KaitenBoard) ([]KaitenColumn, error) {
+	boardId, err := s.plankaID(board.ID)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := s.board(boardId)
+	if err != nil {
+		return nil, err
+	}
+	var columns []KaitenColumn
+	for _, list := range contents.Lists {
+		if list.Type != "active" && list.Type != "closed" {
+			continue
+		}
+		columns = append(columns, KaitenColumn{
+			Position: list.Position,
+			Name:     list.Name,
+			Type:     list.Type,
+			Id:       s.id(list.ID),
+			BoardID:  board.ID,
+		})
+	}
+	sort.SliceStable(columns, func(i, j int) bool { return columns[i].Position < columns[j].Position })
+	return columns, nil
+}
+
+func (s *plankaSource) Cards(column KaitenColumn) ([]KaitenCard, error) {
+	boardId, err := s.plankaID(column.BoardID)
+	if err != nil {
+		return nil, err
+	}
+	listId, err := s.plankaID(column.Id)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := s.board(boardId)
+	if err != nil {
+		return nil, err
+	}
+
+	var cards []KaitenCard
+	for _, plankaCard := range contents.Cards {
+		if plankaCard.ListID != listId {
+			continue
+		}
+		card := KaitenCard{
+			ID:          s.id(plankaCard.ID),
+			BoardID:     column.BoardID,
+			Title:       plankaCard.Name,
+			Description: plankaCard.Description,
+			SortOrder:   plankaCard.Position,
+			DueDate:     plankaCard.DueDate,
+		}
+		for _, cardLabel := range contents.CardLabels {
+			if cardLabel.CardID == plankaCard.ID {
+				card.TagIds = append(card.TagIds, s.id(cardLabel.LabelID))
+			}
+		}
+		for _, membership := range contents.CardMemberships {
+			if membership.CardID == plankaCard.ID {
+				card.Members = append(card.Members, KaitenCardMember{Email: s.email(membership.UserID), Type: kaitenMemberTypeMember})
+			}
+		}
+		for _, taskList := range contents.TaskLists {
+			if taskList.CardID == plankaCard.ID {
+				card.Checklists = append(card.Checklists, s.id(taskList.ID))
+			}
+		}
+		cards = append(cards, card)
+	}
+	sort.SliceStable(cards, func(i, j int) bool { return cards[i].SortOrder < cards[j].SortOrder })
+	return cards, nil
+}
+
+// Comments are returned oldest first, the order Kaiten lists them in.
+func (s *plankaSource) Comments(cardId float64) ([]KaitenComment, error) {
+	plankaId, err := s.plankaID(cardId)
+	if err != nil {
+		return nil, err
+	}
+	plankaComments, err := getPlankaCommentsForCard(plankaId)
+	if err != nil {
+		return nil, err
+	}
+	var comments []KaitenComment
+	for i := len(plankaComments) - 1; i >= 0; i-- {
+		comment := plankaComments[i]
+		comments = append(comments, KaitenComment{
+			ID:          s.id(comment.ID),
+			AuthorEmail: s.email(comment.UserID),
+			CreatedAt:   comment.CreatedAt,
+			Text:        comment.Text,
+		})
+	}
+	return comments, nil
+}
+
+// Attachments are the card's files. Link attachments have nothing to
+// download and are skipped.
+func (s *plankaSource) Attachments(cardId float64) ([]KaitenAttachment, error) {
+	plankaId, contents, err := s.card(cardId)
+	if err != nil {
+		return nil, err
+	}
+	var coverId string
+	for _, card := range contents.Cards {
+		if card.ID == plankaId {
+			coverId = card.CoverAttachmentID
+		}
+	}
+
+	var attachments []KaitenAttachment
+	for _, plankaAttachment := range contents.Attachments {
+		if plankaAttachment.CardID != plankaId || plankaAttachment.Type == "link" {
+			continue
+		}
+		attachmentURL := plankaAttachment.Data.URL
+		if attachmentURL == "" {
+			attachmentURL = plankaURL + "/attachments/" + plankaAttachment.ID + "/download/" + plankaAttachment.Name
+		}
+		attachments = append(attachments, KaitenAttachment{
+			ID:       s.id(plankaAttachment.ID),
+			Name:     plankaAttachment.Name,
+			URL:      attachmentURL,
+			Size:     float64(plankaAttachment.Size()),
+			MimeType: plankaAttachment.Data.MimeType,
+			Cover:    plankaAttachment.ID == coverId,
+		})
+	}
+	return attachments, nil
+}
+
+func (s *plankaSource) Checklist(cardId float64, checklistId float64) (KaitenChecklist, error) {
+	_, contents, err := s.card(cardId)
+	if err != nil {
+		return KaitenChecklist{}, err
+	}
+	taskListId, err := s.plankaID(checklistId)
+	if err != nil {
+		return KaitenChecklist{}, err
+	}
+	for _, taskList := range contents.TaskLists {
+		if taskList.ID != taskListId {
+			continue
+		}
+		var tasks []PlankaTaskInfo
+		for _, task := range contents.Tasks {
+			if task.TaskListID == taskListId {
+				tasks = append(tasks, task)
+			}
+		}
+		sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].Position < tasks[j].Position })
+
+		checklist := KaitenChecklist{Name: taskList.Name}
+		for _, task := range tasks {
+			checklist.Items = append(checklist.Items, KaitenChecklistItem{Text: task.Name, Checked: task.IsCompleted})
+		}
+		return checklist, nil
+	}
+	return KaitenChecklist{}, fmt.Errorf("task list %s not found", taskListId)
+}
+
+// Subscribers are not read: PLANKA only tells users about their own
+// subscriptions.
+func (s *plankaSource) Subscribers(cardId float64) ([]string, error) {
+	return nil, nil
+}
+
+func (s *plankaSource) TimeLogs(cardId float64) ([]KaitenTimeLog, error) {
+	return nil, nil
+}
+
+// SpaceAccess makes the project managers space owners.
+func (s *plankaSource) SpaceAccess(space KaitenSpace) ([]KaitenAccess, error) {
+	project, err := s.project(space.UID)
+	if err != nil {
+		return nil, err
+	}
+	var access []KaitenAccess
+	for _, userId := range project.Managers {
+		access = append(access, KaitenAccess{UserID: s.id(userId), Email: s.email(userId), Role: kaitenAccessOwner})
+	}
+	return access, nil
+}
+
+// BoardAccess turns board memberships into access roles: editors become
+// writers, viewers commenters or readers depending on their right to comment.
+func (s *plankaSource) BoardAccess(board KaitenBoard) ([]KaitenAccess, error) {
+	boardId, err := s.plankaID(board.ID)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := s.board(boardId)
+	if err != nil {
+		return nil, err
+	}
+	var access []KaitenAccess
+	for _, membership := range contents.BoardMemberships {
+		role := kaitenAccessReader
+		if membership.Role == "editor" {
+			role = kaitenAccessWriter
+		} else if membership.CanComment != nil && *membership.CanComment {
+			role = kaitenAccessCommenter
+		}
+		access = append(access, KaitenAccess{UserID: s.id(membership.UserID), Email: s.email(membership.UserID), Role: role})
+	}
+	return access, nil
+}
+
+func (s *plankaSource) GroupUsers(groupUID string) ([]float64, error) {
+	return nil, fmt.Errorf("PLANKA has no user groups")
+}
+
+func (s *plankaSource) IsFileURL(fileURL string) bool {
+	return strings.HasPrefix(fileURL, plankaURL+"/attachments/")
+}
+
+func (s *plankaSource) OpenFile(fileURL string) (SourceFile, error) {
+	resp, err := plankaDownload(fileURL)
+	if err != nil {
+		return SourceFile{}, err
+	}
+	return SourceFile{Body: resp.Body, Size: resp.ContentLength, ContentType: resp.Header.Get("Content-Type")}, nil
+}
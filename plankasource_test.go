@@ -0,0 +1,213 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func usePlankaSourceServer(t *testing.T) {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/users", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"items": [
+			{"id": "u1", "email": "ann@example.com", "username": "ann", "name": "Ann"},
+			{"id": "u2", "email": "bob@example.com", "username": "bob", "name": "Bob"}]}`)
+	})
+	mux.HandleFunc("GET /api/projects", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"items": [{"id": "p1", "name": "Team"}]}`)
+	})
+	mux.HandleFunc("GET /api/projects/p1", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"item": {"id": "p1", "name": "Team"}, "included": {
+			"boards": [{"id": "b2", "name": "Beta", "position": 2}, {"id": "b1", "name": "Alpha", "position": 1}],
+			"projectManagers": [{"userId": "u1"}]}}`)
+	})
+	mux.HandleFunc("GET /api/boards/b1", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"item": {"id": "b1", "name": "Alpha"}, "included": {
+			"boardMemberships": [
+				{"userId": "u1", "role": "editor"},
+				{"userId": "u2", "role": "viewer", "canComment": true}],
+			"lists": [
+				{"id": "l2", "type": "closed", "name": "Done", "position": 2},
+				{"id": "l1", "type": "active", "name": "Todo", "position": 1},
+				{"id": "l3", "type": "archive", "name": "Archive"}],
+			"cards": [
+				{"id": "c2", "listId": "l1", "name": "Second", "position": 2},
+				{"id": "c1", "listId": "l1", "name": "First", "position": 1, "description": "**bold**",
+				 "dueDate": "2026-01-02T00:00:00.000Z", "coverAttachmentId": "a1"}],
+			"labels": [{"id": "lb1", "name": "bug", "color": "berry-red"}],
+			"cardLabels": [{"cardId": "c1", "labelId": "lb1"}],
+			"cardMemberships": [{"cardId": "c1", "userId": "u2"}],
+			"taskLists": [{"id": "tl1", "cardId": "c1", "name": "Steps"}],
+			"tasks": [
+				{"id": "t2", "taskListId": "tl1", "name": "ship", "position": 2},
+				{"id": "t1", "taskListId": "tl1", "name": "plan", "position": 1, "isCompleted": true}],
+			"attachments": [
+				{"id": "a1", "cardId": "c1", "type": "file", "name": "notes.txt",
+				 "data": {"sizeInBytes": "4", "mimeType": "text/plain"}},
+				{"id": "a2", "cardId": "c1", "type": "link", "name": "site", "data": {"url": "https://example.com"}}]}}`)
+	})
+	mux.HandleFunc("GET /api/boards/b2", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"item": {"id": "b2", "name": "Beta"}, "included": {}}`)
+	})
+	mux.HandleFunc("GET /api/cards/c1/comments", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("beforeId") != "" {
+			io.WriteString(w, `{"items": []}`)
+			return
+		}
+		io.WriteString(w, `{"items": [
+			{"id": "m2", "userId": "u2", "text": "newer", "createdAt": "2026-01-02T00:00:00.000Z"},
+			{"id": "m1", "userId": "u1", "text": "older", "createdAt": "2026-01-01T00:00:00.000Z"}]}`)
+	})
+	mux.HandleFunc("GET /attachments/a1/download/notes.txt", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer planka-token" {
+			t.Errorf("download authorization = %q", got)
+		}
+		io.WriteString(w, "data")
+	})
+	useTestServers(t, mux)
+}
+
+func TestPlankaSourceReadsBoards(t *testing.T) {
+	usePlankaSourceServer(t)
+	source, err := newPlankaSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Users(); err != nil {
+		t.Fatal(err)
+	}
+
+	spaces, err := source.Spaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	space := spaces["p1"]
+	if space.Name != "Team" || space.UID != "p1" {
+		t.Fatalf("space = %+v", space)
+	}
+	access, err := source.SpaceAccess(space)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []KaitenAccess{{UserID: syntheticID("u1"), Email: "ann@example.com", Role: kaitenAccessOwner}}; !reflect.DeepEqual(access, want) {
+		t.Errorf("space access = %+v, want %+v", access, want)
+	}
+
+	boards, err := source.Boards(space)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(boards) != 2 || boards[0].Title != "Alpha" || boards[1].Title != "Beta" {
+		t.Fatalf("boards = %+v, want Alpha and Beta by position", boards)
+	}
+	board := boards[0]
+	access, err = source.BoardAccess(board)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantAccess := []KaitenAccess{
+		{UserID: syntheticID("u1"), Email: "ann@example.com", Role: kaitenAccessWriter},
+		{UserID: syntheticID("u2"), Email: "bob@example.com", Role: kaitenAccessCommenter},
+	}
+	if !reflect.DeepEqual(access, wantAccess) {
+		t.Errorf("board access = %+v, want %+v", access, wantAccess)
+	}
+
+	columns, err := source.Columns(board)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(columns) != 2 || columns[0].Name != "Todo" || columns[1].Name != "Done" {
+		t.Fatalf("columns = %+v, want Todo and Done without the archive", columns)
+	}
+
+	cards, err := source.Cards(columns[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cards) != 2 || cards[0].Title != "First" || cards[1].Title != "Second" {
+		t.Fatalf("cards = %+v, want First and Second by position", cards)
+	}
+	card := cards[0]
+	wantCard := KaitenCard{
+		ID:          syntheticID("c1"),
+		BoardID:     board.ID,
+		Title:       "First",
+		Description: "**bold**",
+		SortOrder:   1,
+		DueDate:     "2026-01-02T00:00:00.000Z",
+		TagIds:      []float64{syntheticID("lb1")},
+		Members:     []KaitenCardMember{{Email: "bob@example.com", Type: kaitenMemberTypeMember}},
+		Checklists:  []float64{syntheticID("tl1")},
+	}
+	if !reflect.DeepEqual(card, wantCard) {
+		t.Errorf("card = %+v, want %+v", card, wantCard)
+	}
+
+	tags, err := source.Tags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag := tags[syntheticID("lb1")]; tag.Name != "bug" || tag.ColorHex == "" {
+		t.Errorf("tag = %+v, want bug with the colour's hex value", tag)
+	}
+
+	checklist, err := source.Checklist(card.ID, card.Checklists[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantChecklist := KaitenChecklist{Name: "Steps", Items: []KaitenChecklistItem{{Text: "plan", Checked: true}, {Text: "ship"}}}
+	if !reflect.DeepEqual(checklist, wantChecklist) {
+		t.Errorf("checklist = %+v, want %+v", checklist, wantChecklist)
+	}
+
+	comments, err := source.Comments(card.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 2 || comments[0].Text != "older" || comments[0].AuthorEmail != "ann@example.com" || comments[1].Text != "newer" {
+		t.Errorf("comments = %+v, want oldest first with author emails", comments)
+	}
+
+	attachments, err := source.Attachments(card.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attachments) != 1 {
+		t.Fatalf("attachments = %+v, want only the file", attachments)
+	}
+	attachment := attachments[0]
+	if attachment.Name != "notes.txt" || attachment.Size != 4 || attachment.MimeType != "text/plain" || !attachment.Cover {
+		t.Errorf("attachment = %+v", attachment)
+	}
+	if !source.IsFileURL(attachment.URL) {
+		t.Errorf("%s is not a PLANKA file URL", attachment.URL)
+	}
+	file, err := source.OpenFile(attachment.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Body.Close()
+	if data, _ := io.ReadAll(file.Body); string(data) != "data" {
+		t.Errorf("file content = %q", data)
+	}
+}
+
+func TestPlankaSourceRejectsUnreadObjects(t *testing.T) {
+	usePlankaSourceServer(t)
+	source, err := newPlankaSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Columns(KaitenBoard{ID: syntheticID("b1")}); err == nil {
+		t.Error("columns of a board that was never listed")
+	}
+	if _, err := source.Attachments(source.id("c1")); err == nil {
+		t.Error("attachments of a card whose board was never read")
+	}
+	if _, err := source.GroupUsers("group"); err == nil {
+		t.Error("PLANKA has no user groups")
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	propertiesModeCustomFields = "custom_fields"
+	propertiesModeDescription  = "description"
+
+	kaitenCustomFieldGroupName = "Kaiten"
+)
+
+// customFieldRegistry keeps the PLANKA custom field group and fields created
+// for Kaiten properties on each board, so every board gets them only once.
+// The lock is not held while PLANKA is called; concurrent callers of the same
+// group or field wait for the one creating it.
+type customFieldRegistry struct {
+	mu     sync.Mutex
+	sink   Sink
+	groups map[string]*customFieldEntry
+	fields map[string]map[string]*customFieldEntry
+}
+
+type customFieldEntry struct {
+	id    string
+	err   error
+	ready chan struct{}
+}
+
+func newCustomFieldRegistry(sink Sink) *customFieldRegistry {
+	return &customFieldRegistry{
+		sink:   sink,
+		groups: make(map[string]*customFieldEntry),
+		fields: make(map[string]map[string]*customFieldEntry),
+	}
+}
+
+// field returns the group and field IDs for a property on the board, creating
+// them on first use.
+func (r *customFieldRegistry) field(boardId string, key string, name string) (string, string, error) {
+	groupId, err := r.ensure(r.groups, boardId, func(int) (string, error) {
+		return r.sink.CreateCustomFieldGroup(boardId, kaitenCustomFieldGroupName)
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("error creating custom field group for board %s: %w", boardId, err)
+	}
+
+	r.mu.Lock()
+	fields, exists := r.fields[boardId]
+	if !exists {
+		fields = make(map[string]*customFieldEntry)
+		r.fields[boardId] = fields
+	}
+	r.mu.Unlock()
+
+	fieldId, err := r.ensure(fields, key, func(position int) (string, error) {
+		return r.sink.CreateCustomField(groupId, PlankaCustomField{
+			Position:          float64(position) * 65536,
+			Name:              name,
+			ShowOnFrontOfCard: false,
+		})
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("error creating custom field %s for board %s: %w", name, boardId, err)
+	}
+	return groupId, fieldId, nil
+}
+
+// ensure returns the ID of entries[key], creating it with create on first
+// use. create gets the 1-based position of the new entry. Failures are not
+// kept, so a later call tries again.
+func (r *customFieldRegistry) ensure(entries map[string]*customFieldEntry, key string, create func(position int) (string, error)) (string, error) {
+	r.mu.Lock()
+	entry, exists := entries[key]
+	if !exists {
+		entry = &customFieldEntry{ready: make(chan struct{})}
+		entries[key] = entry
+	}
+	position := len(entries)
+	r.mu.Unlock()
+
+	if exists {
+		<-entry.ready
+		return entry.id, entry.err
+	}
+
+	entry.id, entry.err = create(position)
+	if entry.err != nil {
+		r.mu.Lock()
+		delete(entries, key)
+		r.mu.Unlock()
+	}
+	close(entry.ready)
+	return entry.id, entry.err
+}
+
+func (m *migration) processCardProperties(card KaitenCard, cardId string, boardId string) {
+	for _, key := range sortedPropertyKeys(card.Properties) {
+		property, ok := m.properties[key]
+		if !ok {
+			property = KaitenCustomProperty{Name: key}
+		}
+		content := kaitenPropertyText(property, card.Properties[key], m.usersByID)
+		if content == "" {
+			continue
+		}
+
+		groupId, fieldId, err := m.customFields.field(boardId, key, property.Name)
+		if err != nil {
+			log.Printf("Error preparing custom field for property %s: %v", property.Name, err)
+			continue
+		}
+		if err := m.sink.SetCustomFieldValue(cardId, groupId, fieldId, content); err != nil {
+			log.Printf("Error setting custom field %s for card %s: %v", property.Name, cardId, err)
+		}
+	}
+}
+
+// describeKaitenProperties prepends card properties to the already converted
+// description as a "Детализация" section, used when custom fields are
+// switched off.
+func describeKaitenProperties(card KaitenCard, properties map[string]KaitenCustomProperty, users map[float64]KaitenUser) string {
+	var lines []string
+	for _, key := range sortedPropertyKeys(card.Properties) {
+		property, ok := properties[key]
+		if !ok {
+			property = KaitenCustomProperty{Name: key}
+		}
+		content := kaitenPropertyText(property, card.Properties[key], users)
+		if content == "" {
+			continue
+		}
+		lines = append(lines, "**"+property.Name+"**: "+content)
+	}
+	if len(lines) == 0 {
+		return card.Description
+	}
+	return "## Детализация\n\n" + strings.Join(lines, "\n") + "\n\n## Описание\n\n" + card.Description
+}
+
+func sortedPropertyKeys(values map[string]any) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// kaitenPropertyText converts a raw Kaiten property value to the text stored
+// in PLANKA according to the property type.
+func kaitenPropertyText(property KaitenCustomProperty, value any, users map[float64]KaitenUser) string {
+	if value == nil {
+		return ""
+	}
+
+	switch property.Type {
+	case "select", "multi_select":
+		var names []string
+		for _, id := range propertyValueList(value) {
+			if name, ok := property.SelectValues[propertyScalarText(id)]; ok {
+				names = append(names, name)
+			} else {
+				names = append(names, propertyScalarText(id))
+			}
+		}
+		return strings.Join(names, ", ")
+	case "user":
+		var names []string
+		for _, item := range propertyValueList(value) {
+			names = append(names, kaitenPropertyUserName(item, users))
+		}
+		return strings.Join(names, ", ")
+	case "date":
+		return kaitenPropertyDate(value)
+	case "checkbox":
+		if checked, ok := value.(bool); ok {
+			if checked {
+				return "Да"
+			}
+			return "Нет"
+		}
+	}
+
+	switch v := value.(type) {
+	case []any:
+		var items []string
+		for _, item := range v {
+			items = append(items, propertyScalarText(item))
+		}
+		return strings.Join(items, ", ")
+	default:
+		return propertyScalarText(v)
+	}
+}
+
+func propertyValueList(value any) []any {
+	if list, ok := value.([]any); ok {
+		return list
+	}
+	return []any{value}
+}
+
+func propertyScalarText(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
+
+func kaitenPropertyUserName(value any, users map[float64]KaitenUser) string {
+	switch v := value.(type) {
+	case float64:
+		if user, ok := users[v]; ok {
+			if user.FullName != "" {
+				return user.FullName
+			}
+			return user.Email
+		}
+	case map[string]any:
+		if name, ok := v["full_name"].(string); ok && name != "" {
+			return name
+		}
+		if email, ok := v["email"].(string); ok {
+			return email
+		}
+		if id, ok := v["id"].(float64); ok {
+			return kaitenPropertyUserName(id, users)
+		}
+	}
+	return propertyScalarText(value)
+}
+
+// kaitenPropertyDate accepts both plain date strings and Kaiten date objects
+// ({"date": "...", "time": "..."}).
+func kaitenPropertyDate(value any) string {
+	switch v := value.(type) {
+	case string:
+		if parsed, err := time.Parse(time.RFC3339, v); err == nil {
+			return parsed.Format("2006-01-02 15:04")
+		}
+		return v
+	case map[string]any:
+		date, _ := v["date"].(string)
+		if clock, ok := v["time"].(string); ok && clock != "" {
+			return strings.TrimSpace(date + " " + clock)
+		}
+		return date
+	}
+	return propertyScalarText(value)
+}
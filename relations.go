@@ -0,0 +1,193 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+)
+
+const (
+	kaitenCardStateDone = 3
+
+	childrenTasklistName = "Children"
+	blockedLabelName     = "Blocked"
+	blockedLabelColor    = "berry-red"
+)
+
+// pendingRelations collects cards whose parent/child links and blockers can
+// only be written once every card of the run exists in PLANKA.
+type pendingRelations struct {
+	sink     Sink
+	text     *textConverter
+	mu       sync.Mutex
+	cards    []relatedCard
+	comments []linkedComment
+	titles   map[float64]string
+	states   map[float64]float64
+}
+
+type relatedCard struct {
+	card        KaitenCard
+	cardId      string
+	boardId     string
+	description string
+}
+
+// linkedComment is a comment that links to Kaiten cards migrated after it.
+type linkedComment struct {
+	commentId   string
+	authorEmail string
+	text        string
+}
+
+func newPendingRelations(sink Sink, text *textConverter) *pendingRelations {
+	return &pendingRelations{sink: sink, text: text, titles: make(map[float64]string), states: make(map[float64]float64)}
+}
+
+func (p *pendingRelations) add(card KaitenCard, cardId string, boardId string, description string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.titles[card.ID] = card.Title
+	p.states[card.ID] = card.State
+	if len(card.ParentIds) == 0 && len(card.ChildIds) == 0 && !card.blocked() && !p.text.hasUnresolvedCardLinks(description) {
+		return
+	}
+	p.cards = append(p.cards, relatedCard{card: card, cardId: cardId, boardId: boardId, description: description})
+}
+
+func (p *pendingRelations) addComment(commentId string, comment KaitenComment) {
+	if !p.text.hasUnresolvedCardLinks(comment.Text) {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.comments = append(p.comments, linkedComment{commentId: commentId, authorEmail: comment.AuthorEmail, text: comment.Text})
+}
+
+// resolve is the second migration pass: it links related cards through the
+// ID mapping, adds the "Children" task list, marks blocked cards and rewrites
+// links to cards that were migrated later than the text referring to them.
+func (p *pendingRelations) resolve(mapping *mappingStore, labels *labelRegistry, images *inlineImages) {
+	for _, related := range p.cards {
+		description := images.rewrite(related.cardId, p.text.relinkCards(related.description))
+		if section := p.relationsSection(related.card, mapping); section != "" {
+			description = strings.TrimSpace(description + "\n\n## Связи\n\n" + section)
+		}
+		if err := p.sink.UpdateCard(related.cardId, map[string]any{"description": description}); err != nil {
+			log.Printf("Error writing relations to card %s: %v", related.cardId, err)
+		}
+
+		if len(related.card.ChildIds) > 0 {
+			p.createChildrenTasks(related, mapping)
+		}
+
+		if related.card.blocked() {
+			p.markBlocked(related, mapping, labels)
+		}
+		log.Printf("Resolved relations for card %s", related.cardId)
+	}
+
+	for _, comment := range p.comments {
+		if err := p.sink.UpdateComment(comment.commentId, comment.authorEmail, p.text.relinkCards(comment.text)); err != nil {
+			log.Printf("Error rewriting card links in comment %s: %v", comment.commentId, err)
+		}
+	}
+}
+
+func (p *pendingRelations) relationsSection(card KaitenCard, mapping *mappingStore) string {
+	var lines []string
+	for _, parentId := range card.ParentIds {
+		lines = append(lines, "- Родительская карточка: "+p.cardLink(parentId, mapping))
+	}
+	for _, childId := range card.ChildIds {
+		lines = append(lines, "- Дочерняя карточка: "+p.cardLink(childId, mapping))
+	}
+	for _, blocker := range card.Blockers {
+		if blocker.Released {
+			continue
+		}
+		line := "- Заблокирована"
+		if blocker.BlockerCardID != 0 {
+			line += " карточкой " + p.cardLink(blocker.BlockerCardID, mapping)
+		}
+		if blocker.Reason != "" {
+			line += ": " + blocker.Reason
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (p *pendingRelations) createChildrenTasks(related relatedCard, mapping *mappingStore) {
+	listId, err := p.sink.CreateTaskList(related.cardId, childrenTasklistName)
+	if err != nil {
+		log.Printf("Error creating children tasklist for card %s: %v", related.cardId, err)
+		return
+	}
+	for i, childId := range related.card.ChildIds {
+		task := PlankaTask{
+			Position: float64(i+1) * 65536,
+			Name:     p.cardTitle(childId),
+		}
+		if plankaCardId, ok := mapping.Get(mappingKindCard, formatKaitenID(childId)); ok {
+			task.LinkedCardID = plankaCardId
+		} else {
+			task.Name += " (Kaiten #" + formatKaitenID(childId) + ")"
+		}
+		task.IsCompleted = p.states[childId] == kaitenCardStateDone
+		if _, err := p.sink.CreateTask(listId, task); err != nil {
+			log.Printf("Error creating child task for card %s: %v", related.cardId, err)
+		}
+	}
+}
+
+func (p *pendingRelations) markBlocked(related relatedCard, mapping *mappingStore, labels *labelRegistry) {
+	label, err := labels.ensure(related.boardId, labelKindBlocked, PlankaLabel{Name: blockedLabelName, Color: blockedLabelColor})
+	if err != nil {
+		log.Printf("Error creating %s label for board %s: %v", blockedLabelName, related.boardId, err)
+	} else if err := p.sink.AddCardLabel(related.cardId, label.Id); err != nil {
+		log.Printf("Error setting %s label for card %s: %v", blockedLabelName, related.cardId, err)
+	}
+
+	for _, blocker := range related.card.Blockers {
+		if blocker.Released {
+			continue
+		}
+		text := "Карточка заблокирована"
+		if blocker.BlockerCardID != 0 {
+			text += " карточкой " + p.cardLink(blocker.BlockerCardID, mapping)
+		}
+		if blocker.Reason != "" {
+			text += "\n\nПричина: " + blocker.Reason
+		}
+		if _, err := p.sink.CreateComment(related.cardId, KaitenComment{Text: text}); err != nil {
+			log.Printf("Error creating blocker comment for card %s: %v", related.cardId, err)
+		}
+	}
+}
+
+func (p *pendingRelations) cardTitle(kaitenCardId float64) string {
+	if title, ok := p.titles[kaitenCardId]; ok {
+		return title
+	}
+	return "Kaiten #" + formatKaitenID(kaitenCardId)
+}
+
+func (p *pendingRelations) cardLink(kaitenCardId float64, mapping *mappingStore) string {
+	title := p.cardTitle(kaitenCardId)
+	if plankaCardId, ok := mapping.Get(mappingKindCard, formatKaitenID(kaitenCardId)); ok {
+		return "[" + title + "](" + p.sink.CardURL(plankaCardId) + ")"
+	}
+	return title
+}
+
+func (card KaitenCard) blocked() bool {
+	for _, blocker := range card.Blockers {
+		if !blocker.Released {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPendingRelationsResolve(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		card        KaitenCard
+		description string
+		want        string
+		tasks       []PlankaTask
+		blocked     bool
+	}{
+		{
+			name: "parent and children",
+			card: KaitenCard{ID: 10, Title: "Эпик", ParentIds: []float64{1}, ChildIds: []float64{2, 3}},
+			want: "Текст\n\n## Связи\n\n" +
+				"- Родительская карточка: [Первая](https://planka.example/cards/p1)\n" +
+				"- Дочерняя карточка: [Вторая](https://planka.example/cards/p2)\n" +
+				"- Дочерняя карточка: Kaiten #3",
+			tasks: []PlankaTask{
+				{Position: 65536, Name: "Вторая", LinkedCardID: "p2", IsCompleted: true},
+				{Position: 131072, Name: "Kaiten #3 (Kaiten #3)"},
+			},
+		},
+		{
+			name: "blocked by a card",
+			card: KaitenCard{ID: 10, Title: "Ждёт", Blockers: []KaitenBlocker{
+				{BlockerCardID: 1, Reason: "нужен API"},
+				{BlockerCardID: 2, Released: true},
+			}},
+			want:    "Текст\n\n## Связи\n\n- Заблокирована карточкой [Первая](https://planka.example/cards/p1): нужен API",
+			blocked: true,
+		},
+		{
+			name:        "link to a card migrated later",
+			card:        KaitenCard{ID: 10, Title: "Ссылка"},
+			description: "См. https://kaiten.example/space/5/card/2",
+			want:        "См. https://planka.example/cards/p2",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sink := newRecordingSink()
+			mapping := &mappingStore{Entries: make(map[string]map[string]string)}
+			text := newTextConverter(nil, mapping, "https://kaiten.example", sink.CardURL)
+			files, err := newAttachmentCache(&memSource{}, sink)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer files.Close()
+			images := newInlineImages(&memSource{}, sink, files, false)
+			relations := newPendingRelations(sink, text)
+
+			description := test.description
+			if description == "" {
+				description = "Текст"
+			}
+			relations.add(test.card, "card", "board", description)
+			mapping.Set(mappingKindCard, "1", "p1")
+			relations.add(KaitenCard{ID: 1, Title: "Первая"}, "p1", "board", "")
+			mapping.Set(mappingKindCard, "2", "p2")
+			relations.add(KaitenCard{ID: 2, Title: "Вторая", State: kaitenCardStateDone}, "p2", "board", "")
+			relations.resolve(mapping, newLabelRegistry(sink, mapping, nil), images)
+
+			if got := sink.descriptions["card"]; got != test.want {
+				t.Errorf("description = %q, want %q", got, test.want)
+			}
+			tasks := sink.tasks["card/"+childrenTasklistName]
+			if len(tasks) != len(test.tasks) {
+				t.Fatalf("tasks = %+v, want %+v", tasks, test.tasks)
+			}
+			for i := range tasks {
+				if tasks[i] != test.tasks[i] {
+					t.Errorf("task %d = %+v, want %+v", i, tasks[i], test.tasks[i])
+				}
+			}
+			if got := sink.has("AddCardLabel card label:" + blockedLabelName); got != test.blocked {
+				t.Errorf("blocked label set = %v, want %v", got, test.blocked)
+			}
+			var comments []string
+			for _, comment := range sink.comments["card"] {
+				comments = append(comments, comment.Text)
+			}
+			if test.blocked && strings.Join(comments, "\n") != "Карточка заблокирована карточкой [Первая](https://planka.example/cards/p1)\n\nПричина: нужен API" {
+				t.Errorf("blocker comments = %q", comments)
+			}
+		})
+	}
+}
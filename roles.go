@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	kaitenCompanyRoleAdmin = "admin"
+	kaitenCompanyRoleUser  = "user"
+	kaitenCompanyRoleGuest = "guest"
+
+	plankaRoleAdmin        = "admin"
+	plankaRoleProjectOwner = "projectOwner"
+	plankaRoleBoardUser    = "boardUser"
+
+	defaultUserRoleRules = "admin=admin,user=boardUser,guest=boardUser"
+)
+
+// kaitenCompanyRoleIds maps the role of Kaiten company users to company
+// roles. KAITEN_COMPANY_ROLE_IDS replaces it.
+var kaitenCompanyRoleIds = map[float64]string{
+	1: kaitenCompanyRoleAdmin,
+	2: kaitenCompanyRoleAdmin,
+	3: kaitenCompanyRoleUser,
+	4: kaitenCompanyRoleGuest,
+}
+
+// kaitenCompanyRole reads the company role of a Kaiten user from its role.
+// A missing or unknown role is an error.
+func kaitenCompanyRole(user map[string]any) (string, error) {
+	id, ok := user["role"].(float64)
+	if !ok {
+		return "", fmt.Errorf("user has no role")
+	}
+	role, ok := kaitenCompanyRoleIds[id]
+	if !ok {
+		return "", fmt.Errorf("unknown Kaiten company role %s, map it in KAITEN_COMPANY_ROLE_IDS", formatKaitenID(id))
+	}
+	return role, nil
+}
+
+// parseKaitenRoleIds parses Kaiten role ID mappings like "1=reader,2=writer"
+// into the given roles.
+func parseKaitenRoleIds(spec string, roles ...string) (map[float64]string, error) {
+	ids := make(map[float64]string)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, role, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("role mapping %q has no role", entry)
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(id), 64)
+		if err != nil {
+			return nil, fmt.Errorf("role mapping %q has no numeric role ID", entry)
+		}
+		role = strings.TrimSpace(role)
+		if !slices.Contains(roles, role) {
+			return nil, fmt.Errorf("role mapping %q uses unknown role %q, expected one of %s", entry, role, strings.Join(roles, ", "))
+		}
+		ids[value] = role
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no roles mapped")
+	}
+	return ids, nil
+}
+
+// userRoleRules maps Kaiten company roles to PLANKA user roles.
+type userRoleRules map[string]string
+
+// parseUserRoleRules parses rules like "admin=admin,user=boardUser".
+func parseUserRoleRules(spec string) (userRoleRules, error) {
+	rules := make(userRoleRules)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kaitenRole, plankaRole, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("user role rule %q has no target", entry)
+		}
+		plankaRole = strings.TrimSpace(plankaRole)
+		switch plankaRole {
+		case plankaRoleAdmin, plankaRoleProjectOwner, plankaRoleBoardUser:
+		default:
+			return nil, fmt.Errorf("user role rule %q uses unknown PLANKA role %q", entry, plankaRole)
+		}
+		rules[strings.TrimSpace(kaitenRole)] = plankaRole
+	}
+	return rules, nil
+}
+
+func (rules userRoleRules) role(companyRole string) string {
+	if role, ok := rules[companyRole]; ok {
+		return role
+	}
+	return plankaRoleBoardUser
+}
+
+// promoteProjectOwners lets space owners create projects in PLANKA too and
+// returns the owners it promoted. The roles are read from PLANKA, so owners
+// whose accounts existed before the run are promoted as well.
+func promoteProjectOwners(sink Sink, owners map[string]struct{}) map[string]struct{} {
+	promoted := make(map[string]struct{})
+	if len(owners) == 0 {
+		return promoted
+	}
+	users, err := sink.Users()
+	if err != nil {
+		log.Printf("Error fetching Planka users to promote space owners: %v", err)
+		return promoted
+	}
+	for _, user := range users {
+		if _, owner := owners[user.Email]; !owner || user.Role != plankaRoleBoardUser {
+			continue
+		}
+		if err := sink.SetUserRole(user.ID, plankaRoleProjectOwner); err != nil {
+			log.Printf("Error promoting %s to project owner: %v", user.Email, err)
+			continue
+		}
+		promoted[user.Email] = struct{}{}
+	}
+	return promoted
+}
+
+// permissionReport collects the resulting PLANKA permissions of every user so
+// they can be reviewed after the run.
+type permissionReport struct {
+	mu   sync.Mutex
+	rows [][]string
+}
+
+func newPermissionReport() *permissionReport {
+	return &permissionReport{}
+}
+
+func (r *permissionReport) add(scope string, project string, board string, email string, kaitenRole string, plankaRole string, via string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rows = append(r.rows, []string{scope, project, board, email, kaitenRole, plankaRole, via})
+}
+
+// Save writes the permission matrix as CSV, sorted by project, board and user.
+func (r *permissionReport) Save(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sort.SliceStable(r.rows, func(i, j int) bool {
+		for column := 0; column < 4; column++ {
+			if r.rows[i][column] != r.rows[j][column] {
+				return r.rows[i][column] < r.rows[j][column]
+			}
+		}
+		return false
+	})
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create permission report %s: %w", path, err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"scope", "project", "board", "email", "kaiten_role", "planka_role", "via"})
+	writer.WriteAll(r.rows)
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write permission report %s: %w", path, err)
+	}
+	return file.Close()
+}
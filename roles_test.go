@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestKaitenRolesComeFromRoleIds(t *testing.T) {
+	if role, err := kaitenAccessRole(map[string]any{"role_id": 2.0}); err != nil || role != kaitenAccessWriter {
+		t.Errorf("role_id 2 = %q, %v; want writer", role, err)
+	}
+	for _, entry := range []map[string]any{
+		{"role_id": 9.0},
+		{"role": "admin"},
+		{},
+	} {
+		if role, err := kaitenAccessRole(entry); err == nil {
+			t.Errorf("access %v = %q, want an error", entry, role)
+		}
+	}
+
+	if role, err := kaitenCompanyRole(map[string]any{"role": 4.0}); err != nil || role != kaitenCompanyRoleGuest {
+		t.Errorf("company role 4 = %q, %v; want guest", role, err)
+	}
+	if _, ok, err := parseKaitenUser(map[string]any{"email": "ann@example.com", "role": 7.0, "is_admin": true}); err == nil || ok {
+		t.Error("user with an unknown role was accepted")
+	}
+}
+
+func TestParseKaitenRoleIds(t *testing.T) {
+	ids, err := parseKaitenRoleIds("1=reader, 5=commenter", kaitenAccessReader, kaitenAccessCommenter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[5] != kaitenAccessCommenter {
+		t.Errorf("ids = %v", ids)
+	}
+	for _, spec := range []string{"1=boss", "x=reader", "1", ""} {
+		if _, err := parseKaitenRoleIds(spec, kaitenAccessReader); err == nil {
+			t.Errorf("%q was accepted", spec)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// Sink creates the migrated objects. IDs are the sink's own. Author and user
+// e-mails may be "" for content written by the sink's own account.
+type Sink interface {
+	// AccountEmail is the e-mail of the account the sink writes as. It owns
+	// every created project and board already.
+	AccountEmail() string
+
+	Users() ([]PlankaUserInfo, error)
+	// CreateUser returns the ID of the new user, or "" for one that exists.
+	CreateUser(user PlankaUser) (string, error)
+	SetUserRole(userId string, role string) error
+	DeactivateUser(userId string) error
+
+	CreateProject(space KaitenSpace) (PlankaProject, error)
+	AddProjectManager(projectId string, userId string) error
+	CreateBoard(projectId string, board KaitenBoard, prefix string) (PlankaBoard, error)
+	AddBoardMember(boardId string, userId string, role string, canComment bool) error
+	CreateList(boardId string, column KaitenColumn) (PlankaList, error)
+
+	CreateCard(listId string, card KaitenCard, cardType string) (string, error)
+	UpdateCard(cardId string, fields map[string]any) error
+	CardURL(cardId string) string
+	AddCardMember(cardId string, userId string) error
+	SubscribeCard(cardId string, email string) error
+
+	CreateComment(cardId string, comment KaitenComment) (string, error)
+	UpdateComment(commentId string, authorEmail string, text string) error
+
+	UploadAttachment(cardId string, content io.Reader, name string, mimeType string, authorEmail string) (PlankaAttachment, error)
+	OpenAttachment(attachmentURL string) (SourceFile, error)
+
+	CreateTaskList(cardId string, name string) (string, error)
+	CreateTask(listId string, task PlankaTask) (string, error)
+
+	BoardLabels(boardId string) ([]PlankaLabel, error)
+	CreateLabel(boardId string, label PlankaLabel) (PlankaLabel, error)
+	AddCardLabel(cardId string, labelId string) error
+
+	CreateCustomFieldGroup(boardId string, name string) (string, error)
+	CreateCustomField(groupId string, field PlankaCustomField) (string, error)
+	SetCustomFieldValue(cardId string, groupId string, fieldId string, content string) error
+}
+
+// plankaSink writes to a PLANKA instance through its REST API.
+type plankaSink struct{}
+
+func newPlankaSink() (*plankaSink, error) {
+	if err := initPlankaEnv(); err != nil {
+		return nil, fmt.Errorf("cannot get variable values for PLANKA API: %w", err)
+	}
+	return &plankaSink{}, nil
+}
+
+func (s *plankaSink) AccountEmail() string {
+	return plankaAdminMail
+}
+
+func (s *plankaSink) Users() ([]PlankaUserInfo, error) {
+	return getPlankaUsers()
+}
+
+func (s *plankaSink) CreateUser(user PlankaUser) (string, error) {
+	return createPlankaUser(user)
+}
+
+func (s *plankaSink) SetUserRole(userId string, role string) error {
+	return updatePlankaUserRole(userId, role)
+}
+
+func (s *plankaSink) DeactivateUser(userId string) error {
+	return deactivatePlankaUser(userId)
+}
+
+func (s *plankaSink) CreateProject(space KaitenSpace) (PlankaProject, error) {
+	return createPlankaProject(space)
+}
+
+func (s *plankaSink) AddProjectManager(projectId string, userId string) error {
+	return addPlankaProjectManager(projectId, userId)
+}
+
+func (s *plankaSink) CreateBoard(projectId string, board KaitenBoard, prefix string) (PlankaBoard, error) {
+	return createPlankaBoard(projectId, board, prefix)
+}
+
+func (s *plankaSink) AddBoardMember(boardId string, userId string, role string, canComment bool) error {
+	return setPlankaBoardMember(boardId, userId, role, canComment)
+}
+
+func (s *plankaSink) CreateList(boardId string, column KaitenColumn) (PlankaList, error) {
+	return createPlankaList(boardId, column)
+}
+
+func (s *plankaSink) CreateCard(listId string, card KaitenCard, cardType string) (string, error) {
+	return createPlankaCard(listId, card, cardType)
+}
+
+func (s *plankaSink) UpdateCard(cardId string, fields map[string]any) error {
+	return updatePlankaCard(cardId, fields)
+}
+
+func (s *plankaSink) CardURL(cardId string) string {
+	return plankaCardURL(cardId)
+}
+
+func (s *plankaSink) AddCardMember(cardId string, userId string) error {
+	return setPlankaCardNumber(cardId, userId)
+}
+
+// SubscribeCard subscribes the user on their own behalf, since PLANKA only
+// lets users manage their own subscriptions.
+func (s *plankaSink) SubscribeCard(cardId string, email string) error {
+	token, err := getPlankaAccessToken(email)
+	if err != nil {
+		return err
+	}
+	return subscribePlankaCard(cardId, token)
+}
+
+func (s *plankaSink) CreateComment(cardId string, comment KaitenComment) (string, error) {
+	if comment.AuthorEmail == "" {
+		comment.AuthorEmail = plankaAdminMail
+	}
+	return createPlankaCommentForCard(cardId, comment)
+}
+
+func (s *plankaSink) UpdateComment(commentId string, authorEmail string, text string) error {
+	if authorEmail == "" {
+		authorEmail = plankaAdminMail
+	}
+	return updatePlankaCommentText(commentId, authorEmail, text)
+}
+
+// UploadAttachment uploads on behalf of the author, or with the API token
+// when there is none.
+func (s *plankaSink) UploadAttachment(cardId string, content io.Reader, name string, mimeType string, authorEmail string) (PlankaAttachment, error) {
+	token := plankaToken
+	if authorEmail != "" {
+		var err error
+		if token, err = plankaUserToken(authorEmail); err != nil {
+			return PlankaAttachment{}, err
+		}
+	}
+	return uploadPlankaAttachment(cardId, content, name, mimeType, token)
+}
+
+func (s *plankaSink) OpenAttachment(attachmentURL string) (SourceFile, error) {
+	resp, err := plankaDownload(attachmentURL)
+	if err != nil {
+		return SourceFile{}, err
+	}
+	return SourceFile{Body: resp.Body, Size: resp.ContentLength, ContentType: resp.Header.Get("Content-Type")}, nil
+}
+
+func (s *plankaSink) CreateTaskList(cardId string, name string) (string, error) {
+	return createPlankaTasklistForCard(cardId, KaitenChecklist{Name: name})
+}
+
+func (s *plankaSink) CreateTask(listId string, task PlankaTask) (string, error) {
+	return createPlankaTask(listId, task)
+}
+
+func (s *plankaSink) BoardLabels(boardId string) ([]PlankaLabel, error) {
+	return getPlankaLabelsForBoard(boardId)
+}
+
+func (s *plankaSink) CreateLabel(boardId string, label PlankaLabel) (PlankaLabel, error) {
+	return createPlankaLabel(boardId, label)
+}
+
+func (s *plankaSink) AddCardLabel(cardId string, labelId string) error {
+	return createPlankaLabelForCard(cardId, labelId)
+}
+
+func (s *plankaSink) CreateCustomFieldGroup(boardId string, name string) (string, error) {
+	return createPlankaCustomFieldGroupForBoard(boardId, name)
+}
+
+func (s *plankaSink) CreateCustomField(groupId string, field PlankaCustomField) (string, error) {
+	return createPlankaCustomField(groupId, field)
+}
+
+func (s *plankaSink) SetCustomFieldValue(cardId string, groupId string, fieldId string, content string) error {
+	return setPlankaCustomFieldValue(cardId, groupId, fieldId, content)
+}
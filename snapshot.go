@@ -0,0 +1,537 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// snapshotFormat is the version of the archive layout written by export:
+//
+//	manifest.json      snapshotManifest
+//	users.json         users
+//	tags.json          tags
+//	properties.json    custom properties
+//	spaces.json        spaces by UID
+//	groups.json        user IDs of every group that has access somewhere
+//	spaces/<uid>.json  snapshotSpace
+//	boards/<id>.json   snapshotBoard
+//	columns/<id>.json  cards of the column
+//	cards/<id>.json    snapshotCard
+//	files.json         snapshotFile by Kaiten file URL
+//	files/<sha256>     attachment and inline image contents
+//
+// Format 1 kept descriptions and comments as Kaiten HTML, format 2 keeps
+// them as Markdown.
+const snapshotFormat = 2
+
+const defaultSnapshotDir = "kaiten-snapshot"
+
+type snapshotManifest struct {
+	Format     int    `json:"format"`
+	SourceURL  string `json:"source_url"`
+	ExportedAt string `json:"exported_at"`
+	Errors     int    `json:"errors"`
+}
+
+type snapshotSpace struct {
+	Access []KaitenAccess `json:"access"`
+	Boards []KaitenBoard  `json:"boards"`
+}
+
+type snapshotBoard struct {
+	// AccessInherited is set when the board has no access list of its own.
+	AccessInherited bool           `json:"access_inherited,omitempty"`
+	Access          []KaitenAccess `json:"access,omitempty"`
+	Columns         []KaitenColumn `json:"columns"`
+	Lanes           []KaitenLane   `json:"lanes,omitempty"`
+}
+
+type snapshotCard struct {
+	Comments    []KaitenComment            `json:"comments"`
+	Attachments []KaitenAttachment         `json:"attachments"`
+	Checklists  map[string]KaitenChecklist `json:"checklists,omitempty"`
+	Subscribers []string                   `json:"subscribers"`
+	TimeLogs    []KaitenTimeLog            `json:"time_logs"`
+}
+
+type snapshotFile struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	MimeType string `json:"mime_type,omitempty"`
+	SHA256   string `json:"sha256"`
+}
+
+// snapshotWriter dumps everything the migration reads from a source into a
+// directory. Failures to read single objects are logged and counted, so one
+// broken card does not cost the whole export.
+type snapshotWriter struct {
+	dir    string
+	source Source
+	index  map[string]snapshotFile
+	groups map[string][]float64
+	errors int
+}
+
+func exportSnapshot(source Source, dir string) error {
+	for _, sub := range []string{"spaces", "boards", "columns", "cards", "files"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return fmt.Errorf("failed to create snapshot directory: %w", err)
+		}
+	}
+	w := &snapshotWriter{
+		dir:    dir,
+		source: source,
+		index:  make(map[string]snapshotFile),
+		groups: make(map[string][]float64),
+	}
+	if err := w.export(); err != nil {
+		return err
+	}
+
+	manifest := snapshotManifest{
+		Format:     snapshotFormat,
+		SourceURL:  source.URL(),
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		Errors:     w.errors,
+	}
+	if err := w.write("manifest.json", manifest); err != nil {
+		return err
+	}
+	if w.errors > 0 {
+		return fmt.Errorf("snapshot written to %s with %d errors, see the log", dir, w.errors)
+	}
+	log.Printf("Snapshot written to %s: %d files", dir, len(w.index))
+	return nil
+}
+
+func (w *snapshotWriter) export() error {
+	users, err := w.source.Users()
+	if err != nil {
+		return fmt.Errorf("error getting users: %w", err)
+	}
+	if err := w.write("users.json", users); err != nil {
+		return err
+	}
+
+	tagsById, err := w.source.Tags()
+	if err != nil {
+		return fmt.Errorf("error getting tags: %w", err)
+	}
+	tags := make([]KaitenTag, 0, len(tagsById))
+	for _, tag := range tagsById {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Id < tags[j].Id })
+	if err := w.write("tags.json", tags); err != nil {
+		return err
+	}
+
+	properties, err := w.source.CustomProperties()
+	if err != nil {
+		return fmt.Errorf("error getting custom properties: %w", err)
+	}
+	if err := w.write("properties.json", properties); err != nil {
+		return err
+	}
+
+	spaces, err := w.source.Spaces()
+	if err != nil {
+		return fmt.Errorf("error getting spaces: %w", err)
+	}
+	if err := w.write("spaces.json", spaces); err != nil {
+		return err
+	}
+
+	uids := make([]string, 0, len(spaces))
+	for uid := range spaces {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+	for _, uid := range uids {
+		if err := w.exportSpace(spaces[uid]); err != nil {
+			return err
+		}
+	}
+
+	for uid := range w.groups {
+		users, err := w.source.GroupUsers(uid)
+		if err != nil {
+			w.fail("Error getting users of group %s: %v", uid, err)
+		}
+		w.groups[uid] = users
+	}
+	if err := w.write("groups.json", w.groups); err != nil {
+		return err
+	}
+	return w.write("files.json", w.index)
+}
+
+func (w *snapshotWriter) exportSpace(space KaitenSpace) error {
+	log.Printf("Exporting space %s", space.Name)
+
+	var snapshot snapshotSpace
+	var err error
+	if snapshot.Access, err = w.source.SpaceAccess(space); err != nil {
+		w.fail("Error getting access of space %s: %v", space.Name, err)
+	}
+	w.addGroups(snapshot.Access)
+	if snapshot.Boards, err = w.source.Boards(space); err != nil {
+		w.fail("Error getting boards of space %s: %v", space.Name, err)
+	}
+	if err := w.write(filepath.Join("spaces", space.UID+".json"), snapshot); err != nil {
+		return err
+	}
+
+	for _, board := range snapshot.Boards {
+		if err := w.exportBoard(board); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *snapshotWriter) exportBoard(board KaitenBoard) error {
+	var snapshot snapshotBoard
+	var err error
+	if snapshot.Access, err = w.source.BoardAccess(board); err != nil {
+		w.fail("Error getting access of board %s: %v", board.Title, err)
+	}
+	snapshot.AccessInherited = err == nil && len(snapshot.Access) == 0
+	w.addGroups(snapshot.Access)
+	if snapshot.Columns, err = w.source.Columns(board); err != nil {
+		w.fail("Error getting columns of board %s: %v", board.Title, err)
+	}
+	if lanes, ok := w.source.(laneSource); ok {
+		if snapshot.Lanes, err = lanes.Lanes(board); err != nil {
+			w.fail("Error getting lanes of board %s: %v", board.Title, err)
+		}
+	}
+	if err := w.write(filepath.Join("boards", formatKaitenID(board.ID)+".json"), snapshot); err != nil {
+		return err
+	}
+
+	for _, column := range snapshot.Columns {
+		cards, err := w.source.Cards(column)
+		if err != nil {
+			w.fail("Error getting cards of column %s: %v", column.Name, err)
+		}
+		if err := w.write(filepath.Join("columns", formatKaitenID(column.Id)+".json"), cards); err != nil {
+			return err
+		}
+		for _, card := range cards {
+			if err := w.exportCard(card); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *snapshotWriter) exportCard(card KaitenCard) error {
+	var snapshot snapshotCard
+	var err error
+	if snapshot.Comments, err = w.source.Comments(card.ID); err != nil {
+		w.fail("Error getting comments of card %s: %v", card.Title, err)
+	}
+	if snapshot.Attachments, err = w.source.Attachments(card.ID); err != nil {
+		w.fail("Error getting attachments of card %s: %v", card.Title, err)
+	}
+	if snapshot.Subscribers, err = w.source.Subscribers(card.ID); err != nil {
+		w.fail("Error getting subscribers of card %s: %v", card.Title, err)
+	}
+	if snapshot.TimeLogs, err = w.source.TimeLogs(card.ID); err != nil {
+		w.fail("Error getting time logs of card %s: %v", card.Title, err)
+	}
+	for _, checklistId := range card.Checklists {
+		checklist, err := w.source.Checklist(card.ID, checklistId)
+		if err != nil {
+			w.fail("Error getting checklist %s of card %s: %v", formatKaitenID(checklistId), card.Title, err)
+			continue
+		}
+		if snapshot.Checklists == nil {
+			snapshot.Checklists = make(map[string]KaitenChecklist)
+		}
+		snapshot.Checklists[formatKaitenID(checklistId)] = checklist
+	}
+
+	for _, attachment := range snapshot.Attachments {
+		w.saveFile(attachment.URL)
+	}
+	w.saveInlineImages(card.Description)
+	for _, comment := range snapshot.Comments {
+		w.saveInlineImages(comment.Text)
+	}
+
+	return w.write(filepath.Join("cards", formatKaitenID(card.ID)+".json"), snapshot)
+}
+
+// saveInlineImages stores the source's images embedded in the Markdown text.
+func (w *snapshotWriter) saveInlineImages(text string) {
+	for _, parts := range markdownImagePattern.FindAllStringSubmatch(text, -1) {
+		if w.source.IsFileURL(parts[2]) {
+			w.saveFile(parts[2])
+		}
+	}
+}
+
+// saveFile stores a file once per content hash and indexes it by URL. The
+// download goes straight into the files directory and is renamed to its hash.
+func (w *snapshotWriter) saveFile(fileURL string) {
+	if _, ok := w.index[fileURL]; ok || fileURL == "" {
+		return
+	}
+	file, err := spoolSourceFile(w.source, fileURL, filepath.Join(w.dir, "files"))
+	if err != nil {
+		w.fail("Error downloading %s: %v", fileURL, err)
+		return
+	}
+
+	relPath := filepath.Join("files", file.sha256)
+	if _, err := os.Stat(filepath.Join(w.dir, relPath)); err == nil {
+		os.Remove(file.path)
+	} else if err := os.Rename(file.path, filepath.Join(w.dir, relPath)); err != nil {
+		os.Remove(file.path)
+		w.fail("Error storing %s: %v", fileURL, err)
+		return
+	}
+	w.index[fileURL] = snapshotFile{
+		Path:     filepath.ToSlash(relPath),
+		Size:     file.size,
+		MimeType: file.mimeType,
+		SHA256:   file.sha256,
+	}
+}
+
+func (w *snapshotWriter) addGroups(access []KaitenAccess) {
+	for _, entry := range access {
+		if entry.GroupUID != "" {
+			w.groups[entry.GroupUID] = nil
+		}
+	}
+}
+
+func (w *snapshotWriter) fail(format string, args ...any) {
+	log.Printf(format, args...)
+	w.errors++
+}
+
+func (w *snapshotWriter) write(name string, value any) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", name, err)
+	}
+	if err := os.WriteFile(filepath.Join(w.dir, name), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// snapshotSource reads a snapshot written by export, so the migration runs
+// without access to Kaiten.
+type snapshotSource struct {
+	dir        string
+	manifest   snapshotManifest
+	users      []KaitenUser
+	tags       []KaitenTag
+	properties map[string]KaitenCustomProperty
+	spaces     map[string]KaitenSpace
+	groups     map[string][]float64
+	files      map[string]snapshotFile
+	usernames  map[string]string
+}
+
+func newSnapshotSource(dir string) (*snapshotSource, error) {
+	s := &snapshotSource{dir: dir}
+	if err := s.read("manifest.json", &s.manifest); err != nil {
+		return nil, err
+	}
+	if s.manifest.Format != snapshotFormat && s.manifest.Format != 1 {
+		return nil, fmt.Errorf("unsupported snapshot format %d in %s", s.manifest.Format, dir)
+	}
+	if s.manifest.Errors > 0 {
+		log.Printf("Snapshot %s was exported with %d errors, some data may be missing", dir, s.manifest.Errors)
+	}
+
+	for name, value := range map[string]any{
+		"users.json":      &s.users,
+		"tags.json":       &s.tags,
+		"properties.json": &s.properties,
+		"spaces.json":     &s.spaces,
+		"groups.json":     &s.groups,
+		"files.json":      &s.files,
+	} {
+		if err := s.read(name, value); err != nil {
+			return nil, err
+		}
+	}
+	s.usernames = kaitenUsernames(s.users)
+	return s, nil
+}
+
+func (s *snapshotSource) read(name string, value any) error {
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot file: %w", err)
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("failed to parse snapshot file %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *snapshotSource) URL() string {
+	return s.manifest.SourceURL
+}
+
+func (s *snapshotSource) Users() ([]KaitenUser, error) {
+	return s.users, nil
+}
+
+func (s *snapshotSource) Tags() (map[float64]KaitenTag, error) {
+	tags := make(map[float64]KaitenTag, len(s.tags))
+	for _, tag := range s.tags {
+		tags[tag.Id] = tag
+	}
+	return tags, nil
+}
+
+func (s *snapshotSource) CustomProperties() (map[string]KaitenCustomProperty, error) {
+	return s.properties, nil
+}
+
+func (s *snapshotSource) Spaces() (map[string]KaitenSpace, error) {
+	return s.spaces, nil
+}
+
+func (s *snapshotSource) space(space KaitenSpace) (snapshotSpace, error) {
+	var snapshot snapshotSpace
+	err := s.read(filepath.Join("spaces", space.UID+".json"), &snapshot)
+	return snapshot, err
+}
+
+func (s *snapshotSource) board(board KaitenBoard) (snapshotBoard, error) {
+	var snapshot snapshotBoard
+	err := s.read(filepath.Join("boards", formatKaitenID(board.ID)+".json"), &snapshot)
+	return snapshot, err
+}
+
+func (s *snapshotSource) card(cardId float64) (snapshotCard, error) {
+	var snapshot snapshotCard
+	err := s.read(filepath.Join("cards", formatKaitenID(cardId)+".json"), &snapshot)
+	return snapshot, err
+}
+
+func (s *snapshotSource) Boards(space KaitenSpace) ([]KaitenBoard, error) {
+	snapshot, err := s.space(space)
+	return snapshot.Boards, err
+}
+
+func (s *snapshotSource) Columns(board KaitenBoard) ([]KaitenColumn, error) {
+	snapshot, err := s.board(board)
+	return snapshot.Columns, err
+}
+
+func (s *snapshotSource) Lanes(board KaitenBoard) ([]KaitenLane, error) {
+	snapshot, err := s.board(board)
+	return snapshot.Lanes, err
+}
+
+func (s *snapshotSource) Cards(column KaitenColumn) ([]KaitenCard, error) {
+	var cards []KaitenCard
+	err := s.read(filepath.Join("columns", formatKaitenID(column.Id)+".json"), &cards)
+	for i := range cards {
+		cards[i].Description = s.markdown(cards[i].Description)
+	}
+	return cards, err
+}
+
+func (s *snapshotSource) Comments(cardId float64) ([]KaitenComment, error) {
+	snapshot, err := s.card(cardId)
+	for i := range snapshot.Comments {
+		snapshot.Comments[i].Text = s.markdown(snapshot.Comments[i].Text)
+	}
+	return snapshot.Comments, err
+}
+
+// markdown converts the Kaiten HTML of format 1 snapshots.
+func (s *snapshotSource) markdown(text string) string {
+	if s.manifest.Format != 1 {
+		return text
+	}
+	return kaitenMarkdown(text, s.usernames)
+}
+
+func (s *snapshotSource) Attachments(cardId float64) ([]KaitenAttachment, error) {
+	snapshot, err := s.card(cardId)
+	return snapshot.Attachments, err
+}
+
+func (s *snapshotSource) Checklist(cardId float64, checklistId float64) (KaitenChecklist, error) {
+	snapshot, err := s.card(cardId)
+	if err != nil {
+		return KaitenChecklist{}, err
+	}
+	checklist, ok := snapshot.Checklists[formatKaitenID(checklistId)]
+	if !ok {
+		return KaitenChecklist{}, fmt.Errorf("checklist %s is not in the snapshot", formatKaitenID(checklistId))
+	}
+	return checklist, nil
+}
+
+func (s *snapshotSource) Subscribers(cardId float64) ([]string, error) {
+	snapshot, err := s.card(cardId)
+	return snapshot.Subscribers, err
+}
+
+func (s *snapshotSource) TimeLogs(cardId float64) ([]KaitenTimeLog, error) {
+	snapshot, err := s.card(cardId)
+	return snapshot.TimeLogs, err
+}
+
+func (s *snapshotSource) SpaceAccess(space KaitenSpace) ([]KaitenAccess, error) {
+	snapshot, err := s.space(space)
+	return snapshot.Access, err
+}
+
+// BoardAccess fails for boards without an access list of their own, so that
+// they inherit the access of their space.
+func (s *snapshotSource) BoardAccess(board KaitenBoard) ([]KaitenAccess, error) {
+	snapshot, err := s.board(board)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.AccessInherited {
+		return nil, fmt.Errorf("board %s inherits the access of its space", board.Title)
+	}
+	return snapshot.Access, nil
+}
+
+func (s *snapshotSource) GroupUsers(groupUID string) ([]float64, error) {
+	users, ok := s.groups[groupUID]
+	if !ok {
+		return nil, fmt.Errorf("group %s is not in the snapshot", groupUID)
+	}
+	return users, nil
+}
+
+func (s *snapshotSource) IsFileURL(fileURL string) bool {
+	_, ok := s.files[fileURL]
+	return ok
+}
+
+func (s *snapshotSource) OpenFile(fileURL string) (SourceFile, error) {
+	file, ok := s.files[fileURL]
+	if !ok {
+		return SourceFile{}, fmt.Errorf("file %s is not in the snapshot", fileURL)
+	}
+	content, err := os.Open(filepath.Join(s.dir, filepath.FromSlash(file.Path)))
+	if err != nil {
+		return SourceFile{}, fmt.Errorf("failed to open snapshot file: %w", err)
+	}
+	return SourceFile{Body: content, Size: file.Size, ContentType: file.MimeType}, nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExportSnapshotStoresFilesByHash(t *testing.T) {
+	dir := t.TempDir()
+	if err := exportSnapshot(testSource(), dir); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "files"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("hello"))
+	if len(entries) != 1 || entries[0].Name() != hex.EncodeToString(sum[:]) {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Fatalf("files = %v, want only the hash of notes.txt", names)
+	}
+
+	source, err := newSnapshotSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := source.OpenFile("https://kaiten.example/files/notes.txt")
+	if err != nil {
+		t.Fatalf("snapshot has no notes.txt: %v", err)
+	}
+	defer file.Body.Close()
+	if file.Size != 5 {
+		t.Errorf("notes.txt size = %d, want 5", file.Size)
+	}
+}
+
+// writeSnapshot writes a minimal snapshot of the given format with the
+// given extra files.
+func writeSnapshot(t *testing.T, format int, files map[string]any) string {
+	t.Helper()
+	dir := t.TempDir()
+	all := map[string]any{
+		"manifest.json":   snapshotManifest{Format: format, SourceURL: "https://kaiten.example"},
+		"users.json":      []KaitenUser{{ID: 1, Email: "ann@example.com", Username: "ann"}},
+		"tags.json":       []KaitenTag{{Id: 5, Name: "bug"}},
+		"properties.json": map[string]KaitenCustomProperty{},
+		"spaces.json":     map[string]KaitenSpace{"s1": {ID: 1, Name: "Alpha", UID: "s1"}},
+		"groups.json":     map[string][]float64{"g1": {1}},
+		"files.json":      map[string]snapshotFile{},
+	}
+	for name, value := range files {
+		all[name] = value
+	}
+	for name, value := range all {
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestSnapshotSourceFormats(t *testing.T) {
+	card := map[string]any{
+		"columns/100.json": []KaitenCard{{ID: 1000, Title: "First", Description: "<p><strong>Срочно</strong></p>"}},
+		"cards/1000.json":  snapshotCard{Comments: []KaitenComment{{ID: 1, Text: "<p>Спасибо, @ann</p>"}}},
+	}
+	for _, test := range []struct {
+		format      int
+		description string
+		comment     string
+		err         bool
+	}{
+		{1, "**Срочно**", "Спасибо, @ann", false},
+		{snapshotFormat, "<p><strong>Срочно</strong></p>", "<p>Спасибо, @ann</p>", false},
+		{snapshotFormat + 1, "", "", true},
+	} {
+		source, err := newSnapshotSource(writeSnapshot(t, test.format, card))
+		if test.err {
+			if err == nil {
+				t.Errorf("format %d was accepted", test.format)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("format %d: %v", test.format, err)
+		}
+
+		cards, err := source.Cards(KaitenColumn{Id: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cards) != 1 || cards[0].Description != test.description {
+			t.Errorf("format %d: cards = %+v, want description %q", test.format, cards, test.description)
+		}
+		comments, err := source.Comments(1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(comments) != 1 || comments[0].Text != test.comment {
+			t.Errorf("format %d: comments = %+v, want %q", test.format, comments, test.comment)
+		}
+	}
+}
+
+func TestSnapshotSourceLookups(t *testing.T) {
+	source, err := newSnapshotSource(writeSnapshot(t, snapshotFormat, map[string]any{
+		"boards/10.json": snapshotBoard{Access: []KaitenAccess{{UserID: 1, Role: kaitenAccessWriter}}},
+		"boards/11.json": snapshotBoard{AccessInherited: true},
+		"cards/1000.json": snapshotCard{Checklists: map[string]KaitenChecklist{
+			"7": {Name: "Шаги", Items: []KaitenChecklistItem{{Text: "Первый", Checked: true}}},
+		}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name   string
+		lookup func() (any, error)
+		want   any
+	}{
+		{"own board access", func() (any, error) { return source.BoardAccess(KaitenBoard{ID: 10}) }, []KaitenAccess{{UserID: 1, Role: kaitenAccessWriter}}},
+		{"inherited board access", func() (any, error) { return source.BoardAccess(KaitenBoard{ID: 11, Title: "Side"}) }, nil},
+		{"missing board", func() (any, error) { return source.BoardAccess(KaitenBoard{ID: 12}) }, nil},
+		{"checklist", func() (any, error) { return source.Checklist(1000, 7) }, KaitenChecklist{Name: "Шаги", Items: []KaitenChecklistItem{{Text: "Первый", Checked: true}}}},
+		{"missing checklist", func() (any, error) { return source.Checklist(1000, 8) }, nil},
+		{"group", func() (any, error) { return source.GroupUsers("g1") }, []float64{1}},
+		{"missing group", func() (any, error) { return source.GroupUsers("g2") }, nil},
+		{"tags", func() (any, error) { return source.Tags() }, map[float64]KaitenTag{5: {Id: 5, Name: "bug"}}},
+	} {
+		value, err := test.lookup()
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("%s: got %v, want an error", test.name, value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if !reflect.DeepEqual(value, test.want) {
+			t.Errorf("%s = %+v, want %+v", test.name, value, test.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"sync"
+)
+
+// Source yields the tracker data to migrate. Models are Kaiten-shaped, so
+// other trackers convert their data into the Kaiten types. Card descriptions
+// and comments are Markdown.
+type Source interface {
+	// URL is the base URL that links to the source's cards start with, or ""
+	// when the source has none.
+	URL() string
+
+	Users() ([]KaitenUser, error)
+	Tags() (map[float64]KaitenTag, error)
+	CustomProperties() (map[string]KaitenCustomProperty, error)
+
+	Spaces() (map[string]KaitenSpace, error)
+	Boards(space KaitenSpace) ([]KaitenBoard, error)
+	Columns(board KaitenBoard) ([]KaitenColumn, error)
+	Cards(column KaitenColumn) ([]KaitenCard, error)
+
+	Comments(cardId float64) ([]KaitenComment, error)
+	Attachments(cardId float64) ([]KaitenAttachment, error)
+	Checklist(cardId float64, checklistId float64) (KaitenChecklist, error)
+	Subscribers(cardId float64) ([]string, error)
+	TimeLogs(cardId float64) ([]KaitenTimeLog, error)
+
+	SpaceAccess(space KaitenSpace) ([]KaitenAccess, error)
+	BoardAccess(board KaitenBoard) ([]KaitenAccess, error)
+	GroupUsers(groupUID string) ([]float64, error)
+
+	// IsFileURL reports whether a link in card text points at a file stored
+	// by the source, which the migration then re-hosts.
+	IsFileURL(fileURL string) bool
+	// OpenFile downloads an attachment or an inline image.
+	OpenFile(fileURL string) (SourceFile, error)
+}
+
+// SourceFile is an open file download. Size is -1 when unknown.
+type SourceFile struct {
+	Body        io.ReadCloser
+	Size        int64
+	ContentType string
+}
+
+// syntheticID derives a stable Kaiten-style ID for an object of a source
+// whose IDs are not numbers that fit a float64 exactly. It is an FNV-1a hash
+// cut to the 53 bits a float64 holds.
+func syntheticID(key string) float64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+	return float64(hash.Sum64() & (1<<53 - 1))
+}
+
+// laneSource is implemented by sources whose boards have swimlanes. The
+// migration has no use for them, the snapshot export keeps them.
+type laneSource interface {
+	Lanes(board KaitenBoard) ([]KaitenLane, error)
+}
+
+// kaitenSource reads a live Kaiten account through its REST API and converts
+// the HTML of descriptions and comments to Markdown.
+type kaitenSource struct {
+	usernamesOnce sync.Once
+	usernames     map[string]string
+}
+
+func newKaitenSource() (*kaitenSource, error) {
+	if err := initKaitenEnv(); err != nil {
+		return nil, fmt.Errorf("cannot get variable values for Kaiten API: %w", err)
+	}
+	return &kaitenSource{}, nil
+}
+
+func (s *kaitenSource) URL() string {
+	return kaitenURL
+}
+
+func (s *kaitenSource) Users() ([]KaitenUser, error) {
+	return getKaitenUserList()
+}
+
+func (s *kaitenSource) Tags() (map[float64]KaitenTag, error) {
+	return getKaitenTags()
+}
+
+func (s *kaitenSource) CustomProperties() (map[string]KaitenCustomProperty, error) {
+	return getKaitenCustomProperties()
+}
+
+func (s *kaitenSource) Spaces() (map[string]KaitenSpace, error) {
+	return getKaitenSpaces()
+}
+
+func (s *kaitenSource) Boards(space KaitenSpace) ([]KaitenBoard, error) {
+	return getKaitenBoardsForSpace(space)
+}
+
+func (s *kaitenSource) Columns(board KaitenBoard) ([]KaitenColumn, error) {
+	return getKaitenColumnsForBoard(board.ID)
+}
+
+func (s *kaitenSource) Lanes(board KaitenBoard) ([]KaitenLane, error) {
+	return getKaitenLanesForBoard(board.ID)
+}
+
+func (s *kaitenSource) Cards(column KaitenColumn) ([]KaitenCard, error) {
+	cards, err := getKaitenCardsForColumn(column.Id)
+	for i := range cards {
+		cards[i].Description = s.markdown(cards[i].Description)
+	}
+	return cards, err
+}
+
+func (s *kaitenSource) Comments(cardId float64) ([]KaitenComment, error) {
+	comments, err := getKaitenCommentsForCard(cardId)
+	for i := range comments {
+		comments[i].Text = s.markdown(comments[i].Text)
+	}
+	return comments, err
+}
+
+// markdown converts Kaiten text, resolving mention spans through the users
+// of the account.
+func (s *kaitenSource) markdown(text string) string {
+	s.usernamesOnce.Do(func() {
+		users, err := getKaitenUserList()
+		if err != nil {
+			log.Printf("Error getting Kaiten users for mentions: %v", err)
+			return
+		}
+		s.usernames = kaitenUsernames(users)
+	})
+	return kaitenMarkdown(text, s.usernames)
+}
+
+func (s *kaitenSource) Attachments(cardId float64) ([]KaitenAttachment, error) {
+	return getKaitenAttachmentsForCard(cardId)
+}
+
+func (s *kaitenSource) Checklist(cardId float64, checklistId float64) (KaitenChecklist, error) {
+	return getKaitenChecklistsForCard(cardId, checklistId)
+}
+
+func (s *kaitenSource) Subscribers(cardId float64) ([]string, error) {
+	return getKaitenSubscribersForCard(cardId)
+}
+
+func (s *kaitenSource) TimeLogs(cardId float64) ([]KaitenTimeLog, error) {
+	return getKaitenTimeLogsForCard(cardId)
+}
+
+func (s *kaitenSource) SpaceAccess(space KaitenSpace) ([]KaitenAccess, error) {
+	return getKaitenSpaceAccess(space.ID)
+}
+
+func (s *kaitenSource) BoardAccess(board KaitenBoard) ([]KaitenAccess, error) {
+	return getKaitenBoardAccess(board.ID)
+}
+
+func (s *kaitenSource) GroupUsers(groupUID string) ([]float64, error) {
+	return getKaitenGroupUsers(groupUID)
+}
+
+func (s *kaitenSource) IsFileURL(fileURL string) bool {
+	return isKaitenFileURL(fileURL)
+}
+
+func (s *kaitenSource) OpenFile(fileURL string) (SourceFile, error) {
+	resp, err := kaitenDownload(context.Background(), fileURL)
+	if err != nil {
+		return SourceFile{}, err
+	}
+	return SourceFile{Body: resp.Body, Size: resp.ContentLength, ContentType: resp.Header.Get("Content-Type")}, nil
+}
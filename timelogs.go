@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	sizeFieldKey = "size"
+	timeFieldKey = "time"
+)
+
+type userTime struct {
+	name    string
+	minutes float64
+}
+
+// processCardTimeLogs puts the card's total logged time on the PLANKA
+// stopwatch and into the "Время" custom field, and the per-user totals with
+// the full per-entry breakdown into an admin comment.
+func (m *migration) processCardTimeLogs(cardId string, boardId string, timeLogs []KaitenTimeLog) {
+	if len(timeLogs) == 0 {
+		return
+	}
+
+	var total float64
+	perUser := make(map[float64]*userTime)
+	var userIds []float64
+	for _, timeLog := range timeLogs {
+		total += timeLog.Minutes
+		spent, exists := perUser[timeLog.UserID]
+		if !exists {
+			spent = &userTime{name: timeLogUserName(timeLog, m.usersByID)}
+			perUser[timeLog.UserID] = spent
+			userIds = append(userIds, timeLog.UserID)
+		}
+		spent.minutes += timeLog.Minutes
+	}
+
+	stopwatch := map[string]any{"startedAt": nil, "total": int64(total * 60)}
+	if err := m.sink.UpdateCard(cardId, map[string]any{"stopwatch": stopwatch}); err != nil {
+		log.Printf("Error setting stopwatch for card %s: %v", cardId, err)
+	}
+
+	if m.cardFields != nil {
+		groupId, fieldId, err := m.cardFields.field(boardId, timeFieldKey, "Время")
+		if err == nil {
+			err = m.sink.SetCustomFieldValue(cardId, groupId, fieldId, formatMinutes(total))
+		}
+		if err != nil {
+			log.Printf("Error setting time custom field for card %s: %v", cardId, err)
+		}
+	}
+
+	var totals []string
+	for _, userId := range userIds {
+		spent := perUser[userId]
+		totals = append(totals, "- "+spent.name+": "+formatMinutes(spent.minutes))
+	}
+
+	sort.SliceStable(timeLogs, func(i, j int) bool { return timeLogs[i].ForDate < timeLogs[j].ForDate })
+
+	var text strings.Builder
+	text.WriteString("## Учёт времени\n\n")
+	text.WriteString("Всего: " + formatMinutes(total) + "\n\n")
+	text.WriteString(strings.Join(totals, "\n") + "\n\n")
+	text.WriteString("| Дата | Сотрудник | Время | Комментарий |\n|---|---|---|---|\n")
+	for _, timeLog := range timeLogs {
+		fmt.Fprintf(&text, "| %s | %s | %s | %s |\n", timeLog.ForDate, timeLogUserName(timeLog, m.usersByID), formatMinutes(timeLog.Minutes), strings.ReplaceAll(timeLog.Comment, "\n", " "))
+	}
+	if _, err := m.sink.CreateComment(cardId, KaitenComment{Text: text.String()}); err != nil {
+		log.Printf("Error creating time log comment for card %s: %v", cardId, err)
+	}
+}
+
+// processCardSize stores the card size in a custom field, or as a
+// "Размер: N" label when custom fields are off.
+func (m *migration) processCardSize(card KaitenCard, cardId string, boardId string) {
+	size := card.SizeText
+	if size == "" && card.Size != 0 {
+		size = strconv.FormatFloat(card.Size, 'f', -1, 64)
+	}
+	if size == "" {
+		return
+	}
+
+	if m.cardFields != nil {
+		groupId, fieldId, err := m.cardFields.field(boardId, sizeFieldKey, "Размер")
+		if err == nil {
+			err = m.sink.SetCustomFieldValue(cardId, groupId, fieldId, size)
+		}
+		if err != nil {
+			log.Printf("Error setting size for card %s: %v", cardId, err)
+		}
+		return
+	}
+
+	name := "Размер: " + size
+	label, err := m.labels.ensure(boardId, labelKindSize, PlankaLabel{Name: name, Color: "light-concrete"})
+	if err != nil {
+		log.Printf("Error creating size label for board %s: %v", boardId, err)
+		return
+	}
+	if err := m.sink.AddCardLabel(cardId, label.Id); err != nil {
+		log.Printf("Error setting size label for card %s: %v", cardId, err)
+	}
+}
+
+func timeLogUserName(timeLog KaitenTimeLog, users map[float64]KaitenUser) string {
+	if timeLog.UserName != "" {
+		return timeLog.UserName
+	}
+	if user, ok := users[timeLog.UserID]; ok {
+		if user.FullName != "" {
+			return user.FullName
+		}
+		return user.Email
+	}
+	return timeLog.UserEmail
+}
+
+func formatMinutes(minutes float64) string {
+	total := int64(minutes)
+	if total < 60 {
+		return fmt.Sprintf("%dм", total)
+	}
+	if total%60 == 0 {
+		return fmt.Sprintf("%dч", total/60)
+	}
+	return fmt.Sprintf("%dч %dм", total/60, total%60)
+}
@@ -0,0 +1,502 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultTrelloProject     = "Trello"
+	defaultTrelloEmailDomain = "trello.local"
+	trelloRootUID            = "trello"
+)
+
+// trelloBoard is the part of Trello's board JSON export the migration reads.
+type trelloBoard struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Labels []struct {
+		ID    string `json:"id"`
+		Name  string `json:"name"`
+		Color string `json:"color"`
+	} `json:"labels"`
+	Lists []struct {
+		ID     string  `json:"id"`
+		Name   string  `json:"name"`
+		Closed bool    `json:"closed"`
+		Pos    float64 `json:"pos"`
+	} `json:"lists"`
+	Cards      []trelloCard      `json:"cards"`
+	Checklists []trelloChecklist `json:"checklists"`
+	Members    []trelloMember    `json:"members"`
+	// Memberships have memberType "admin", "normal" or "observer".
+	Memberships []struct {
+		IDMember   string `json:"idMember"`
+		MemberType string `json:"memberType"`
+	} `json:"memberships"`
+	Actions []struct {
+		ID              string `json:"id"`
+		Type            string `json:"type"`
+		Date            string `json:"date"`
+		IDMemberCreator string `json:"idMemberCreator"`
+		Data            struct {
+			Text string `json:"text"`
+			Card struct {
+				ID string `json:"id"`
+			} `json:"card"`
+		} `json:"data"`
+	} `json:"actions"`
+}
+
+type trelloCard struct {
+	ID                string   `json:"id"`
+	Name              string   `json:"name"`
+	Desc              string   `json:"desc"`
+	Closed            bool     `json:"closed"`
+	IDList            string   `json:"idList"`
+	Pos               float64  `json:"pos"`
+	Due               string   `json:"due"`
+	Start             string   `json:"start"`
+	IDLabels          []string `json:"idLabels"`
+	IDMembers         []string `json:"idMembers"`
+	IDChecklists      []string `json:"idChecklists"`
+	IDAttachmentCover string   `json:"idAttachmentCover"`
+	Attachments       []struct {
+		ID       string  `json:"id"`
+		Name     string  `json:"name"`
+		URL      string  `json:"url"`
+		Bytes    float64 `json:"bytes"`
+		MimeType string  `json:"mimeType"`
+		Date     string  `json:"date"`
+		IDMember string  `json:"idMember"`
+		IsUpload bool    `json:"isUpload"`
+	} `json:"attachments"`
+}
+
+type trelloChecklist struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	IDCard     string  `json:"idCard"`
+	Pos        float64 `json:"pos"`
+	CheckItems []struct {
+		Name  string  `json:"name"`
+		State string  `json:"state"`
+		Pos   float64 `json:"pos"`
+	} `json:"checkItems"`
+}
+
+type trelloMember struct {
+	ID       string `json:"id"`
+	FullName string `json:"fullName"`
+	Username string `json:"username"`
+}
+
+// trelloColors are the hex values of Trello's label colours, which pick the
+// nearest PLANKA colour.
+var trelloColors = map[string]string{
+	"green":  "#61bd4f",
+	"yellow": "#f2d600",
+	"orange": "#ff9f1a",
+	"red":    "#eb5a46",
+	"purple": "#c377e0",
+	"blue":   "#0079bf",
+	"sky":    "#00c2e0",
+	"lime":   "#51e898",
+	"pink":   "#ff78cb",
+	"black":  "#344563",
+}
+
+// trelloSource reads Trello board JSON exports. All boards go to one
+// project: every board becomes a subspace of a root space named after
+// TRELLO_PROJECT. Trello IDs become syntheticIDs.
+type trelloSource struct {
+	project string
+	key     string
+	token   string
+	boards  map[string]*trelloBoard
+	emails  map[string]string
+
+	boardsByID map[float64]*trelloBoard
+	cards      map[float64]trelloCard
+	checklists map[float64]trelloChecklist
+	cardBoards map[float64]*trelloBoard
+}
+
+// newTrelloSource loads the board exports at paths, each a JSON file or a
+// directory of them.
+func newTrelloSource(paths []string) (*trelloSource, error) {
+	s := &trelloSource{
+		project:    getEnvDefault("TRELLO_PROJECT", defaultTrelloProject),
+		key:        getEnvDefault("TRELLO_KEY", ""),
+		token:      getEnvDefault("TRELLO_TOKEN", ""),
+		boards:     make(map[string]*trelloBoard),
+		boardsByID: make(map[float64]*trelloBoard),
+		cards:      make(map[float64]trelloCard),
+		checklists: make(map[float64]trelloChecklist),
+		cardBoards: make(map[float64]*trelloBoard),
+	}
+	emails, err := parseTrelloMemberEmails(getEnvDefault("TRELLO_MEMBER_EMAILS", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TRELLO_MEMBER_EMAILS: %w", err)
+	}
+	s.emails = emails
+
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open Trello export: %w", err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no Trello board exports given")
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Trello export: %w", err)
+		}
+		board := &trelloBoard{}
+		if err := json.Unmarshal(data, board); err != nil {
+			return nil, fmt.Errorf("failed to parse Trello export %s: %w", file, err)
+		}
+		if board.ID == "" {
+			return nil, fmt.Errorf("%s is not a Trello board export", file)
+		}
+		s.add(board)
+	}
+	return s, nil
+}
+
+func (s *trelloSource) add(board *trelloBoard) {
+	s.boards[board.ID] = board
+	s.boardsByID[syntheticID(board.ID)] = board
+	for _, card := range board.Cards {
+		s.cards[syntheticID(card.ID)] = card
+		s.cardBoards[syntheticID(card.ID)] = board
+	}
+	for _, checklist := range board.Checklists {
+		s.checklists[syntheticID(checklist.ID)] = checklist
+	}
+	for _, member := range board.Members {
+		if _, ok := s.emails[member.Username]; !ok {
+			s.emails[member.Username] = member.Username + "@" + defaultTrelloEmailDomain
+		}
+	}
+}
+
+// parseTrelloMemberEmails parses e-mails of Trello members like
+// "jdoe=john.doe@example.com,...". The export has no e-mails, members not
+// listed get username@trello.local.
+func parseTrelloMemberEmails(spec string) (map[string]string, error) {
+	emails := make(map[string]string)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		username, email, found := strings.Cut(entry, "=")
+		if !found || !strings.Contains(email, "@") {
+			return nil, fmt.Errorf("member e-mail %q is not username=email", entry)
+		}
+		emails[strings.TrimSpace(username)] = strings.TrimSpace(email)
+	}
+	return emails, nil
+}
+
+// member returns the e-mail of the Trello member with the given ID.
+func (s *trelloSource) member(memberId string) string {
+	for _, board := range s.boards {
+		for _, member := range board.Members {
+			if member.ID == memberId {
+				return s.emails[member.Username]
+			}
+		}
+	}
+	return ""
+}
+
+// URL is empty: Trello links use short links, not the card IDs.
+func (s *trelloSource) URL() string {
+	return ""
+}
+
+func (s *trelloSource) Users() ([]KaitenUser, error) {
+	seen := make(map[string]bool)
+	var users []KaitenUser
+	for _, board := range s.boards {
+		for _, member := range board.Members {
+			if seen[member.ID] {
+				continue
+			}
+			seen[member.ID] = true
+			users = append(users, KaitenUser{
+				ID:          syntheticID(member.ID),
+				Email:       s.emails[member.Username],
+				FullName:    member.FullName,
+				Username:    member.Username,
+				CompanyRole: kaitenCompanyRoleUser,
+			})
+		}
+	}
+	return users, nil
+}
+
+// Tags are the board labels. Labels without a name are named after their
+// colour, the way Trello shows them.
+func (s *trelloSource) Tags() (map[float64]KaitenTag, error) {
+	tags := make(map[float64]KaitenTag)
+	for _, board := range s.boards {
+		for _, label := range board.Labels {
+			color, _, _ := strings.Cut(label.Color, "_")
+			name := label.Name
+			if name == "" {
+				name = color
+			}
+			tags[syntheticID(label.ID)] = KaitenTag{Id: syntheticID(label.ID), Name: name, ColorHex: trelloColors[color]}
+		}
+	}
+	return tags, nil
+}
+
+func (s *trelloSource) CustomProperties() (map[string]KaitenCustomProperty, error) {
+	return map[string]KaitenCustomProperty{}, nil
+}
+
+func (s *trelloSource) Spaces() (map[string]KaitenSpace, error) {
+	root := KaitenSpace{ID: syntheticID(trelloRootUID), Name: s.project, UID: trelloRootUID}
+	spaces := make(map[string]KaitenSpace, len(s.boards)+1)
+	for _, board := range s.boards {
+		spaces[board.ID] = KaitenSpace{ID: syntheticID(board.ID), Name: board.Name, ParentID: trelloRootUID, UID: board.ID}
+		root.ChildIdDs = append(root.ChildIdDs, board.ID)
+	}
+	spaces[trelloRootUID] = root
+	return spaces, nil
+}
+
+func (s *trelloSource) Boards(space KaitenSpace) ([]KaitenBoard, error) {
+	board, ok := s.boards[space.UID]
+	if !ok {
+		return nil, nil
+	}
+	return []KaitenBoard{{ID: syntheticID(board.ID), Title: board.Name}}, nil
+}
+
+// Columns are the open lists.
+func (s *trelloSource) Columns(board KaitenBoard) ([]KaitenColumn, error) {
+	trello, ok := s.boardsByID[board.ID]
+	if !ok {
+		return nil, fmt.Errorf("board %s is not in the export", board.Title)
+	}
+	var columns []KaitenColumn
+	for _, list := range trello.Lists {
+		if list.Closed {
+			continue
+		}
+		columns = append(columns, KaitenColumn{Position: list.Pos, Name: list.Name, Id: syntheticID(list.ID), BoardID: board.ID})
+	}
+	sort.SliceStable(columns, func(i, j int) bool { return columns[i].Position < columns[j].Position })
+	return columns, nil
+}
+
+func (s *trelloSource) Cards(column KaitenColumn) ([]KaitenCard, error) {
+	board, ok := s.boardsByID[column.BoardID]
+	if !ok {
+		return nil, fmt.Errorf("board of column %s is not in the export", column.Name)
+	}
+	var cards []KaitenCard
+	for _, trello := range board.Cards {
+		if syntheticID(trello.IDList) != column.Id {
+			continue
+		}
+		card := KaitenCard{
+			ID:          syntheticID(trello.ID),
+			BoardID:     column.BoardID,
+			Title:       trello.Name,
+			Description: trello.Desc + trelloLinks(trello),
+			SortOrder:   trello.Pos,
+			DueDate:     trello.Due,
+			StartDate:   trello.Start,
+			Archived:    trello.Closed,
+		}
+		for _, labelId := range trello.IDLabels {
+			card.TagIds = append(card.TagIds, syntheticID(labelId))
+		}
+		for _, memberId := range trello.IDMembers {
+			if email := s.member(memberId); email != "" {
+				card.Members = append(card.Members, KaitenCardMember{Email: email, Type: kaitenMemberTypeMember})
+			}
+		}
+		var checklists []trelloChecklist
+		for _, checklistId := range trello.IDChecklists {
+			if checklist, ok := s.checklists[syntheticID(checklistId)]; ok {
+				checklists = append(checklists, checklist)
+			}
+		}
+		sort.SliceStable(checklists, func(i, j int) bool { return checklists[i].Pos < checklists[j].Pos })
+		for _, checklist := range checklists {
+			card.Checklists = append(card.Checklists, syntheticID(checklist.ID))
+		}
+		cards = append(cards, card)
+	}
+	sort.SliceStable(cards, func(i, j int) bool { return cards[i].SortOrder < cards[j].SortOrder })
+	return cards, nil
+}
+
+// trelloLinks lists the card's link attachments, which have no file to
+// upload, at the end of the description.
+func trelloLinks(card trelloCard) string {
+	var links strings.Builder
+	for _, attachment := range card.Attachments {
+		if attachment.IsUpload {
+			continue
+		}
+		if links.Len() == 0 {
+			links.WriteString("\n\n")
+		}
+		links.WriteString("- [" + attachment.Name + "](" + attachment.URL + ")\n")
+	}
+	return links.String()
+}
+
+// Comments are the board's commentCard actions, oldest first. Trello
+// exports at most the last 1000 actions of a board, older comments are
+// missing from the export.
+func (s *trelloSource) Comments(cardId float64) ([]KaitenComment, error) {
+	board, ok := s.cardBoards[cardId]
+	if !ok {
+		return nil, fmt.Errorf("card %s is not in the export", formatKaitenID(cardId))
+	}
+	var comments []KaitenComment
+	for _, action := range board.Actions {
+		if action.Type != "commentCard" || syntheticID(action.Data.Card.ID) != cardId {
+			continue
+		}
+		comments = append(comments, KaitenComment{
+			ID:          syntheticID(action.ID),
+			AuthorEmail: s.member(action.IDMemberCreator),
+			CreatedAt:   action.Date,
+			Text:        action.Data.Text,
+		})
+	}
+	sort.SliceStable(comments, func(i, j int) bool { return comments[i].CreatedAt < comments[j].CreatedAt })
+	return comments, nil
+}
+
+// Attachments are the uploaded files of the card.
+func (s *trelloSource) Attachments(cardId float64) ([]KaitenAttachment, error) {
+	card, ok := s.cards[cardId]
+	if !ok {
+		return nil, fmt.Errorf("card %s is not in the export", formatKaitenID(cardId))
+	}
+	var attachments []KaitenAttachment
+	for _, attachment := range card.Attachments {
+		if !attachment.IsUpload {
+			continue
+		}
+		attachments = append(attachments, KaitenAttachment{
+			ID:          syntheticID(attachment.ID),
+			Name:        attachment.Name,
+			URL:         attachment.URL,
+			Size:        attachment.Bytes,
+			MimeType:    attachment.MimeType,
+			CreatedAt:   attachment.Date,
+			AuthorEmail: s.member(attachment.IDMember),
+			Cover:       attachment.ID == card.IDAttachmentCover,
+		})
+	}
+	return attachments, nil
+}
+
+func (s *trelloSource) Checklist(cardId float64, checklistId float64) (KaitenChecklist, error) {
+	trello, ok := s.checklists[checklistId]
+	if !ok {
+		return KaitenChecklist{}, fmt.Errorf("checklist %s is not in the export", formatKaitenID(checklistId))
+	}
+	items := append(trello.CheckItems[:0:0], trello.CheckItems...)
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Pos < items[j].Pos })
+
+	checklist := KaitenChecklist{Name: trello.Name}
+	for _, item := range items {
+		checklist.Items = append(checklist.Items, KaitenChecklistItem{Text: item.Name, Checked: item.State == "complete"})
+	}
+	return checklist, nil
+}
+
+func (s *trelloSource) Subscribers(cardId float64) ([]string, error) {
+	return nil, nil
+}
+
+func (s *trelloSource) TimeLogs(cardId float64) ([]KaitenTimeLog, error) {
+	return nil, nil
+}
+
+// SpaceAccess gives board admins ownership, normal members write access and
+// observers read access to the board's space.
+func (s *trelloSource) SpaceAccess(space KaitenSpace) ([]KaitenAccess, error) {
+	board, ok := s.boards[space.UID]
+	if !ok {
+		return nil, nil
+	}
+	var access []KaitenAccess
+	for _, membership := range board.Memberships {
+		role := kaitenAccessWriter
+		switch membership.MemberType {
+		case "admin":
+			role = kaitenAccessOwner
+		case "observer":
+			role = kaitenAccessReader
+		}
+		access = append(access, KaitenAccess{UserID: syntheticID(membership.IDMember), Email: s.member(membership.IDMember), Role: role})
+	}
+	return access, nil
+}
+
+// BoardAccess fails, so that boards get the access of their space.
+func (s *trelloSource) BoardAccess(board KaitenBoard) ([]KaitenAccess, error) {
+	return nil, fmt.Errorf("board %s inherits the access of its space", board.Title)
+}
+
+func (s *trelloSource) GroupUsers(groupUID string) ([]float64, error) {
+	return nil, fmt.Errorf("Trello exports have no user groups")
+}
+
+func (s *trelloSource) IsFileURL(fileURL string) bool {
+	return strings.HasPrefix(fileURL, "https://trello.com/1/cards/")
+}
+
+// OpenFile downloads a Trello attachment. Trello only serves uploaded files
+// to API clients, authenticated with TRELLO_KEY and TRELLO_TOKEN.
+func (s *trelloSource) OpenFile(fileURL string) (SourceFile, error) {
+	req, err := http.NewRequest("GET", fileURL, nil)
+	if err != nil {
+		return SourceFile{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	if s.key != "" && s.token != "" {
+		req.Header.Set("Authorization", `OAuth oauth_consumer_key="`+s.key+`", oauth_token="`+s.token+`"`)
+	}
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return SourceFile{}, fmt.Errorf("failed to send request: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return SourceFile{}, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return SourceFile{Body: resp.Body, Size: resp.ContentLength, ContentType: resp.Header.Get("Content-Type")}, nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const trelloExport = `{
+	"id": "b1",
+	"name": "Alpha",
+	"labels": [
+		{"id": "lb1", "name": "bug", "color": "red"},
+		{"id": "lb2", "name": "", "color": "green_dark"}
+	],
+	"lists": [
+		{"id": "l2", "name": "Done", "pos": 2},
+		{"id": "l1", "name": "Todo", "pos": 1},
+		{"id": "l3", "name": "Old", "pos": 3, "closed": true}
+	],
+	"cards": [
+		{"id": "c2", "name": "Second", "idList": "l1", "pos": 20},
+		{"id": "c1", "name": "First", "desc": "Text", "idList": "l1", "pos": 10,
+		 "due": "2026-01-02T00:00:00.000Z", "start": "2026-01-01T00:00:00.000Z",
+		 "idLabels": ["lb1"], "idMembers": ["m1", "m9"], "idChecklists": ["ch2", "ch1"],
+		 "idAttachmentCover": "a1",
+		 "attachments": [
+			{"id": "a1", "name": "shot.png", "url": "https://trello.com/1/cards/c1/attachments/a1/download/shot.png",
+			 "bytes": 42, "mimeType": "image/png", "date": "2026-01-03T00:00:00.000Z", "idMember": "m2", "isUpload": true},
+			{"id": "a2", "name": "Spec", "url": "https://example.com/spec"}
+		 ]}
+	],
+	"checklists": [
+		{"id": "ch1", "name": "Steps", "idCard": "c1", "pos": 1,
+		 "checkItems": [{"name": "ship", "state": "incomplete", "pos": 2}, {"name": "plan", "state": "complete", "pos": 1}]},
+		{"id": "ch2", "name": "Review", "idCard": "c1", "pos": 2, "checkItems": []}
+	],
+	"members": [
+		{"id": "m1", "fullName": "Ann", "username": "ann"},
+		{"id": "m2", "fullName": "Bob", "username": "bob"}
+	],
+	"memberships": [
+		{"idMember": "m1", "memberType": "admin"},
+		{"idMember": "m2", "memberType": "normal"},
+		{"idMember": "m3", "memberType": "observer"}
+	],
+	"actions": [
+		{"id": "x2", "type": "commentCard", "date": "2026-01-05T00:00:00.000Z", "idMemberCreator": "m2",
+		 "data": {"text": "newer", "card": {"id": "c1"}}},
+		{"id": "x1", "type": "commentCard", "date": "2026-01-04T00:00:00.000Z", "idMemberCreator": "m1",
+		 "data": {"text": "older", "card": {"id": "c1"}}},
+		{"id": "x3", "type": "updateCard", "date": "2026-01-06T00:00:00.000Z", "idMemberCreator": "m1",
+		 "data": {"card": {"id": "c1"}}}
+	]
+}`
+
+func TestParseTrelloMemberEmails(t *testing.T) {
+	for _, tc := range []struct {
+		spec    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{spec: "", want: map[string]string{}},
+		{spec: "ann=ann@example.com", want: map[string]string{"ann": "ann@example.com"}},
+		{spec: " ann = ann@example.com , ,bob=bob@example.com", want: map[string]string{"ann": "ann@example.com", "bob": "bob@example.com"}},
+		{spec: "ann", wantErr: true},
+		{spec: "ann=not-an-email", wantErr: true},
+	} {
+		got, err := parseTrelloMemberEmails(tc.spec)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%q: error = %v, want error %v", tc.spec, err, tc.wantErr)
+			continue
+		}
+		if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %v, want %v", tc.spec, got, tc.want)
+		}
+	}
+}
+
+func TestNewTrelloSourceRejectsBadExports(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		files map[string]string
+	}{
+		{"no exports", map[string]string{}},
+		{"broken JSON", map[string]string{"board.json": "{"}},
+		{"not a board", map[string]string{"board.json": `{"name": "Alpha"}`}},
+	} {
+		dir := t.TempDir()
+		for name, content := range tc.files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := newTrelloSource([]string{dir}); err == nil {
+			t.Errorf("%s: no error", tc.name)
+		}
+	}
+}
+
+func TestTrelloSourceReadsExport(t *testing.T) {
+	t.Setenv("TRELLO_PROJECT", "Imported")
+	t.Setenv("TRELLO_MEMBER_EMAILS", "ann=ann@example.com")
+	path := filepath.Join(t.TempDir(), "alpha.json")
+	if err := os.WriteFile(path, []byte(trelloExport), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	source, err := newTrelloSource([]string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spaces, err := source.Spaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSpaces := map[string]KaitenSpace{
+		trelloRootUID: {ID: syntheticID(trelloRootUID), Name: "Imported", UID: trelloRootUID, ChildIdDs: []string{"b1"}},
+		"b1":          {ID: syntheticID("b1"), Name: "Alpha", ParentID: trelloRootUID, UID: "b1"},
+	}
+	if !reflect.DeepEqual(spaces, wantSpaces) {
+		t.Errorf("spaces = %+v, want %+v", spaces, wantSpaces)
+	}
+
+	tags, err := source.Tags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		labelId string
+		want    KaitenTag
+	}{
+		{"lb1", KaitenTag{Id: syntheticID("lb1"), Name: "bug", ColorHex: "#eb5a46"}},
+		{"lb2", KaitenTag{Id: syntheticID("lb2"), Name: "green", ColorHex: "#61bd4f"}},
+	} {
+		if got := tags[syntheticID(tc.labelId)]; got != tc.want {
+			t.Errorf("label %s: got %+v, want %+v", tc.labelId, got, tc.want)
+		}
+	}
+
+	access, err := source.SpaceAccess(spaces["b1"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantAccess := []KaitenAccess{
+		{UserID: syntheticID("m1"), Email: "ann@example.com", Role: kaitenAccessOwner},
+		{UserID: syntheticID("m2"), Email: "bob@" + defaultTrelloEmailDomain, Role: kaitenAccessWriter},
+		{UserID: syntheticID("m3"), Role: kaitenAccessReader},
+	}
+	if !reflect.DeepEqual(access, wantAccess) {
+		t.Errorf("access = %+v, want %+v", access, wantAccess)
+	}
+
+	boards, err := source.Boards(spaces["b1"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns, err := source.Columns(boards[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(columns) != 2 || columns[0].Name != "Todo" || columns[1].Name != "Done" {
+		t.Fatalf("columns = %+v, want the open lists by position", columns)
+	}
+	cards, err := source.Cards(columns[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cards) != 2 || cards[1].Title != "Second" {
+		t.Fatalf("cards = %+v, want First and Second by position", cards)
+	}
+	wantCard := KaitenCard{
+		ID:          syntheticID("c1"),
+		BoardID:     boards[0].ID,
+		Title:       "First",
+		Description: "Text\n\n- [Spec](https://example.com/spec)\n",
+		SortOrder:   10,
+		DueDate:     "2026-01-02T00:00:00.000Z",
+		StartDate:   "2026-01-01T00:00:00.000Z",
+		TagIds:      []float64{syntheticID("lb1")},
+		Members:     []KaitenCardMember{{Email: "ann@example.com", Type: kaitenMemberTypeMember}},
+		Checklists:  []float64{syntheticID("ch1"), syntheticID("ch2")},
+	}
+	if !reflect.DeepEqual(cards[0], wantCard) {
+		t.Errorf("card = %+v, want %+v", cards[0], wantCard)
+	}
+
+	checklist, err := source.Checklist(wantCard.ID, syntheticID("ch1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantChecklist := KaitenChecklist{Name: "Steps", Items: []KaitenChecklistItem{{Text: "plan", Checked: true}, {Text: "ship"}}}
+	if !reflect.DeepEqual(checklist, wantChecklist) {
+		t.Errorf("checklist = %+v, want %+v", checklist, wantChecklist)
+	}
+
+	comments, err := source.Comments(wantCard.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantComments := []KaitenComment{
+		{ID: syntheticID("x1"), AuthorEmail: "ann@example.com", CreatedAt: "2026-01-04T00:00:00.000Z", Text: "older"},
+		{ID: syntheticID("x2"), AuthorEmail: "bob@" + defaultTrelloEmailDomain, CreatedAt: "2026-01-05T00:00:00.000Z", Text: "newer"},
+	}
+	if !reflect.DeepEqual(comments, wantComments) {
+		t.Errorf("comments = %+v, want %+v", comments, wantComments)
+	}
+
+	attachments, err := source.Attachments(wantCard.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantAttachments := []KaitenAttachment{{
+		ID:          syntheticID("a1"),
+		Name:        "shot.png",
+		URL:         "https://trello.com/1/cards/c1/attachments/a1/download/shot.png",
+		Size:        42,
+		MimeType:    "image/png",
+		CreatedAt:   "2026-01-03T00:00:00.000Z",
+		AuthorEmail: "bob@" + defaultTrelloEmailDomain,
+		Cover:       true,
+	}}
+	if !reflect.DeepEqual(attachments, wantAttachments) {
+		t.Errorf("attachments = %+v, want %+v", attachments, wantAttachments)
+	}
+	if !source.IsFileURL(attachments[0].URL) {
+		t.Errorf("%s is not a Trello file URL", attachments[0].URL)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+const (
+	inactiveUsersSkip    = "skip"
+	inactiveUsersDisable = "disable"
+	inactiveUsersFormer  = "former"
+
+	defaultFormerUserEmail = "former.employee@planka.local"
+	formerUserName         = "Бывший сотрудник"
+	formerUserUsername     = "former_employee"
+
+	// unknownAuthorName credits content whose Kaiten author is missing.
+	unknownAuthorName = "Неизвестный автор"
+)
+
+var usernameInvalidChars = regexp.MustCompile(`[^a-z0-9._]+`)
+
+// parseKaitenUser reads a Kaiten user, tolerating missing and null fields
+// except for the company role. Users without an e-mail are skipped.
+func parseKaitenUser(userMap map[string]any) (KaitenUser, bool, error) {
+	var user KaitenUser
+	user.Email, _ = userMap["email"].(string)
+	if user.Email == "" {
+		return KaitenUser{}, false, nil
+	}
+	user.ID, _ = userMap["id"].(float64)
+	user.FullName, _ = userMap["full_name"].(string)
+	user.Username, _ = userMap["username"].(string)
+	role, err := kaitenCompanyRole(userMap)
+	if err != nil {
+		return KaitenUser{}, false, fmt.Errorf("user %s: %w", user.Email, err)
+	}
+	user.CompanyRole = role
+	user.Inactive = kaitenUserInactive(userMap)
+	return user, true, nil
+}
+
+// kaitenUserInactive reports whether the account is blocked or deleted in
+// Kaiten. "activated" is false for invited users who have not signed up yet,
+// so it does not count.
+func kaitenUserInactive(userMap map[string]any) bool {
+	for _, key := range []string{"blocked", "deleted", "is_deleted"} {
+		if flag, ok := userMap[key].(bool); ok && flag {
+			return true
+		}
+	}
+	return false
+}
+
+// plankaUsername returns the user's Kaiten username, or one derived from the
+// e-mail address when Kaiten has none.
+func plankaUsername(user KaitenUser) string {
+	if user.Username != "" {
+		return user.Username
+	}
+	local, _, _ := strings.Cut(strings.ToLower(user.Email), "@")
+	return strings.Trim(usernameInvalidChars.ReplaceAllString(local, "_"), "_.")
+}
+
+// inactiveUsers applies the KAITEN_INACTIVE_USERS policy to deactivated Kaiten
+// accounts: skip drops them and credits their work to the administrator,
+// disable migrates them as deactivated PLANKA users, and former credits
+// everything to one shared "former employee" account.
+type inactiveUsers struct {
+	policy      string
+	formerEmail string
+	names       map[string]string
+}
+
+func newInactiveUsers(policy string, formerEmail string, users []KaitenUser) (*inactiveUsers, error) {
+	switch policy {
+	case inactiveUsersSkip, inactiveUsersDisable, inactiveUsersFormer:
+	default:
+		return nil, fmt.Errorf("unknown policy %q, expected %s, %s or %s", policy, inactiveUsersSkip, inactiveUsersDisable, inactiveUsersFormer)
+	}
+
+	inactive := &inactiveUsers{policy: policy, formerEmail: formerEmail, names: make(map[string]string)}
+	for _, user := range users {
+		if !user.Inactive {
+			continue
+		}
+		name := user.FullName
+		if name == "" {
+			name = user.Email
+		}
+		inactive.names[user.Email] = name
+	}
+	return inactive, nil
+}
+
+// create reports whether the PLANKA account of the user is created.
+func (u *inactiveUsers) create(user KaitenUser) bool {
+	return !user.Inactive || u.policy == inactiveUsersDisable
+}
+
+// member returns the PLANKA user that takes over the Kaiten user's
+// memberships, or "" when they are dropped.
+func (u *inactiveUsers) member(email string) string {
+	if _, inactive := u.names[email]; !inactive {
+		return email
+	}
+	switch u.policy {
+	case inactiveUsersDisable:
+		return email
+	case inactiveUsersFormer:
+		return u.formerEmail
+	}
+	return ""
+}
+
+// author returns the PLANKA user who writes content of the Kaiten user, ""
+// for the sink's own account, and the name to credit in the text if the
+// author has to be named explicitly.
+func (u *inactiveUsers) author(email string) (string, string) {
+	name, inactive := u.names[email]
+	if !inactive || u.policy == inactiveUsersDisable {
+		return email, ""
+	}
+	if u.policy == inactiveUsersFormer {
+		return u.formerEmail, name
+	}
+	return "", name
+}
+
+// comment credits a comment of an inactive user according to the policy.
+func (u *inactiveUsers) comment(comment KaitenComment) KaitenComment {
+	email, name := u.author(comment.AuthorEmail)
+	comment.AuthorEmail = email
+	if name != "" {
+		comment.Text = "**" + name + "**:\n\n" + comment.Text
+	}
+	return comment
+}
+
+// ensureFormerUser creates the shared account former employees are mapped to.
+func (u *inactiveUsers) ensureFormerUser(sink Sink, existing map[string]struct{}) error {
+	if u.policy != inactiveUsersFormer || len(u.names) == 0 {
+		return nil
+	}
+	if _, exists := existing[u.formerEmail]; exists {
+		return nil
+	}
+	_, err := sink.CreateUser(PlankaUser{
+		Username: formerUserUsername,
+		Name:     formerUserName,
+		Email:    u.formerEmail,
+		Password: "1234tempPass",
+		Role:     plankaRoleBoardUser,
+	})
+	return err
+}
+
+// deactivate switches off the PLANKA accounts created for inactive users. It
+// runs after the migration, since deactivated users can no longer write
+// comments.
+func (u *inactiveUsers) deactivate(sink Sink, created map[string]string, plankaUserIds map[string]string) {
+	if u.policy != inactiveUsersDisable {
+		return
+	}
+	for email := range u.names {
+		if _, ok := created[email]; !ok {
+			continue
+		}
+		userId, ok := plankaUserIds[email]
+		if !ok {
+			continue
+		}
+		if err := sink.DeactivateUser(userId); err != nil {
+			log.Printf("Error deactivating Planka user %s: %v", email, err)
+			continue
+		}
+		log.Printf("Deactivated Planka user %s", email)
+	}
+}
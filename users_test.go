@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestKaitenUserInactive(t *testing.T) {
+	for _, test := range []struct {
+		user map[string]any
+		want bool
+	}{
+		{map[string]any{"email": "a@x", "activated": false}, false},
+		{map[string]any{"email": "a@x", "activated": true, "blocked": true}, true},
+		{map[string]any{"email": "a@x", "deleted": true}, true},
+		{map[string]any{"email": "a@x", "is_deleted": false}, false},
+	} {
+		if got := kaitenUserInactive(test.user); got != test.want {
+			t.Errorf("kaitenUserInactive(%v) = %v, want %v", test.user, got, test.want)
+		}
+	}
+}
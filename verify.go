@@ -0,0 +1,492 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// verifyTarget reads migrated boards back from the tracker a migration wrote
+// to, by the target's own IDs.
+type verifyTarget interface {
+	Users() ([]PlankaUserInfo, error)
+	CardURL(cardId string) string
+	Board(boardId string) (verifyBoard, error)
+}
+
+// verifyBoard is a migrated board with the parts the verifier compares.
+type verifyBoard struct {
+	Lists []verifyList
+	Cards []verifyCard
+}
+
+type verifyList struct {
+	ID   string
+	Name string
+}
+
+type verifyCard struct {
+	ID          string
+	ListID      string
+	Name        string
+	Description string
+	DueDate     string
+	Labels      []string
+	// Members are e-mails.
+	Members     []string
+	TaskLists   []KaitenChecklist
+	Comments    int
+	Attachments []verifyAttachment
+}
+
+type verifyAttachment struct {
+	Name string
+	// Size is 0 when the target does not report it.
+	Size int64
+}
+
+// verifier walks the source and the target side by side through the ID
+// mapping and reports objects that are missing or differ after a migration.
+// The target may hold more than the source, e.g. labels for card types or
+// comments with time logs, so only what the source has is checked.
+type verifier struct {
+	source   Source
+	target   verifyTarget
+	mapping  *mappingStore
+	inactive *inactiveUsers
+	text     *textConverter
+	tags     map[float64]KaitenTag
+	report   *verifyReport
+
+	boards int
+	cards  int
+}
+
+func newVerifier(source Source, target verifyTarget, mapping *mappingStore, config migrationConfig) (*verifier, error) {
+	users, err := source.Users()
+	if err != nil {
+		return nil, fmt.Errorf("error getting users: %w", err)
+	}
+	inactive, err := newInactiveUsers(config.inactiveUsers, config.formerUserEmail, users)
+	if err != nil {
+		return nil, fmt.Errorf("invalid KAITEN_INACTIVE_USERS: %w", err)
+	}
+	tags, err := source.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("error getting tags: %w", err)
+	}
+	targetUsers, err := target.Users()
+	if err != nil {
+		return nil, fmt.Errorf("error fetching target users: %w", err)
+	}
+
+	return &verifier{
+		source:   source,
+		target:   target,
+		mapping:  mapping,
+		inactive: inactive,
+		text:     newTextConverter(mentionTargets(users, targetUsers), mapping, source.URL(), target.CardURL),
+		tags:     tags,
+		report:   &verifyReport{},
+	}, nil
+}
+
+// run compares every board and saves the report. It fails when there are
+// differences, so that scripts can tell a clean result.
+func (v *verifier) run(reportPath string) error {
+	spaces, err := v.source.Spaces()
+	if err != nil {
+		return fmt.Errorf("error getting spaces: %w", err)
+	}
+	uids := make([]string, 0, len(spaces))
+	for uid := range spaces {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+
+	for _, uid := range uids {
+		boards, err := v.source.Boards(spaces[uid])
+		if err != nil {
+			return fmt.Errorf("error getting boards of space %s: %w", spaces[uid].Name, err)
+		}
+		for _, board := range boards {
+			if err := v.board(board); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := v.report.Save(reportPath); err != nil {
+		return err
+	}
+	log.Printf("Verified %d boards and %d cards: %d differences, see %s", v.boards, v.cards, len(v.report.rows), reportPath)
+	if len(v.report.rows) > 0 {
+		return fmt.Errorf("found %d differences between the source and the target", len(v.report.rows))
+	}
+	return nil
+}
+
+func (v *verifier) board(board KaitenBoard) error {
+	boardName := board.Title
+	boardId, ok := v.mapping.Get(mappingKindBoard, formatKaitenID(board.ID))
+	if !ok {
+		v.report.add(boardName, "", "", "board", formatKaitenID(board.ID), "", "not migrated")
+		return nil
+	}
+	migrated, err := v.target.Board(boardId)
+	if err != nil {
+		v.report.add(boardName, "", "", "board", formatKaitenID(board.ID), boardId, err.Error())
+		return nil
+	}
+	columns, err := v.source.Columns(board)
+	if err != nil {
+		return fmt.Errorf("error getting columns of board %s: %w", boardName, err)
+	}
+	v.boards++
+
+	lists := make(map[string]verifyList)
+	for _, list := range migrated.Lists {
+		lists[list.ID] = list
+	}
+	cards := make(map[string]verifyCard)
+	cardsPerList := make(map[string]int)
+	for _, card := range migrated.Cards {
+		cards[card.ID] = card
+		if _, ok := lists[card.ListID]; ok {
+			cardsPerList[card.ListID]++
+		}
+	}
+	if len(lists) != len(columns) {
+		v.report.add(boardName, "", "", "list count", strconv.Itoa(len(columns)), strconv.Itoa(len(lists)), "differs")
+	}
+
+	for _, column := range columns {
+		listId, ok := v.mapping.Get(mappingKindList, formatKaitenID(column.Id))
+		if !ok {
+			v.report.add(boardName, column.Name, "", "list", formatKaitenID(column.Id), "", "not migrated")
+			continue
+		}
+		list, ok := lists[listId]
+		if !ok {
+			v.report.add(boardName, column.Name, "", "list", formatKaitenID(column.Id), listId, "missing in target")
+			continue
+		}
+		if list.Name != column.Name {
+			v.report.add(boardName, column.Name, "", "list name", column.Name, list.Name, "differs")
+		}
+
+		sourceCards, err := v.source.Cards(column)
+		if err != nil {
+			return fmt.Errorf("error getting cards of column %s: %w", column.Name, err)
+		}
+		migratedCards := 0
+		for _, sourceCard := range sourceCards {
+			if sourceCard.Archived {
+				continue
+			}
+			migratedCards++
+			cardId, ok := v.mapping.Get(mappingKindCard, formatKaitenID(sourceCard.ID))
+			if !ok {
+				v.report.add(boardName, column.Name, sourceCard.Title, "card", formatKaitenID(sourceCard.ID), "", "not migrated")
+				continue
+			}
+			card, ok := cards[cardId]
+			if !ok {
+				v.report.add(boardName, column.Name, sourceCard.Title, "card", formatKaitenID(sourceCard.ID), cardId, "missing in target")
+				continue
+			}
+			if card.ListID != listId {
+				v.report.add(boardName, column.Name, sourceCard.Title, "card list", list.Name, lists[card.ListID].Name, "differs")
+			}
+			v.card(boardName, column.Name, sourceCard, card)
+		}
+		if cardsPerList[listId] != migratedCards {
+			v.report.add(boardName, column.Name, "", "card count", strconv.Itoa(migratedCards), strconv.Itoa(cardsPerList[listId]), "differs")
+		}
+	}
+	return nil
+}
+
+func (v *verifier) card(boardName string, listName string, sourceCard KaitenCard, card verifyCard) {
+	v.cards++
+	add := func(check string, sourceValue string, targetValue string, problem string) {
+		v.report.add(boardName, listName, sourceCard.Title, check, sourceValue, targetValue, problem)
+	}
+
+	if card.Name != sourceCard.Title {
+		add("title", sourceCard.Title, card.Name, "differs")
+	}
+	if description := verifyText(v.text.convert(sourceCard.Description)); !strings.Contains(verifyText(card.Description), description) {
+		add("description", description, verifyText(card.Description), "differs")
+	}
+
+	dueDate := sourceCard.DueDate
+	if dueDate == "" {
+		dueDate = sourceCard.EndDate
+	}
+	if !sameTime(dueDate, card.DueDate) {
+		add("due date", dueDate, card.DueDate, "differs")
+	}
+
+	labels := make(map[string]bool)
+	for _, label := range card.Labels {
+		labels[label] = true
+	}
+	for _, tagId := range sourceCard.TagIds {
+		if tag, ok := v.tags[tagId]; ok && !labels[tag.Name] {
+			add("label", tag.Name, "", "missing in target")
+		}
+	}
+
+	members := make(map[string]bool)
+	for _, email := range card.Members {
+		members[email] = true
+	}
+	for _, member := range sourceCard.Members {
+		if email := v.inactive.member(member.Email); email != "" && !members[email] {
+			add("member", email, "", "missing in target")
+		}
+	}
+
+	v.checklists(sourceCard, card, add)
+	v.comments(sourceCard, card, add)
+	v.attachments(sourceCard, card, add)
+}
+
+func (v *verifier) checklists(sourceCard KaitenCard, card verifyCard, add func(string, string, string, string)) {
+	taskLists := make(map[string][]KaitenChecklist)
+	for _, taskList := range card.TaskLists {
+		taskLists[taskList.Name] = append(taskLists[taskList.Name], taskList)
+	}
+
+	for _, checklistId := range sourceCard.Checklists {
+		checklist, err := v.source.Checklist(sourceCard.ID, checklistId)
+		if err != nil {
+			add("task list", formatKaitenID(checklistId), "", err.Error())
+			continue
+		}
+		if len(taskLists[checklist.Name]) == 0 {
+			add("task list", checklist.Name, "", "missing in target")
+			continue
+		}
+		taskList := taskLists[checklist.Name][0]
+		taskLists[checklist.Name] = taskLists[checklist.Name][1:]
+
+		tasks := make(map[string][]KaitenChecklistItem)
+		for _, task := range taskList.Items {
+			tasks[task.Text] = append(tasks[task.Text], task)
+		}
+		if len(taskList.Items) != len(checklist.Items) {
+			add("task count", checklist.Name+": "+strconv.Itoa(len(checklist.Items)), strconv.Itoa(len(taskList.Items)), "differs")
+		}
+		for _, item := range checklist.Items {
+			if len(tasks[item.Text]) == 0 {
+				add("task", checklist.Name+": "+item.Text, "", "missing in target")
+				continue
+			}
+			task := tasks[item.Text][0]
+			tasks[item.Text] = tasks[item.Text][1:]
+			if task.Checked != item.Checked {
+				add("task completion", checklist.Name+": "+item.Text+" "+strconv.FormatBool(item.Checked), strconv.FormatBool(task.Checked), "differs")
+			}
+		}
+	}
+}
+
+func (v *verifier) comments(sourceCard KaitenCard, card verifyCard, add func(string, string, string, string)) {
+	comments, err := v.source.Comments(sourceCard.ID)
+	if err != nil {
+		add("comments", "", "", err.Error())
+		return
+	}
+	if card.Comments < len(comments) {
+		add("comment count", strconv.Itoa(len(comments)), strconv.Itoa(card.Comments), "missing in target")
+	}
+}
+
+func (v *verifier) attachments(sourceCard KaitenCard, card verifyCard, add func(string, string, string, string)) {
+	attachments, err := v.source.Attachments(sourceCard.ID)
+	if err != nil {
+		add("attachments", "", "", err.Error())
+		return
+	}
+	stored := make(map[string][]verifyAttachment)
+	for _, attachment := range card.Attachments {
+		stored[attachment.Name] = append(stored[attachment.Name], attachment)
+	}
+	for _, attachment := range attachments {
+		if len(stored[attachment.Name]) == 0 {
+			add("attachment", attachment.Name, "", "missing in target")
+			continue
+		}
+		migrated := stored[attachment.Name][0]
+		stored[attachment.Name] = stored[attachment.Name][1:]
+		if attachment.Size > 0 && migrated.Size > 0 && int64(attachment.Size) != migrated.Size {
+			add("attachment size", attachment.Name+": "+strconv.FormatInt(int64(attachment.Size), 10), strconv.FormatInt(migrated.Size, 10), "differs")
+		}
+	}
+}
+
+// plankaVerifyTarget reads migrated boards from PLANKA.
+type plankaVerifyTarget struct {
+	emails map[string]string
+}
+
+func (t *plankaVerifyTarget) Users() ([]PlankaUserInfo, error) {
+	users, err := getPlankaUsers()
+	if err != nil {
+		return nil, err
+	}
+	t.emails = make(map[string]string, len(users))
+	for _, user := range users {
+		t.emails[user.ID] = user.Email
+	}
+	return users, nil
+}
+
+func (t *plankaVerifyTarget) CardURL(cardId string) string {
+	return plankaCardURL(cardId)
+}
+
+func (t *plankaVerifyTarget) Board(boardId string) (verifyBoard, error) {
+	contents, err := getPlankaBoardContents(boardId)
+	if err != nil {
+		return verifyBoard{}, err
+	}
+
+	var board verifyBoard
+	for _, list := range contents.Lists {
+		if list.Type == "active" || list.Type == "closed" {
+			board.Lists = append(board.Lists, verifyList{ID: list.ID, Name: list.Name})
+		}
+	}
+
+	labelNames := make(map[string]string)
+	for _, label := range contents.Labels {
+		labelNames[label.Id] = label.Name
+	}
+	for _, plankaCard := range contents.Cards {
+		card := verifyCard{
+			ID:          plankaCard.ID,
+			ListID:      plankaCard.ListID,
+			Name:        plankaCard.Name,
+			Description: plankaCard.Description,
+			DueDate:     plankaCard.DueDate,
+		}
+		for _, cardLabel := range contents.CardLabels {
+			if cardLabel.CardID == card.ID {
+				card.Labels = append(card.Labels, labelNames[cardLabel.LabelID])
+			}
+		}
+		for _, membership := range contents.CardMemberships {
+			if membership.CardID == card.ID {
+				card.Members = append(card.Members, t.emails[membership.UserID])
+			}
+		}
+		for _, taskList := range contents.TaskLists {
+			if taskList.CardID != card.ID {
+				continue
+			}
+			checklist := KaitenChecklist{Name: taskList.Name}
+			for _, task := range contents.Tasks {
+				if task.TaskListID == taskList.ID {
+					checklist.Items = append(checklist.Items, KaitenChecklistItem{Text: task.Name, Checked: task.IsCompleted})
+				}
+			}
+			card.TaskLists = append(card.TaskLists, checklist)
+		}
+		for _, attachment := range contents.Attachments {
+			if attachment.CardID == card.ID {
+				card.Attachments = append(card.Attachments, verifyAttachment{Name: attachment.Name, Size: attachment.Size()})
+			}
+		}
+
+		if plankaCard.CommentsTotal != nil {
+			card.Comments = *plankaCard.CommentsTotal
+		} else {
+			comments, err := getPlankaCommentsForCard(card.ID)
+			if err != nil {
+				return verifyBoard{}, err
+			}
+			card.Comments = len(comments)
+		}
+		board.Cards = append(board.Cards, card)
+	}
+	return board, nil
+}
+
+// verifyText normalises Markdown for comparison: image links are re-hosted
+// by the migration, so only their alt text is kept, and whitespace is
+// collapsed.
+func verifyText(text string) string {
+	text = markdownImagePattern.ReplaceAllString(text, "![$1]")
+	return strings.TrimSpace(spacesPattern.ReplaceAllString(text, " "))
+}
+
+// sameTime reports whether two timestamps denote the same instant. Dates
+// without a time are compared as UTC midnight.
+func sameTime(a string, b string) bool {
+	if a == "" || b == "" {
+		return a == b
+	}
+	parse := func(value string) (time.Time, bool) {
+		for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+			if parsed, err := time.Parse(layout, value); err == nil {
+				return parsed, true
+			}
+		}
+		return time.Time{}, false
+	}
+	at, okA := parse(a)
+	bt, okB := parse(b)
+	if !okA || !okB {
+		return a == b
+	}
+	return at.Equal(bt)
+}
+
+type verifyReport struct {
+	mu   sync.Mutex
+	rows [][]string
+}
+
+func (r *verifyReport) add(board string, list string, card string, check string, sourceValue string, targetValue string, problem string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rows = append(r.rows, []string{board, list, card, check, sourceValue, targetValue, problem})
+}
+
+// Save writes the differences as CSV, sorted by board, list and card.
+func (r *verifyReport) Save(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sort.SliceStable(r.rows, func(i, j int) bool {
+		for column := 0; column < 3; column++ {
+			if r.rows[i][column] != r.rows[j][column] {
+				return r.rows[i][column] < r.rows[j][column]
+			}
+		}
+		return false
+	})
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create verification report %s: %w", path, err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"board", "list", "card", "check", "source", "target", "problem"})
+	writer.WriteAll(r.rows)
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write verification report %s: %w", path, err)
+	}
+	return file.Close()
+}
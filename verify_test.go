@@ -0,0 +1,167 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifierCardDifferences(t *testing.T) {
+	source := &memSource{
+		comments:    map[float64][]KaitenComment{1: {{ID: 1, Text: "a"}, {ID: 2, Text: "b"}}},
+		attachments: map[float64][]KaitenAttachment{1: {{Name: "a.txt", Size: 5}}},
+		checklists: map[float64]KaitenChecklist{7: {Name: "Шаги", Items: []KaitenChecklistItem{
+			{Text: "Первый", Checked: true},
+			{Text: "Второй"},
+		}}},
+	}
+	sourceCard := KaitenCard{
+		ID:          1,
+		Title:       "Карточка",
+		Description: "**Текст** ![схема](https://kaiten.example/files/a.png)",
+		DueDate:     "2024-03-01",
+		TagIds:      []float64{5},
+		Members:     []KaitenCardMember{{Email: "ann@x"}, {Email: "old@x"}},
+		Checklists:  []float64{7},
+	}
+	target := func() verifyCard {
+		return verifyCard{
+			Name:        "Карточка",
+			Description: "**Текст**\n![схема](https://planka.example/attachments/a.png)\n\n## Связи",
+			DueDate:     "2024-03-01T00:00:00.000Z",
+			Labels:      []string{"bug", "Story"},
+			Members:     []string{"ann@x"},
+			TaskLists: []KaitenChecklist{{Name: "Шаги", Items: []KaitenChecklistItem{
+				{Text: "Второй"},
+				{Text: "Первый", Checked: true},
+			}}},
+			Comments:    3,
+			Attachments: []verifyAttachment{{Name: "a.txt", Size: 5}},
+		}
+	}
+
+	for _, test := range []struct {
+		name   string
+		change func(card *verifyCard)
+		want   []string
+	}{
+		{"same card", func(card *verifyCard) {}, nil},
+		{"renamed", func(card *verifyCard) { card.Name = "Другая" }, []string{"title differs"}},
+		{"description", func(card *verifyCard) { card.Description = "Текст" }, []string{"description differs"}},
+		{"due date", func(card *verifyCard) { card.DueDate = "2024-03-02T00:00:00Z" }, []string{"due date differs"}},
+		{"no due date", func(card *verifyCard) { card.DueDate = "" }, []string{"due date differs"}},
+		{"label", func(card *verifyCard) { card.Labels = []string{"Story"} }, []string{"label missing in target"}},
+		{"member", func(card *verifyCard) { card.Members = nil }, []string{"member missing in target"}},
+		{"task completion", func(card *verifyCard) { card.TaskLists[0].Items[1].Checked = false }, []string{"task completion differs"}},
+		{"task", func(card *verifyCard) { card.TaskLists[0].Items = card.TaskLists[0].Items[:1] }, []string{"task count differs", "task missing in target"}},
+		{"task list", func(card *verifyCard) { card.TaskLists = nil }, []string{"task list missing in target"}},
+		{"comments", func(card *verifyCard) { card.Comments = 1 }, []string{"comment count missing in target"}},
+		{"attachment size", func(card *verifyCard) { card.Attachments[0].Size = 4 }, []string{"attachment size differs"}},
+		{"unknown attachment size", func(card *verifyCard) { card.Attachments[0].Size = 0 }, nil},
+		{"attachment", func(card *verifyCard) { card.Attachments = nil }, []string{"attachment missing in target"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			inactive, err := newInactiveUsers(inactiveUsersSkip, "", []KaitenUser{{Email: "old@x", Inactive: true}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			mapping := &mappingStore{Entries: make(map[string]map[string]string)}
+			v := &verifier{
+				source:   source,
+				mapping:  mapping,
+				inactive: inactive,
+				text:     newTextConverter(nil, mapping, source.URL(), func(cardId string) string { return "https://planka.example/cards/" + cardId }),
+				tags:     map[float64]KaitenTag{5: {Id: 5, Name: "bug"}},
+				report:   &verifyReport{},
+			}
+
+			card := target()
+			test.change(&card)
+			v.card("Доска", "Todo", sourceCard, card)
+
+			var got []string
+			for _, row := range v.report.rows {
+				got = append(got, row[3]+" "+row[6])
+			}
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("differences = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSameTime(t *testing.T) {
+	for _, test := range []struct {
+		a, b string
+		want bool
+	}{
+		{"", "", true},
+		{"2024-03-01", "", false},
+		{"2024-03-01", "2024-03-01T00:00:00Z", true},
+		{"2024-03-01T12:00:00+03:00", "2024-03-01T09:00:00.000Z", true},
+		{"2024-03-01T12:00:00Z", "2024-03-01T12:00:01Z", false},
+		{"soon", "soon", true},
+	} {
+		if got := sameTime(test.a, test.b); got != test.want {
+			t.Errorf("sameTime(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+// boardTarget is a verifyTarget with fixed boards.
+type boardTarget map[string]verifyBoard
+
+func (t boardTarget) Users() ([]PlankaUserInfo, error) { return nil, nil }
+func (t boardTarget) CardURL(cardId string) string     { return "https://planka.example/cards/" + cardId }
+func (t boardTarget) Board(boardId string) (verifyBoard, error) {
+	return t[boardId], nil
+}
+
+func TestVerifierBoardDifferences(t *testing.T) {
+	source := &memSource{
+		columns: map[float64][]KaitenColumn{10: {{Id: 100, Name: "Todo"}, {Id: 101, Name: "Done"}, {Id: 102, Name: "Later"}}},
+		cards: map[float64][]KaitenCard{
+			100: {{ID: 1, Title: "Moved"}, {ID: 2, Title: "Lost"}, {ID: 3, Title: "Old", Archived: true}},
+			101: {{ID: 4, Title: "Unmapped"}},
+		},
+	}
+	mapping := &mappingStore{Entries: make(map[string]map[string]string)}
+	mapping.Set(mappingKindBoard, "10", "b")
+	mapping.Set(mappingKindList, "100", "todo")
+	mapping.Set(mappingKindList, "101", "done")
+	mapping.Set(mappingKindCard, "1", "c1")
+	mapping.Set(mappingKindCard, "2", "c2")
+	target := boardTarget{"b": {
+		Lists: []verifyList{{ID: "todo", Name: "To do"}, {ID: "done", Name: "Done"}},
+		Cards: []verifyCard{{ID: "c1", ListID: "done", Name: "Moved"}},
+	}}
+	inactive, err := newInactiveUsers(inactiveUsersSkip, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &verifier{source: source, target: target, mapping: mapping, inactive: inactive, text: newTextConverter(nil, mapping, "", target.CardURL), report: &verifyReport{}}
+
+	if err := v.board(KaitenBoard{ID: 10, Title: "Main"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.board(KaitenBoard{ID: 11, Title: "Side"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, row := range v.report.rows {
+		got = append(got, strings.Join([]string{row[0], row[1], row[2], row[3], row[6]}, "|"))
+	}
+	want := []string{
+		"Main|||list count|differs",
+		"Main|Todo||list name|differs",
+		"Main|Todo|Moved|card list|differs",
+		"Main|Todo|Lost|card|missing in target",
+		"Main|Todo||card count|differs",
+		"Main|Done|Unmapped|card|not migrated",
+		"Main|Later||list|not migrated",
+		"Side|||board|not migrated",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("differences:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}